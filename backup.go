@@ -1,16 +1,26 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 
 	"github.com/rs/zerolog/log"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -22,39 +32,147 @@ const (
 	StatusSuccess BackupStatus = "success"
 	StatusWarning BackupStatus = "warning"
 	StatusFailed  BackupStatus = "failed"
+	// StatusStale is never a run's status; it marks the alert sent by the
+	// staleness watchdog.
+	StatusStale BackupStatus = "stale"
 )
 
 type BackupRun struct {
-	ID        string       `json:"id"`
-	StartTime time.Time    `json:"start_time"`
-	EndTime   time.Time    `json:"end_time,omitempty"`
-	Duration  string       `json:"duration,omitempty"`
-	Status    BackupStatus `json:"status"`
-	ExitCode  int          `json:"exit_code"`
-	LogFile   string       `json:"log_file"`
-	Summary   string       `json:"summary,omitempty"`
+	ID        string         `json:"id"`
+	StartTime time.Time      `json:"start_time"`
+	EndTime   time.Time      `json:"end_time,omitempty"`
+	Duration  string         `json:"duration,omitempty"`
+	Status    BackupStatus   `json:"status"`
+	ExitCode  int            `json:"exit_code"`
+	LogFile   string         `json:"log_file"`
+	Summary   string         `json:"summary,omitempty"`
+	RetryOf   string         `json:"retry_of,omitempty"`
+	Command   string         `json:"command,omitempty"`
+	Verbose   bool           `json:"verbose,omitempty"`
+	Note      string         `json:"note,omitempty"`
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Path      string         `json:"path,omitempty"`
+	Stats     *TransferStats `json:"stats,omitempty"`
+	Progress  *RunProgress   `json:"progress,omitempty"`
+	// Errors lists the per-file errors rsync reported, capped at
+	// maxRunErrors.
+	Errors []RunError `json:"errors,omitempty"`
+	// ErrorOutput is the end of rsync's stderr, up to maxErrorOutput bytes.
+	ErrorOutput string `json:"error_output,omitempty"`
+	// Overrunning is set once the run has taken longer than max_run_duration.
+	Overrunning bool `json:"overrunning,omitempty"`
+	// SlowWarning is set on a finished run that took more than
+	// slowRunFactor times expected_duration, whatever its exit code.
+	SlowWarning bool `json:"slow_warning,omitempty"`
+	// BandwidthLimit is the per-run override from RunOptions, nil if the
+	// configured limit applied.
+	BandwidthLimit *Bandwidth `json:"bandwidth_limit,omitempty"`
+	// SourceSize is the file bytes of the source and DestSize the part of
+	// them in sync at the destination, measured after a successful run with
+	// verify_sizes; SizeMismatch is set when DestSize falls short by more
+	// than the tolerance of sizesDiffer, which makes the run a warning.
+	SourceSize   int64 `json:"source_size,omitempty"`
+	DestSize     int64 `json:"dest_size,omitempty"`
+	SizeMismatch bool  `json:"size_mismatch,omitempty"`
 }
 
+// ScheduleSkip records a scheduled trigger that did not start a backup.
+type ScheduleSkip struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// RunOptions holds per-run parameters for RunWithOptions.
+type RunOptions struct {
+	// RetryOf is the ID of an earlier run this run retries.
+	RetryOf string
+	// Verbose raises rsync's verbosity for this run only.
+	Verbose bool
+	// Note is a free-text label stored on the run, e.g. "before upgrade".
+	Note string
+	// DryRun runs rsync with --dry-run; the run is recorded but nothing is
+	// copied or deleted.
+	DryRun bool
+	// Confirmed skips the first_run_dry_run safety dry run.
+	Confirmed bool
+	// Path narrows the run to one directory inside source_path, relative
+	// to it, as returned by Config.Subpath.
+	Path string
+	// BandwidthLimit overrides the configured bandwidth limit, in KB/s, for
+	// this run only; 0 means unlimited and nil keeps the configured limit.
+	BandwidthLimit *Bandwidth
+}
+
+// ErrBackupsLocked is returned by Run while the maintenance lock is set.
+var ErrBackupsLocked = errors.New("backups are locked — unlock them from the dashboard or POST /api/unlock")
+
 // CmdFactory creates an *exec.Cmd for the given program and arguments.
 // Defaults to exec.Command; tests can override this to inject fakes.
 type CmdFactory func(name string, args ...string) *exec.Cmd
 
 type BackupExecutor struct {
-	cfg        *Config
-	mu         sync.Mutex
-	status     BackupStatus
+	cfg *Config
+
+	// mu guards status, running, current, history and totals. The
+	// in-flight run is only mutated with mu held; execute reads just the
+	// fields that are fixed at start (StartTime, LogFile) without it.
+	mu     sync.Mutex
+	status BackupStatus
+	// running holds the run slot from RunWithOptions until finishRun. It
+	// is what "already in progress" checks use, since status doubles as
+	// the last run's result.
+	running    bool
 	current    *BackupRun
 	history    []BackupRun
+	totals     CumulativeStats
+	lastSkip   *ScheduleSkip
 	cmdFactory CmdFactory
+	clock      Clock
+	logNames   logNamer
+	notifiers  []configuredNotifier
+	// diskFree reports free bytes on a filesystem; tests stub it.
+	diskFree func(path string) (uint64, error)
+
+	// rsyncVersion is the local rsync version ("3.2.7"), empty until
+	// DetectRsyncVersion succeeds.
+	rsyncVersion string
+
+	// proc is the running rsync process, for Cancel; cancelled marks that
+	// Cancel stopped it. Both are reset when the run finishes.
+	proc      *os.Process
+	cancelled bool
+	// estimating is set while a dry run (Estimate, DryRun) holds the run
+	// slot.
+	estimating bool
+	// remoteCheck shares SSH remote checks between dashboard requests, and
+	// reachability the SSH logins of deep readiness probes.
+	remoteCheck  remoteCheckCache
+	reachability remoteCheckCache
+	// runs tracks execute goroutines, so Wait covers the whole run
+	// including log rotation.
+	runs sync.WaitGroup
+	// notifications tracks notifications still being sent.
+	notifications sync.WaitGroup
 }
 
 func NewBackupExecutor(cfg *Config) *BackupExecutor {
+	logNames, err := newLogNamer(cfg.LogNameTemplate)
+	if err != nil {
+		// Rejected by Config.validate; only reachable with a hand-built Config
+		log.Error().Err(err).Msg("invalid log_name_template, using " + defaultLogNameTemplate)
+		logNames, _ = newLogNamer("")
+	}
 	ex := &BackupExecutor{
+		logNames:   logNames,
 		cfg:        cfg,
 		status:     StatusIdle,
 		cmdFactory: exec.Command,
+		clock:      realClock{},
+		notifiers:  buildNotifiers(cfg.Notifiers, cfg.NotifyTimeout, cfg.InstanceName),
+		diskFree:   diskFree,
 	}
 	ex.loadHistory()
+	ex.loadTotals()
 	return ex
 }
 
@@ -64,11 +182,27 @@ func (ex *BackupExecutor) Status() BackupStatus {
 	return ex.status
 }
 
+// IsRunning reports whether a backup is in progress right now, regardless of
+// how the previous run ended.
+func (ex *BackupExecutor) IsRunning() bool {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return ex.current != nil
+}
+
 func (ex *BackupExecutor) Current() *BackupRun {
 	ex.mu.Lock()
 	defer ex.mu.Unlock()
 	if ex.current != nil {
 		cp := *ex.current
+		if cp.Stats != nil {
+			stats := *cp.Stats
+			cp.Stats = &stats
+		}
+		if cp.Progress != nil {
+			progress := *cp.Progress
+			cp.Progress = &progress
+		}
 		return &cp
 	}
 	return nil
@@ -82,6 +216,38 @@ func (ex *BackupExecutor) History() []BackupRun {
 	return out
 }
 
+// RunByID returns the running or past run with the given ID.
+func (ex *BackupExecutor) RunByID(id string) (BackupRun, bool) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.current != nil && ex.current.ID == id {
+		return *ex.current, true
+	}
+	for _, run := range ex.history {
+		if run.ID == id {
+			return run, true
+		}
+	}
+	return BackupRun{}, false
+}
+
+// RunByLogFile returns the running or past run that wrote the given log file.
+// A compressed name (".log.gz") matches the run's original ".log" name.
+func (ex *BackupExecutor) RunByLogFile(name string) (BackupRun, bool) {
+	name = strings.TrimSuffix(name, ".gz")
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.current != nil && ex.current.LogFile == name {
+		return *ex.current, true
+	}
+	for _, run := range ex.history {
+		if run.LogFile == name {
+			return run, true
+		}
+	}
+	return BackupRun{}, false
+}
+
 func (ex *BackupExecutor) LastRun() *BackupRun {
 	ex.mu.Lock()
 	defer ex.mu.Unlock()
@@ -92,102 +258,607 @@ func (ex *BackupExecutor) LastRun() *BackupRun {
 	return &cp
 }
 
+// hasRealRun reports whether the history has a run that was not a dry run.
+func (ex *BackupExecutor) hasRealRun() bool {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	for _, run := range ex.history {
+		if !run.DryRun {
+			return true
+		}
+	}
+	return false
+}
+
+// AwaitingConfirmation reports whether first_run_dry_run has recorded a
+// dry run and the first real backup still has to be confirmed.
+func (ex *BackupExecutor) AwaitingConfirmation() bool {
+	return ex.cfg.FirstRunDryRun && ex.LastRun() != nil && !ex.hasRealRun()
+}
+
+// needsFirstRunDryRun reports whether first_run_dry_run turns an
+// unconfirmed backup into a dry run: no real backup has run yet and the
+// destination already contains files. A destination that cannot be checked
+// counts as non-empty.
+func (ex *BackupExecutor) needsFirstRunDryRun() bool {
+	if !ex.cfg.FirstRunDryRun || ex.hasRealRun() {
+		return false
+	}
+	nonEmpty, _, err := ex.CheckRemotePath()
+	if err != nil {
+		log.Warn().Err(err).Msg("first_run_dry_run: could not check the destination")
+		return true
+	}
+	return nonEmpty
+}
+
 // Run starts a backup. Returns an error if one is already running or settings are not configured.
 func (ex *BackupExecutor) Run() error {
+	return ex.RunWithOptions(RunOptions{})
+}
+
+// RunWithOptions starts a backup like Run, applying the given per-run options.
+func (ex *BackupExecutor) RunWithOptions(opts RunOptions) error {
+	if ex.cfg.Locked() {
+		return ErrBackupsLocked
+	}
 	if !ex.cfg.TransferConfigured() {
 		return fmt.Errorf("transfer settings not configured — use the web UI to set source, destination, and SSH key")
 	}
+	if err := ex.checkLocalFreeSpace(); err != nil {
+		return err
+	}
+	if err := ex.checkFilterFile(); err != nil {
+		return err
+	}
+	if !opts.DryRun && !opts.Confirmed && ex.needsFirstRunDryRun() {
+		log.Warn().Msg("first_run_dry_run: destination is not empty and no backup has run yet, running with --dry-run")
+		opts.DryRun = true
+	}
 	ex.mu.Lock()
-	if ex.status == StatusRunning {
+	if ex.running {
 		ex.mu.Unlock()
 		return fmt.Errorf("backup already in progress")
 	}
+	if ex.estimating {
+		ex.mu.Unlock()
+		return fmt.Errorf("dry run in progress")
+	}
+	ex.running = true
 	ex.status = StatusRunning
 
-	runID := time.Now().Format("20060102-150405")
-	logFileName := fmt.Sprintf("backup-%s.log", runID)
+	now := ex.clock.Now()
+	runID := ex.nextRunID(now)
+	logFileName := ex.logNames.render(now, runID, StatusRunning)
+	if ex.cfg.SingleLogFile {
+		logFileName = singleLogName
+	}
 	logPath := filepath.Join(ex.cfg.LogDir, logFileName)
 
 	run := &BackupRun{
-		ID:        runID,
-		StartTime: time.Now(),
-		Status:    StatusRunning,
-		LogFile:   logFileName,
+		ID:             runID,
+		StartTime:      now,
+		Status:         StatusRunning,
+		LogFile:        logFileName,
+		RetryOf:        opts.RetryOf,
+		Verbose:        opts.Verbose || ex.cfg.Verbose,
+		Note:           opts.Note,
+		DryRun:         opts.DryRun,
+		Path:           opts.Path,
+		BandwidthLimit: opts.BandwidthLimit,
 	}
 	ex.current = run
+	ex.lastSkip = nil
+	ex.cancelled = false
+	ex.runs.Add(1)
 	ex.mu.Unlock()
 
 	go ex.execute(run, logPath)
 	return nil
 }
 
+// runIDLayout formats run IDs, and so log filenames, from the start time.
+// The fixed-width millisecond part keeps them sorting chronologically.
+const runIDLayout = "20060102-150405.000"
+
+// nextRunID returns the ID for a run starting at now. If that is not after
+// the previous run's ID (a run within the same millisecond, or the clock
+// going back) it is bumped 1ms past it, so IDs and log files never
+// collide. Must be called with mu held.
+func (ex *BackupExecutor) nextRunID(now time.Time) string {
+	id := now.Format(runIDLayout)
+	if len(ex.history) == 0 || id > ex.history[0].ID {
+		return id
+	}
+	if last, err := time.ParseInLocation(runIDLayout, ex.history[0].ID, now.Location()); err == nil {
+		return last.Add(time.Millisecond).Format(runIDLayout)
+	}
+	return id
+}
+
 func (ex *BackupExecutor) execute(run *BackupRun, logPath string) {
+	defer ex.runs.Done()
+
 	// Ensure log directory exists
 	if err := os.MkdirAll(ex.cfg.LogDir, 0755); err != nil {
 		log.Error().Err(err).Msg("failed to create log dir")
 	}
 
-	logFile, err := os.Create(logPath)
+	var logFile *os.File
+	var err error
+	if ex.cfg.SingleLogFile {
+		if err := ex.rotateSingleLog(); err != nil {
+			log.Error().Err(err).Msg("failed to rotate log")
+		}
+		logFile, err = os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	} else {
+		logFile, err = os.Create(logPath)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create log file")
-		ex.finishRun(run, 1, "failed to create log file")
+		ex.finishRun(run, StatusFailed, 1, "failed to create log file", nil)
 		return
 	}
 	defer logFile.Close()
+	if ex.cfg.SingleLogFile {
+		fmt.Fprint(logFile, runDelimiter(run.ID))
+	}
 
-	args := ex.buildRsyncArgs()
+	args := ex.rsyncArgs(run.Verbose, run.BandwidthLimit)
+	if run.DryRun {
+		args = append([]string{args[0], "--dry-run"}, args[1:]...)
+	}
+	if run.Path != "" {
+		args = ex.subpathArgs(args, run.Path)
+	}
 	cmd := ex.cmdFactory("rsync", args...)
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+	// rsync reports per-file errors on stderr, but collect from both
+	// streams so they are found however the output is redirected.
+	runErrs := &runErrors{}
+	cmd.Stdout = &progressWriter{
+		w:      &errorWriter{w: logFile, errs: runErrs},
+		update: func(p RunProgress) { ex.setProgress(run, p) },
+	}
+	// stderr also goes to the combined log; its tail is kept on the run so
+	// the error is not lost among the progress output
+	stderrTail := &tailBuffer{max: maxErrorOutput}
+	cmd.Stderr = &errorWriter{w: io.MultiWriter(logFile, stderrTail), errs: runErrs}
+
+	command := "rsync " + strings.Join(args, " ")
+	ex.mu.Lock()
+	run.Command = command
+	ex.mu.Unlock()
 
 	fmt.Fprintf(logFile, "=== Backup started at %s ===\n", run.StartTime.Format(time.RFC3339))
-	fmt.Fprintf(logFile, "Command: rsync %s\n\n", strings.Join(args, " "))
+	fmt.Fprintf(logFile, "Command: %s\n\n", command)
+
+	if ex.cfg.MaxRunDuration > 0 {
+		overrun := time.AfterFunc(ex.cfg.MaxRunDuration, func() { ex.markOverrunning(run) })
+		defer overrun.Stop()
+	}
+
+	ex.mu.Lock()
+	if ex.cancelled {
+		err = errors.New("cancelled before rsync started")
+	} else if err = cmd.Start(); err == nil {
+		ex.proc = cmd.Process
+	}
+	ex.mu.Unlock()
+	if err == nil {
+		err = cmd.Wait()
+	}
 
-	err = cmd.Run()
+	ex.mu.Lock()
+	cancelled := ex.cancelled
+	ex.proc, ex.cancelled = nil, false
+	run.Errors = runErrs.errors()
+	run.ErrorOutput = stderrTail.String()
+	ex.mu.Unlock()
 
 	exitCode := 0
+	status := StatusSuccess
 	summary := "completed successfully"
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
 			exitCode = exitErr.ExitCode()
+			status = ex.cfg.ExitStatus(exitCode)
+			summary = rsyncExitSummary(exitCode)
 		} else {
+			// rsync never ran, so there is no rsync exit code to report,
+			// and ignore_exit_codes or warning_exit_codes must not apply
 			exitCode = 1
+			status = StatusFailed
+			summary = startErrorSummary(err)
+			fmt.Fprintf(logFile, "ERROR: %s (%v)\n", summary, err)
+			log.Error().Err(err).Msg(summary)
 		}
-		summary = rsyncExitSummary(exitCode)
+		if cancelled {
+			summary = "cancelled during shutdown"
+		}
+	}
+
+	if run.DryRun {
+		summary = "dry run " + summary + "; nothing was copied"
 	}
 
 	fmt.Fprintf(logFile, "\n=== Backup finished at %s (exit code: %d) ===\n",
-		time.Now().Format(time.RFC3339), exitCode)
+		ex.clock.Now().Format(time.RFC3339), exitCode)
 
-	ex.finishRun(run, exitCode, summary)
+	if exitCode == 0 && !run.DryRun && ex.cfg.VerifySizes {
+		if source, dest, err := ex.compareSizes(run.Path); errors.Is(err, errSizeCheckCancelled) {
+			fmt.Fprintf(logFile, "Size check cancelled\n")
+			status = StatusFailed
+			summary = "cancelled during the size check"
+		} else if err != nil {
+			fmt.Fprintf(logFile, "Size check failed: %v\n", err)
+			log.Warn().Err(err).Str("run", run.ID).Msg("verify_sizes: could not measure source and destination")
+		} else {
+			fmt.Fprintf(logFile, "Size check: source %d bytes, %d bytes in sync at the destination\n", source, dest)
+			mismatch := sizesDiffer(source, dest)
+			ex.mu.Lock()
+			run.SourceSize, run.DestSize = source, dest
+			run.SizeMismatch = mismatch
+			ex.mu.Unlock()
+			if mismatch {
+				summary += fmt.Sprintf("; source is %s but only %s is in sync at the destination", formatBytes(source), formatBytes(dest))
+				log.Warn().Str("run", run.ID).Int64("source_bytes", source).Int64("dest_bytes", dest).
+					Msg("verify_sizes: source and destination sizes differ")
+			}
+		}
+	}
+
+	var stats *TransferStats
+	if tail, err := ex.ReadLogTail(run.LogFile, statsTailBytes); err == nil {
+		// In the single log, earlier runs' stats may be in the tail too
+		if i := strings.LastIndex(tail, runDelimiter(run.ID)); i >= 0 {
+			tail = tail[i:]
+		}
+		stats = parseRsyncStats(tail)
+	}
+
+	ex.finishRun(run, status, exitCode, summary, stats)
+	ex.compressOldLogs()
 	ex.pruneOldLogs()
 }
 
+// remoteDir returns RemotePath with exactly one trailing slash, as used in
+// the rsync destination operand. Windows paths are given forward slashes,
+// which both Windows and rsync on Windows (cwRsync/cygwin) accept.
+func (ex *BackupExecutor) remoteDir() string {
+	path := ex.cfg.RemotePath
+	if ex.cfg.RemoteIsWindows() {
+		path = strings.ReplaceAll(path, "\\", "/")
+	}
+	return strings.TrimRight(path, "/") + "/"
+}
+
+// Shutdown behaviours for a backup that is running when the server stops.
+const (
+	ShutdownWait   = "wait"   // wait up to the grace period, then cancel
+	ShutdownCancel = "cancel" // stop rsync right away
+	ShutdownDetach = "detach" // leave rsync running on its own
+)
+
+// Cancel asks the running rsync to stop with SIGTERM; rsync exits cleanly
+// and --partial keeps what was transferred. A run whose rsync has not
+// started yet never starts it. It reports whether a backup was running.
+func (ex *BackupExecutor) Cancel() bool {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.current == nil {
+		return false
+	}
+	ex.cancelled = true
+	if ex.proc != nil {
+		if err := ex.proc.Signal(syscall.SIGTERM); err != nil {
+			log.Warn().Err(err).Msg("failed to signal rsync")
+		}
+	}
+	return true
+}
+
+// Wait blocks until no backup is running, or ctx is done. It reports
+// whether the executor went idle.
+func (ex *BackupExecutor) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		ex.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cancelWait bounds how long Shutdown waits for rsync to exit after Cancel.
+const cancelWait = 30 * time.Second
+
+// Shutdown deals with a backup still running when the server stops,
+// according to behavior: wait up to grace for it to finish and cancel it
+// after that, cancel it right away, or detach and leave rsync running.
+func (ex *BackupExecutor) Shutdown(behavior string, grace time.Duration) {
+	cur := ex.Current()
+	if cur == nil {
+		return
+	}
+	logger := log.With().Str("run", cur.ID).Str("shutdown_behavior", behavior).Logger()
+
+	switch behavior {
+	case ShutdownDetach:
+		logger.Warn().Msg("leaving the running backup to finish on its own; it will not be recorded in history")
+		return
+	case ShutdownWait, "":
+		logger.Info().Dur("grace_period", grace).Msg("waiting for the running backup to finish")
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		finished := ex.Wait(ctx)
+		cancel()
+		if finished {
+			logger.Info().Msg("backup finished before shutdown")
+			return
+		}
+		logger.Warn().Msg("backup still running after the grace period, cancelling it")
+	default:
+		logger.Info().Msg("cancelling the running backup")
+	}
+
+	ex.Cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), cancelWait)
+	defer cancel()
+	if !ex.Wait(ctx) {
+		logger.Error().Msg("rsync did not exit after being cancelled")
+	}
+}
+
+// markOverrunning flags the running backup as having exceeded
+// max_run_duration. It is advisory: the run continues, but the scheduler
+// skips triggers while it is set.
+func (ex *BackupExecutor) markOverrunning(run *BackupRun) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.current != run {
+		return
+	}
+	run.Overrunning = true
+	log.Warn().Str("run", run.ID).Dur("max_run_duration", ex.cfg.MaxRunDuration).
+		Msg("backup is running longer than max_run_duration; scheduled runs will be skipped until it finishes")
+}
+
+// RecordSkip notes that a scheduled trigger did not start a backup. It is
+// cleared when the next backup starts.
+func (ex *BackupExecutor) RecordSkip(reason string) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.lastSkip = &ScheduleSkip{Time: ex.clock.Now(), Reason: reason}
+}
+
+// LastSkip returns the most recent skipped scheduled trigger since the last
+// backup started, or nil.
+func (ex *BackupExecutor) LastSkip() *ScheduleSkip {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.lastSkip == nil {
+		return nil
+	}
+	cp := *ex.lastSkip
+	return &cp
+}
+
 func (ex *BackupExecutor) buildRsyncArgs() []string {
+	return ex.rsyncArgs(ex.cfg.Verbose, nil)
+}
+
+// rsyncArgs builds the rsync arguments for a backup. verbose passes -vvv
+// instead of -v, which lists every file considered and why it was skipped
+// or transferred, at the cost of much larger logs. A non-nil bwlimit
+// replaces the configured bandwidth limit, 0 dropping --bwlimit altogether.
+func (ex *BackupExecutor) rsyncArgs(verbose bool, bwlimit *Bandwidth) []string {
+	v := "v"
+	if verbose {
+		v = "vvv"
+	}
 	args := []string{
-		"-avz",
+		"-" + ex.cfg.ArchiveFlags() + v + "z",
 		"--delete",
 		"--partial",
 		"--stats",
-		"-e", fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null", ex.cfg.SSHKeyPath),
+	}
+	if ex.cfg.NumericIDs {
+		args = append(args, "--numeric-ids")
+	}
+	if ex.cfg.InPlace {
+		// --partial stays: --inplace already leaves an interrupted file in
+		// place, so it is redundant rather than conflicting
+		args = append(args, "--inplace")
+	}
+	if ex.cfg.ChmodRules != "" {
+		args = append(args, "--chmod="+ex.cfg.ChmodRules)
+	}
+	if ex.progress2Supported() {
+		args = append(args, "--info=progress2")
+	}
+
+	if !ex.cfg.LocalDestination() {
+		sshCmd := "ssh " + strings.Join(ex.sshOptions(ex.cfg.HostKeyOptions()), " ")
+		args = append(args, "-e", sshCmd)
+		if ex.cfg.RsyncPath != "" {
+			args = append(args, "--rsync-path="+ex.cfg.RsyncPath)
+		}
+	}
+
+	if ex.compressing() {
+		if suffixes := ex.cfg.SkipCompressSuffixes(); len(suffixes) > 0 {
+			args = append(args, "--skip-compress="+strings.Join(suffixes, "/"))
+		}
+	}
+
+	bw := ex.bandwidthLimit(ex.clock.Now())
+	if bwlimit != nil {
+		bw = int(*bwlimit)
+	}
+	if bw > 0 {
+		args = append(args, fmt.Sprintf("--bwlimit=%d", bw))
+	}
+
+	if ex.cfg.FilterFile != "" {
+		args = append(args, "--filter=merge "+ex.cfg.FilterFile)
 	}
 
-	if ex.cfg.BandwidthLimit > 0 {
-		args = append(args, fmt.Sprintf("--bwlimit=%d", ex.cfg.BandwidthLimit))
+	// User-supplied flags are passed verbatim, after the built-in flags so they can override them
+	args = append(args, ex.cfg.ExtraArgs...)
+
+	dest := ex.remoteDir()
+	if !ex.cfg.LocalDestination() {
+		dest = fmt.Sprintf("%s:%s", ex.cfg.RsyncHost(), dest)
 	}
 
-	var source string
+	args = append(args, ex.sourceOperands()...)
+	args = append(args, dest)
+	return args
+}
+
+// subpathArgs narrows backup arguments to sub, a directory relative to
+// source_path. With --relative, rsync recreates the part of the source after
+// "/./" under the destination, so only the source operand changes and
+// --delete stays within <dest>/<sub>.
+func (ex *BackupExecutor) subpathArgs(args []string, sub string) []string {
+	args = append([]string{args[0], "--relative"}, args[1:]...)
+	args[len(args)-2] = strings.TrimRight(ex.cfg.SourcePath, "/") + "/./" + sub + "/"
+	return args
+}
+
+// sourceOperands returns rsync's source arguments. A single source_path
+// directory gets a trailing slash so its contents are synced, not the
+// directory itself. source_paths entries are passed as written, following
+// rsync's own rule: "/etc" lands as <dest>/etc, while "/etc/" merges its
+// contents into the destination root.
+func (ex *BackupExecutor) sourceOperands() []string {
+	if len(ex.cfg.SourcePaths) > 0 {
+		return ex.cfg.SourcePaths
+	}
 	if ex.cfg.SourceIsFile {
 		// Single file: use path as-is, no trailing slash
-		source = ex.cfg.SourcePath
-	} else {
-		// Directory: trailing slash ensures contents are synced, not the directory itself
-		source = strings.TrimRight(ex.cfg.SourcePath, "/") + "/"
+		return []string{ex.cfg.SourcePath}
 	}
-	dest := fmt.Sprintf("%s:%s/", ex.cfg.RemoteHost, strings.TrimRight(ex.cfg.RemotePath, "/"))
+	// Directory: trailing slash ensures contents are synced, not the directory itself
+	return []string{strings.TrimRight(ex.cfg.SourcePath, "/") + "/"}
+}
 
-	args = append(args, source, dest)
-	return args
+// bandwidthLimit returns the --bwlimit value in KB/s for a run starting at
+// t: a matching bandwidth_schedule window, else bandwidth_percent of
+// link_speed, else bandwidth_limit.
+func (ex *BackupExecutor) bandwidthLimit(t time.Time) int {
+	if limit, ok := ex.cfg.scheduledBandwidthAt(t); ok {
+		return limit
+	}
+	if pct := ex.cfg.BandwidthPercent; pct > 0 && ex.cfg.LinkSpeed > 0 {
+		return max(1, int(ex.cfg.LinkSpeed)*pct/100)
+	}
+	return int(ex.cfg.BandwidthLimit)
+}
+
+// compressing reports whether rsync compresses the transfer: -z is always
+// passed, but rsync ignores it for local copies and extra_args can turn it
+// off.
+func (ex *BackupExecutor) compressing() bool {
+	if ex.cfg.LocalDestination() {
+		return false
+	}
+	for _, arg := range ex.cfg.ExtraArgs {
+		if arg == "--no-compress" || arg == "--no-z" {
+			return false
+		}
+	}
+	return true
+}
+
+// startErrorSummary describes an error that prevented rsync from starting.
+func startErrorSummary(err error) string {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return "rsync binary not found"
+	}
+	return fmt.Sprintf("failed to start rsync: %v", err)
+}
+
+// rsyncVersionLine matches the version in the first line of
+// `rsync --version`, e.g. "rsync  version 3.2.7  protocol version 31".
+var rsyncVersionLine = regexp.MustCompile(`rsync\s+version\s+v?(\d+\.\d+(?:\.\d+)?)`)
+
+// parseRsyncVersion extracts the version number from `rsync --version`
+// output.
+func parseRsyncVersion(output string) (string, bool) {
+	m := rsyncVersionLine.FindStringSubmatch(output)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// DetectRsyncVersion runs `rsync --version` and records the version for
+// RsyncVersion. It returns an error if rsync is missing or its output is not
+// recognised.
+func (ex *BackupExecutor) DetectRsyncVersion() (string, error) {
+	out, err := ex.cmdFactory("rsync", "--version").Output()
+	if err != nil {
+		return "", errors.New(startErrorSummary(err))
+	}
+	version, ok := parseRsyncVersion(string(out))
+	if !ok {
+		return "", fmt.Errorf("unrecognised rsync --version output")
+	}
+
+	ex.mu.Lock()
+	ex.rsyncVersion = version
+	ex.mu.Unlock()
+	return version, nil
+}
+
+// RsyncVersion returns the detected rsync version, or "" if it is unknown.
+func (ex *BackupExecutor) RsyncVersion() string {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return ex.rsyncVersion
+}
+
+// minProgress2Version is the first rsync release with --info=progress2.
+const minProgress2Version = "3.1.0"
+
+// progress2Supported reports whether the local rsync understands
+// --info=progress2. An undetected version is assumed to be recent, as rsync
+// is then most likely missing and the run fails regardless. Older releases
+// only have per-file --progress, which would make the overall percentage and
+// ETA meaningless, so no progress flag is passed to them at all.
+func (ex *BackupExecutor) progress2Supported() bool {
+	v := ex.RsyncVersion()
+	return v == "" || versionAtLeast(v, minProgress2Version)
+}
+
+// versionAtLeast reports whether the dotted version v is at least min
+// (e.g. "3.1.0"). Missing components count as 0; an empty or malformed v
+// is never at least anything.
+func versionAtLeast(v, min string) bool {
+	if v == "" {
+		return false
+	}
+	have, want := strings.Split(v, "."), strings.Split(min, ".")
+	for i := range want {
+		var h int
+		if i < len(have) {
+			n, err := strconv.Atoi(have[i])
+			if err != nil {
+				return false
+			}
+			h = n
+		}
+		w, _ := strconv.Atoi(want[i])
+		if h != w {
+			return h > w
+		}
+	}
+	return true
 }
 
 // rsyncExitSummary returns a human-readable summary for an rsync exit code.
@@ -234,28 +905,44 @@ func isPartialTransfer(exitCode int) bool {
 	return exitCode == 23 || exitCode == 24
 }
 
-func (ex *BackupExecutor) finishRun(run *BackupRun, exitCode int, summary string) {
+// slowRunFactor is how many times expected_duration a run may take before
+// it is flagged as slow.
+const slowRunFactor = 2
+
+// finishRun records a run's outcome. status is what the exit code maps to
+// under the exit code settings, or StatusFailed when rsync never ran.
+func (ex *BackupExecutor) finishRun(run *BackupRun, status BackupStatus, exitCode int, summary string, stats *TransferStats) {
 	ex.mu.Lock()
 	defer ex.mu.Unlock()
 
-	run.EndTime = time.Now()
-	run.Duration = run.EndTime.Sub(run.StartTime).Truncate(time.Second).String()
+	run.EndTime = ex.clock.Now()
+	elapsed := run.EndTime.Sub(run.StartTime)
+	run.Duration = elapsed.Truncate(time.Second).String()
+	if expected := ex.cfg.ExpectedDuration; expected > 0 && elapsed > slowRunFactor*expected {
+		run.SlowWarning = true
+		log.Warn().Str("run", run.ID).Dur("duration", elapsed).Dur("expected_duration", expected).
+			Msgf("backup took more than %dx expected_duration", slowRunFactor)
+	}
 	run.ExitCode = exitCode
 	run.Summary = summary
+	run.Stats = stats
+	run.Progress = nil // only meaningful while running
 
-	switch {
-	case exitCode == 0:
-		run.Status = StatusSuccess
-		ex.status = StatusSuccess
-	case isPartialTransfer(exitCode):
+	run.Status = status
+	if run.SizeMismatch && run.Status == StatusSuccess {
 		run.Status = StatusWarning
-		ex.status = StatusWarning
-	default:
-		run.Status = StatusFailed
-		ex.status = StatusFailed
+	}
+	ex.status = run.Status
+
+	if ex.logNames.hasStatus() {
+		ex.renameLog(run)
 	}
 
 	ex.current = nil
+	ex.running = false
+	// The destination has changed, and with history the first-run warning
+	// no longer applies.
+	ex.remoteCheck.invalidate()
 
 	// Prepend to history (newest first)
 	ex.history = append([]BackupRun{*run}, ex.history...)
@@ -264,6 +951,30 @@ func (ex *BackupExecutor) finishRun(run *BackupRun, exitCode int, summary string
 	}
 
 	ex.saveHistory()
+
+	ex.totals.add(*run)
+	if err := ex.saveTotals(); err != nil {
+		log.Error().Err(err).Msg("failed to write stats")
+	}
+
+	ex.notify(*run)
+}
+
+// renameLog renames a finished run's log so its name carries the final
+// status instead of "running". On failure the run keeps the old name.
+func (ex *BackupExecutor) renameLog(run *BackupRun) {
+	name := ex.logNames.render(run.StartTime, run.ID, run.Status)
+	if name == run.LogFile {
+		return
+	}
+	err := os.Rename(filepath.Join(ex.cfg.LogDir, run.LogFile), filepath.Join(ex.cfg.LogDir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error().Err(err).Str("file", run.LogFile).Msg("failed to rename log")
+		}
+		return
+	}
+	run.LogFile = name
 }
 
 func (ex *BackupExecutor) historyPath() string {
@@ -271,76 +982,316 @@ func (ex *BackupExecutor) historyPath() string {
 }
 
 func (ex *BackupExecutor) loadHistory() {
-	data, err := os.ReadFile(ex.historyPath())
-	if err != nil {
-		return // no history yet
-	}
 	var runs []BackupRun
-	if err := json.Unmarshal(data, &runs); err != nil {
-		log.Error().Err(err).Msg("failed to parse history")
+	if err := readJSONFile(ex.historyPath(), &runs); err != nil {
+		if os.IsNotExist(err) {
+			return // no history yet
+		}
+		// Set the file aside rather than overwrite it on the next save
+		moved, renameErr := quarantineFile(ex.historyPath(), ex.clock.Now())
+		if renameErr != nil {
+			log.Error().Err(err).AnErr("rename_error", renameErr).Msg("failed to parse history, starting with empty history")
+			return
+		}
+		log.Error().Err(err).Str("moved_to", moved).Msg("failed to parse history, starting with empty history; the unreadable file was kept")
 		return
 	}
 	ex.history = runs
 
+	// Nothing is running yet, so a run still marked running was cut short
+	// by the process dying
+	interrupted := false
+	for i := range ex.history {
+		if ex.history[i].Status == StatusRunning {
+			ex.history[i].Status = StatusFailed
+			ex.history[i].Summary = interruptedSummary
+			interrupted = true
+			log.Warn().Str("run", ex.history[i].ID).Msg("marking backup as interrupted: it was running when the server stopped")
+		}
+	}
+	if interrupted {
+		ex.saveHistory()
+	}
+
 	// Set initial status from last run
 	if len(ex.history) > 0 {
 		ex.status = ex.history[0].Status
 	}
 }
 
+// interruptedSummary is the summary of a run found still marked running in
+// history.json at startup.
+const interruptedSummary = "interrupted: the server stopped while this backup was running"
+
 func (ex *BackupExecutor) saveHistory() {
 	data, err := json.MarshalIndent(ex.history, "", "  ")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to marshal history")
 		return
 	}
-	if err := os.WriteFile(ex.historyPath(), data, 0644); err != nil {
+	if err := writeFileAtomic(ex.historyPath(), data, 0644); err != nil {
 		log.Error().Err(err).Msg("failed to write history")
 	}
 }
 
-func (ex *BackupExecutor) pruneOldLogs() {
+// isLogFile reports whether name is a backup log, plain or gzip-compressed.
+// With single_log_file that is rsync.log and its rotated copies, and also
+// per-run logs written before it was turned on, which history may still
+// point to.
+func (ex *BackupExecutor) isLogFile(name string) bool {
+	if _, ok := rotatedLogIndex(name); ok && ex.cfg.SingleLogFile {
+		return true
+	}
+	return ex.logNames.matches(name)
+}
+
+// compressOldLogs gzips every plain backup log except the most recent one,
+// replacing e.g. backup-<id>.log with backup-<id>.log.gz.
+func (ex *BackupExecutor) compressOldLogs() {
+	if ex.cfg.SingleLogFile {
+		return // rotation bounds the single log instead
+	}
 	entries, err := os.ReadDir(ex.cfg.LogDir)
 	if err != nil {
 		return
 	}
 
-	var logFiles []os.DirEntry
+	var plain []string
 	for _, e := range entries {
-		if !e.IsDir() && strings.HasPrefix(e.Name(), "backup-") && strings.HasSuffix(e.Name(), ".log") {
-			logFiles = append(logFiles, e)
+		if !e.IsDir() && ex.isLogFile(e.Name()) && !strings.HasSuffix(e.Name(), ".gz") {
+			plain = append(plain, e.Name())
 		}
 	}
-
-	if len(logFiles) <= ex.cfg.MaxLogFiles {
+	if len(plain) <= 1 {
 		return
 	}
 
-	// Sort by name (which includes timestamp) ascending
-	sort.Slice(logFiles, func(i, j int) bool {
-		return logFiles[i].Name() < logFiles[j].Name()
+	ex.sortLogsByAge(plain)
+	for _, name := range plain[:len(plain)-1] {
+		if err := compressFile(filepath.Join(ex.cfg.LogDir, name)); err != nil {
+			log.Error().Err(err).Str("file", name).Msg("failed to compress log")
+		}
+	}
+}
+
+// compressFile writes a gzip copy of path to path+".gz" and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Keep the original modtime so age-based pruning still sees the run's age
+	if info, err := src.Stat(); err == nil {
+		os.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+	}
+
+	if err := os.Rename(tmpPath, path+".gz"); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// LogUsage summarises disk usage of the log directory.
+type LogUsage struct {
+	TotalBytes  int64 `json:"total_bytes"`
+	LogFiles    int   `json:"log_files"`
+	LogBytes    int64 `json:"log_bytes"`
+	MaxLogFiles int   `json:"max_log_files"`
+}
+
+// LogUsage walks the log directory and returns the total size of everything
+// in it, plus the number and size of backup logs. A missing log dir is
+// reported as empty.
+func (ex *BackupExecutor) LogUsage() (LogUsage, error) {
+	usage := LogUsage{MaxLogFiles: ex.cfg.MaxLogFiles}
+	err := filepath.WalkDir(ex.cfg.LogDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == ex.cfg.LogDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // pruned while walking
+			}
+			return err
+		}
+		usage.TotalBytes += info.Size()
+		if ex.isLogFile(d.Name()) {
+			usage.LogFiles++
+			usage.LogBytes += info.Size()
+		}
+		return nil
 	})
+	return usage, err
+}
+
+// LogFile is one backup log on disk, as listed by ListLogs.
+type LogFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Orphan marks a log no run in history refers to, e.g. one left behind
+	// after its run was dropped from history.
+	Orphan bool `json:"orphan"`
+}
+
+// ListLogs returns the backup logs in the log directory, sorted by name,
+// plain and compressed alike. A missing log dir is reported as empty.
+func (ex *BackupExecutor) ListLogs() ([]LogFile, error) {
+	entries, err := os.ReadDir(ex.cfg.LogDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, run := range ex.History() {
+		referenced[run.LogFile] = true
+	}
+	// The running backup is not in history yet but is writing its log
+	if cur := ex.Current(); cur != nil {
+		referenced[cur.LogFile] = true
+	}
+
+	logs := []LogFile{}
+	for _, e := range entries {
+		if e.IsDir() || !ex.isLogFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // pruned while listing
+		}
+		// Runs keep referring to the plain name after compressOldLogs, and
+		// with single_log_file every run shares the one log
+		_, single := rotatedLogIndex(e.Name())
+		orphan := !referenced[strings.TrimSuffix(e.Name(), ".gz")] && !(single && ex.cfg.SingleLogFile)
+		logs = append(logs, LogFile{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime(), Orphan: orphan})
+	}
+	return logs, nil
+}
+
+// pruneOldLogs deletes backup logs beyond the newest MaxLogFiles, and any log
+// whose modtime is older than MaxLogAge when that is set. With
+// single_log_file, per-run logs left from before it was turned on are pruned
+// the same way alongside the rotated single log.
+func (ex *BackupExecutor) pruneOldLogs() {
+	if ex.cfg.SingleLogFile {
+		ex.pruneSingleLog()
+	}
+	entries, err := os.ReadDir(ex.cfg.LogDir)
+	if err != nil {
+		return
+	}
+
+	var logFiles []string
+	for _, e := range entries {
+		if !e.IsDir() && ex.logNames.matches(e.Name()) {
+			logFiles = append(logFiles, e.Name())
+		}
+	}
+	ex.sortLogsByAge(logFiles)
+
+	overCount := len(logFiles) - ex.cfg.MaxLogFiles
+	cutoff := ex.clock.Now().Add(-ex.cfg.MaxLogAge)
+	for i, name := range logFiles {
+		path := filepath.Join(ex.cfg.LogDir, name)
+		remove := i < overCount
+		if !remove && ex.cfg.MaxLogAge > 0 {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(path)
+		}
+	}
+}
 
-	toRemove := logFiles[:len(logFiles)-ex.cfg.MaxLogFiles]
-	for _, f := range toRemove {
-		os.Remove(filepath.Join(ex.cfg.LogDir, f.Name()))
+// sortLogsByAge orders log filenames oldest first, by the start time of the
+// run that wrote each or, for a log no longer in history, its modification
+// time. Name order is not time order under every log_name_template, e.g.
+// one that puts {status} first.
+func (ex *BackupExecutor) sortLogsByAge(names []string) {
+	started := make(map[string]time.Time)
+	for _, run := range ex.History() {
+		started[run.LogFile] = run.StartTime
 	}
+	age := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		if t, ok := started[strings.TrimSuffix(name, ".gz")]; ok {
+			age[name] = t
+		} else if info, err := os.Stat(filepath.Join(ex.cfg.LogDir, name)); err == nil {
+			age[name] = info.ModTime()
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if a, b := age[names[i]], age[names[j]]; !a.Equal(b) {
+			return a.Before(b)
+		}
+		return names[i] < names[j]
+	})
 }
 
 // CheckRemotePath runs an SSH command to check whether the remote backup
-// destination already contains files. Returns true if non-empty.
+// destination already contains files. Returns true if non-empty. SSH
+// results are shared through remoteCheck, so concurrent and repeated calls
+// do not each open a connection.
 func (ex *BackupExecutor) CheckRemotePath() (nonEmpty bool, files []string, err error) {
-	remotePath := strings.TrimRight(ex.cfg.RemotePath, "/")
-	// Parse user@host from RemoteHost
-	sshArgs := []string{
-		"-i", ex.cfg.SSHKeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		ex.cfg.RemoteHost,
-		fmt.Sprintf("ls -A '%s/' 2>/dev/null | head -5", remotePath),
+	settings := ex.cfg.GetTransferSettings()
+	if err := ex.cfg.checkTransferSettings(settings); err != nil {
+		return false, nil, err
 	}
+	if ex.cfg.LocalDestination() {
+		return checkLocalPath(ex.cfg.RemotePath)
+	}
+
+	res := ex.remoteCheck.do(settings, ex.clock.Now, func() remoteCheckResult {
+		nonEmpty, files, err := ex.checkRemoteSSH()
+		return remoteCheckResult{nonEmpty, files, err}
+	})
+	return res.nonEmpty, res.files, res.err
+}
 
+// checkRemoteSSH lists the remote destination over SSH for CheckRemotePath.
+func (ex *BackupExecutor) checkRemoteSSH() (nonEmpty bool, files []string, err error) {
+	remotePath := strings.TrimRight(ex.remoteDir(), "/")
+	listCmd := remoteListCommand(remotePath)
+	if ex.cfg.RemoteIsWindows() {
+		listCmd = windowsListCommand(remotePath)
+	}
+	host, _ := ex.cfg.SSHHostPort()
+	sshArgs := append(ex.sshOptions(ex.cfg.RemoteCheckHostKeyOptions()), host, listCmd)
 	cmd := ex.cmdFactory("ssh", sshArgs...)
 	out, err := cmd.Output()
 	if err != nil {
@@ -353,18 +1304,513 @@ func (ex *BackupExecutor) CheckRemotePath() (nonEmpty bool, files []string, err
 	}
 
 	lines := strings.Split(output, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r") // Windows line endings
+	}
+	if len(lines) > 5 {
+		lines = lines[:5] // dir has no head -5
+	}
 	return true, lines, nil
 }
 
-// ReadLog returns the content of a log file by its filename.
+// sshOptions returns the ssh options for connecting to the saved remote
+// host, with hostKeys deciding how its key is checked: identities, host key
+// checking, connect timeout, port and jump host. Backups pass them in
+// rsync's -e command and the remote check on the ssh command line, so every
+// connection is made the same way.
+func (ex *BackupExecutor) sshOptions(hostKeys []string) []string {
+	_, port := ex.cfg.SSHHostPort()
+	opts := append(identityArgs(ex.cfg.SSHKeyPaths()), hostKeys...)
+	opts = append(opts, "-o", "ConnectTimeout="+strconv.Itoa(ex.cfg.ConnectTimeout()))
+	if port != "" {
+		opts = append(opts, "-p", port)
+	}
+	if ex.cfg.SSHProxyJump != "" {
+		opts = append(opts, "-J", ex.cfg.SSHProxyJump)
+	}
+	return opts
+}
+
+// LocalFreeSpace returns the free bytes on the filesystem of a local
+// destination. The destination need not exist yet: its nearest existing
+// parent is measured instead.
+func (ex *BackupExecutor) LocalFreeSpace() (uint64, error) {
+	if !ex.cfg.LocalDestination() || ex.cfg.RemotePath == "" {
+		return 0, fmt.Errorf("destination is not local")
+	}
+	dir := filepath.Clean(ex.cfg.RemotePath)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ex.diskFree(dir)
+}
+
+// checkLocalFreeSpace refuses a backup to a local destination with less
+// than require_local_free_space available. The check is skipped when the
+// free space cannot be determined.
+func (ex *BackupExecutor) checkLocalFreeSpace() error {
+	need := ex.cfg.RequireLocalFreeSpace
+	if need <= 0 || !ex.cfg.LocalDestination() {
+		return nil
+	}
+	free, err := ex.LocalFreeSpace()
+	if err != nil {
+		log.Warn().Err(err).Str("path", ex.cfg.RemotePath).Msg("could not check free space on the destination")
+		return nil
+	}
+	if int64(free) < int64(need) {
+		return fmt.Errorf("not enough free space on %s: %s available, require_local_free_space is %s",
+			ex.cfg.RemotePath, formatBytes(int64(free)), formatBytes(int64(need)))
+	}
+	return nil
+}
+
+// checkFilterFile refuses a backup whose filter_file cannot be read. rsync
+// would fail on it too, but only after connecting and with a less obvious
+// message; the file is checked per run since it may be edited at any time.
+func (ex *BackupExecutor) checkFilterFile() error {
+	if ex.cfg.FilterFile == "" {
+		return nil
+	}
+	f, err := os.Open(ex.cfg.FilterFile)
+	if err != nil {
+		return fmt.Errorf("filter_file %s cannot be read: %w", ex.cfg.FilterFile, err)
+	}
+	f.Close()
+	return nil
+}
+
+// checkLocalPath is CheckRemotePath for a local destination. A directory
+// that does not exist yet counts as empty, since rsync creates it.
+func checkLocalPath(dir string) (nonEmpty bool, files []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("local check failed: %w", err)
+	}
+	for _, e := range entries {
+		if len(files) == 5 {
+			break
+		}
+		files = append(files, e.Name())
+	}
+	return len(files) > 0, files, nil
+}
+
+// ConnectionError is returned by TestConnection when ssh could not log in.
+type ConnectionError struct {
+	// Reason is "auth", "unreachable", "timeout", "host_key" or "unknown".
+	Reason string
+	// Output is what ssh wrote to stderr.
+	Output string
+	Err    error
+}
+
+func (e *ConnectionError) Error() string {
+	switch e.Reason {
+	case "auth":
+		return "authentication failed — check that the SSH key is authorized on the remote host"
+	case "unreachable":
+		return "remote host unreachable"
+	case "timeout":
+		return "connection timed out"
+	case "host_key":
+		return "host key verification failed — if the remote host was rebuilt, trust its new key with POST /api/remote/trust"
+	default:
+		return fmt.Sprintf("ssh failed: %v", e.Err)
+	}
+}
+
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// classifySSHError maps ssh's stderr to a ConnectionError reason.
+func classifySSHError(output string) string {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "permission denied"),
+		strings.Contains(lower, "too many authentication failures"),
+		strings.Contains(lower, "no such identity"):
+		return "auth"
+	case strings.Contains(lower, "timed out"):
+		return "timeout"
+	case strings.Contains(lower, "could not resolve hostname"),
+		strings.Contains(lower, "no route to host"),
+		strings.Contains(lower, "connection refused"),
+		strings.Contains(lower, "network is unreachable"):
+		return "unreachable"
+	case strings.Contains(lower, "host key verification failed"),
+		strings.Contains(lower, "remote host identification has changed"):
+		return "host_key"
+	default:
+		return "unknown"
+	}
+}
+
+// TestConnection runs a no-op command ("true") over ssh to check that
+// remoteHost is reachable and accepts keyPath (a comma-separated list, or
+// empty to use the ssh agent), independently of the saved settings and of
+// whether the destination has files.
+func (ex *BackupExecutor) TestConnection(remoteHost, keyPath string) error {
+	if err := validateRemoteHost(remoteHost); err != nil {
+		return err
+	}
+
+	host, port := splitHostPort(remoteHost)
+	sshArgs := append(identityArgs(splitKeyPaths(keyPath)), "-o", "BatchMode=yes")
+	sshArgs = append(sshArgs, ex.cfg.HostKeyOptions()...)
+	sshArgs = append(sshArgs, "-o", "ConnectTimeout="+strconv.Itoa(ex.cfg.ConnectTimeout()))
+	if port != "" {
+		sshArgs = append(sshArgs, "-p", port)
+	}
+	if ex.cfg.SSHProxyJump != "" {
+		sshArgs = append(sshArgs, "-J", ex.cfg.SSHProxyJump)
+	}
+	sshArgs = append(sshArgs, host, "true")
+
+	cmd := ex.cmdFactory("ssh", sshArgs...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		return &ConnectionError{Reason: classifySSHError(output), Output: output, Err: err}
+	}
+	return nil
+}
+
+// SizeEstimate is what a backup would transfer, from an rsync dry run.
+type SizeEstimate struct {
+	NumFiles        int64 `json:"num_files"`
+	TotalSize       int64 `json:"total_size"`
+	FilesToTransfer int64 `json:"files_to_transfer"`
+	BytesToTransfer int64 `json:"bytes_to_transfer"`
+}
+
+// Estimate runs rsync with --dry-run --stats using the normal backup
+// arguments and reports the source size and how much would be transferred.
+// Nothing is copied and no history is written. It cannot overlap a backup.
+func (ex *BackupExecutor) Estimate() (*SizeEstimate, error) {
+	out, err := ex.dryRun()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := parseRsyncStats(out)
+	if stats == nil {
+		return nil, fmt.Errorf("rsync dry run printed no stats")
+	}
+	return &SizeEstimate{
+		NumFiles:        stats.NumFiles,
+		TotalSize:       stats.TotalSize,
+		FilesToTransfer: stats.FilesTransferred,
+		BytesToTransfer: stats.TransferredSize,
+	}, nil
+}
+
+// dryRun runs rsync with --dry-run and any extra flags added to the normal
+// backup arguments, and returns its output. It holds the run slot, so it
+// cannot overlap a backup or another dry run.
+func (ex *BackupExecutor) dryRun(extra ...string) (string, error) {
+	if !ex.cfg.TransferConfigured() {
+		return "", fmt.Errorf("transfer settings not configured")
+	}
+	ex.mu.Lock()
+	if ex.running || ex.estimating {
+		ex.mu.Unlock()
+		return "", fmt.Errorf("backup already in progress")
+	}
+	ex.estimating = true
+	ex.mu.Unlock()
+	defer func() {
+		ex.mu.Lock()
+		ex.estimating = false
+		ex.mu.Unlock()
+	}()
+
+	args := ex.buildRsyncArgs()
+	flags := append([]string{args[0], "--dry-run"}, extra...)
+	args = append(flags, args[1:]...)
+	out, err := ex.cmdFactory("rsync", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", errors.New(startErrorSummary(err))
+		}
+		if ex.cfg.ExitStatus(exitErr.ExitCode()) == StatusFailed {
+			return "", fmt.Errorf("rsync dry run failed: %s", rsyncExitSummary(exitErr.ExitCode()))
+		}
+	}
+	return string(out), nil
+}
+
+// remoteListCommand returns the shell command CheckRemotePath runs on the
+// remote host to list up to five entries of dir.
+func remoteListCommand(dir string) string {
+	return fmt.Sprintf("ls -A -- %s 2>/dev/null | head -5", shellQuote(dir+"/"))
+}
+
+// windowsListCommand is remoteListCommand for a Windows OpenSSH server,
+// whose default shell is cmd.exe. dir reports an empty directory as an
+// error, so the exit status is forced to 0 and emptiness is judged from the
+// output alone. RemotePath validation already rules out '"' and '&'.
+func windowsListCommand(dir string) string {
+	if strings.HasSuffix(dir, ":") {
+		dir += "/" // "C:" alone means the current directory on drive C
+	}
+	return fmt.Sprintf(`dir /b /a "%s" 2>nul & exit 0`, strings.ReplaceAll(dir, "/", "\\"))
+}
+
+// shellQuote quotes s for a POSIX shell. Embedded single quotes are closed,
+// escaped and reopened, so the result is always a single literal word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// WriteLogArchive streams a zip archive of every backup log in the log dir
+// plus history.json to w. Files that cannot be opened are skipped.
+func (ex *BackupExecutor) WriteLogArchive(w io.Writer) error {
+	entries, err := os.ReadDir(ex.cfg.LogDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	names := []string{"history.json"}
+	for _, e := range entries {
+		if !e.IsDir() && ex.isLogFile(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		if err := addFileToZip(zw, filepath.Join(ex.cfg.LogDir, name), name); err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				log.Warn().Err(err).Str("file", name).Msg("skipping file in log archive")
+				continue
+			}
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addFileToZip copies the file at path into zw under name. Open errors are
+// returned before anything is written, so the caller can skip the file.
+func addFileToZip(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// errInvalidLogName is returned for log filenames that do not name a backup
+// log inside the log dir.
+var errInvalidLogName = errors.New("invalid log filename")
+
+// logPath validates a log filename and returns its full path in the log dir.
+// The name must follow the backup-*.log / backup-*.log.gz naming, and the
+// resolved path, including any symlink target, must stay inside the log dir.
+func (ex *BackupExecutor) logPath(filename string) (string, error) {
+	if !ex.isLogFile(filename) || strings.ContainsRune(filename, '\\') {
+		return "", errInvalidLogName
+	}
+	dir, err := filepath.Abs(ex.cfg.LogDir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filename)
+	if filepath.Dir(path) != dir {
+		return "", errInvalidLogName
+	}
+
+	// ReadLog falls back to the compressed copy, so check both
+	for _, p := range []string{path, path + ".gz"} {
+		if err := checkWithinDir(dir, p); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// checkWithinDir returns errInvalidLogName if path exists and resolves, after
+// following symlinks, to a location outside dir. Missing files are accepted
+// so callers can report them as not found.
+func checkWithinDir(dir, path string) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(resolved, realDir+string(filepath.Separator)) {
+		return errInvalidLogName
+	}
+	return nil
+}
+
+// ReadLog returns the content of a log file by its filename. If the plain
+// file is absent but a gzip-compressed copy (filename + ".gz") exists, it is
+// transparently decompressed.
 func (ex *BackupExecutor) ReadLog(filename string) (string, error) {
-	// Sanitize: only allow filenames, not paths
-	if strings.Contains(filename, "/") || strings.Contains(filename, "\\") || strings.Contains(filename, "..") {
-		return "", fmt.Errorf("invalid log filename")
+	path, err := ex.logPath(filename)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return string(data), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	f, gzErr := os.Open(path + ".gz")
+	if gzErr != nil {
+		return "", err // report the original not-found error
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("reading compressed log: %w", err)
+	}
+	defer zr.Close()
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("reading compressed log: %w", err)
+	}
+	return string(data), nil
+}
+
+// ReadLogTail returns at most the last n bytes of a log file. Plain logs are
+// read by seeking from the end; compressed logs have to be decompressed in full.
+func (ex *BackupExecutor) ReadLogTail(filename string, n int64) (string, error) {
+	path, err := ex.logPath(filename)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		content, err := ex.ReadLog(filename)
+		if err != nil {
+			return "", err
+		}
+		if int64(len(content)) > n {
+			content = content[int64(len(content))-n:]
+		}
+		return content, nil
+	}
+	if err != nil {
+		return "", err
 	}
-	data, err := os.ReadFile(filepath.Join(ex.cfg.LogDir, filename))
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(info.Size()-n, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	data, err := io.ReadAll(f)
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
+
+// ReadLogLines returns the last n lines of a log file. Plain logs are read
+// backwards from the end in chunks until enough lines have been seen.
+func (ex *BackupExecutor) ReadLogLines(filename string, n int) (string, error) {
+	path, err := ex.logPath(filename)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		content, err := ex.ReadLog(filename)
+		if err != nil {
+			return "", err
+		}
+		return lastLines(content, n), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	const chunkSize = 64 * 1024
+	var buf []byte
+	offset := info.Size()
+	for offset > 0 {
+		size := int64(chunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		buf = append(chunk, buf...)
+		// One extra newline is needed to find the start of the first wanted line
+		if bytes.Count(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n")) >= n {
+			break
+		}
+	}
+	return lastLines(string(buf), n), nil
+}
+
+// lastLines returns the final n lines of s. A trailing newline does not count
+// as the start of an extra, empty line.
+func lastLines(s string, n int) string {
+	end := len(s)
+	if end > 0 && s[end-1] == '\n' {
+		end--
+	}
+	idx := end
+	for i := 0; i < n; i++ {
+		idx = strings.LastIndexByte(s[:idx], '\n')
+		if idx < 0 {
+			return s
+		}
+	}
+	return s[idx+1:]
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -42,6 +46,9 @@ func TestHelperProcess(t *testing.T) {
 	if output != "" {
 		fmt.Fprint(os.Stdout, output)
 	}
+	if stderr := os.Getenv("GO_TEST_STDERR"); stderr != "" {
+		fmt.Fprint(os.Stderr, stderr)
+	}
 	exitCode := 0
 	fmt.Sscanf(os.Getenv("GO_TEST_EXIT_CODE"), "%d", &exitCode)
 	os.Exit(exitCode)
@@ -74,6 +81,23 @@ func waitForStatus(ex *BackupExecutor, want BackupStatus, timeout time.Duration)
 	return fmt.Errorf("timed out waiting for status %q, current: %q", want, ex.Status())
 }
 
+// waitForLogFile polls until the running backup has created its log file, so a
+// test that returns while rsync is still running does not race the temp-dir
+// cleanup against the executor creating the file.
+func waitForLogFile(t *testing.T, ex *BackupExecutor) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cur := ex.Current(); cur != nil {
+			if _, err := os.Stat(filepath.Join(ex.cfg.LogDir, cur.LogFile)); err == nil {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the running backup's log file")
+}
+
 // ---------------------------------------------------------------------------
 // buildRsyncArgs tests
 // ---------------------------------------------------------------------------
@@ -126,6 +150,513 @@ func TestBuildRsyncArgs_SSHKeyInCommand(t *testing.T) {
 	}
 }
 
+func TestBuildRsyncArgs_SSHKeys(t *testing.T) {
+	sshCmd := func(args []string) string {
+		for i, arg := range args {
+			if arg == "-e" {
+				return args[i+1]
+			}
+		}
+		return ""
+	}
+
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+
+	tests := []struct {
+		keyPath string
+		want    string
+	}{
+		{"", "ssh -o "},
+		{"/keys/id_ed25519", "ssh -i /keys/id_ed25519 -o "},
+		{"/keys/a, /keys/b,", "ssh -i /keys/a -i /keys/b -o "},
+	}
+	for _, tt := range tests {
+		cfg.SSHKeyPath = tt.keyPath
+		if got := sshCmd(ex.buildRsyncArgs()); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("ssh_key_path %q: -e = %q, want prefix %q", tt.keyPath, got, tt.want)
+		}
+	}
+}
+
+func TestBuildRsyncArgs_RemotePort(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = "user@backup-host:2222"
+	ex := NewBackupExecutor(cfg)
+
+	args := ex.buildRsyncArgs()
+
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-p 2222") {
+		t.Errorf("expected ssh port in -e command: %s", joined)
+	}
+	if dest := args[len(args)-1]; dest != "user@backup-host:/backups/plex/" {
+		t.Errorf("dest = %q, want user@backup-host:/backups/plex/", dest)
+	}
+}
+
+func TestBuildRsyncArgs_SkipCompress(t *testing.T) {
+	flag := func(args []string) string {
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--skip-compress=") {
+				return arg
+			}
+		}
+		return ""
+	}
+
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	if got := flag(ex.buildRsyncArgs()); !strings.Contains(got, "/mkv/") || !strings.HasPrefix(got, "--skip-compress=7z/") {
+		t.Errorf("default flag = %q, want the media suffix list", got)
+	}
+
+	cfg.SkipCompress = []string{"mkv", "mp[34]"}
+	if got := flag(ex.buildRsyncArgs()); got != "--skip-compress=mkv/mp[34]" {
+		t.Errorf("flag = %q, want --skip-compress=mkv/mp[34]", got)
+	}
+
+	cfg.SkipCompress = []string{}
+	if got := flag(ex.buildRsyncArgs()); got != "" {
+		t.Errorf("empty skip_compress should omit the flag, got %q", got)
+	}
+
+	// Not compressing: local copies, or -z turned off in extra_args
+	cfg.SkipCompress = nil
+	cfg.ExtraArgs = []string{"--no-compress"}
+	if got := flag(ex.buildRsyncArgs()); got != "" {
+		t.Errorf("flag with --no-compress = %q, want none", got)
+	}
+	cfg.ExtraArgs = nil
+	cfg.RemoteHost = ""
+	if got := flag(ex.buildRsyncArgs()); got != "" {
+		t.Errorf("flag for a local destination = %q, want none", got)
+	}
+}
+
+func TestSSHProxyJump(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SSHProxyJump = "admin@bastion.example.com:2200"
+	ex := NewBackupExecutor(cfg)
+
+	joined := strings.Join(ex.buildRsyncArgs(), " ")
+	if !strings.Contains(joined, "-J admin@bastion.example.com:2200") {
+		t.Errorf("expected -J in the -e ssh command: %s", joined)
+	}
+
+	var sshArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		sshArgs = args
+		return exec.Command("true")
+	}
+	ex.CheckRemotePath()
+	if !strings.Contains(strings.Join(sshArgs, " "), "-J admin@bastion.example.com:2200 user@backup-host") {
+		t.Errorf("remote check ssh args = %v, want -J before the host", sshArgs)
+	}
+}
+
+func TestSSHConnectTimeout(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	var sshArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		sshArgs = args
+		return exec.Command("true")
+	}
+
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "-o ConnectTimeout=10") {
+		t.Errorf("expected the default ConnectTimeout=10 in the -e ssh command: %s", joined)
+	}
+
+	cfg.SSHConnectTimeout = 45
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "-o ConnectTimeout=45") {
+		t.Errorf("expected ConnectTimeout=45 in the -e ssh command: %s", joined)
+	}
+	ex.CheckRemotePath()
+	if !strings.Contains(strings.Join(sshArgs, " "), "-o ConnectTimeout=45") {
+		t.Errorf("remote check ssh args = %v, want ConnectTimeout=45", sshArgs)
+	}
+}
+
+func TestValidateProxyJump(t *testing.T) {
+	for _, valid := range []string{"bastion", "admin@bastion:2200", "jump1,admin@jump2.example.com"} {
+		if err := validateProxyJump(valid); err != nil {
+			t.Errorf("validateProxyJump(%q) = %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"-oProxyCommand=sh", "bastion;id", "a,,b", "bastion:99999", "user@"} {
+		if err := validateProxyJump(invalid); err == nil {
+			t.Errorf("validateProxyJump(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestBuildRsyncArgs_WindowsDestination(t *testing.T) {
+	tests := []struct {
+		name       string
+		remotePath string
+		remoteOS   string
+		wantDest   string
+	}{
+		{"drive path detected", "C:/backup", "", "user@backup-host:C:/backup/"},
+		{"trailing slash", "C:/backup/", "", "user@backup-host:C:/backup/"},
+		{"drive root", "D:", "windows", "user@backup-host:D:/"},
+		{"backslashes", `C:\Backups\Plex`, "", "user@backup-host:C:/Backups/Plex/"},
+		{"explicit unix keeps path", "/mnt/c/backup", "unix", "user@backup-host:/mnt/c/backup/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.RemotePath = tt.remotePath
+			cfg.RemoteOS = tt.remoteOS
+			ex := NewBackupExecutor(cfg)
+
+			args := ex.buildRsyncArgs()
+			if dest := args[len(args)-1]; dest != tt.wantDest {
+				t.Errorf("dest = %q, want %q", dest, tt.wantDest)
+			}
+		})
+	}
+}
+
+func TestBuildRsyncArgs_LocalDestination(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = ""
+	cfg.SSHKeyPath = ""
+	cfg.RemotePath = "/media/external/plex"
+	ex := NewBackupExecutor(cfg)
+
+	args := ex.buildRsyncArgs()
+
+	for _, arg := range args {
+		if arg == "-e" || strings.HasPrefix(arg, "ssh ") {
+			t.Errorf("local destination should not use ssh, got args: %v", args)
+		}
+	}
+	if dest := args[len(args)-1]; dest != "/media/external/plex/" {
+		t.Errorf("dest = %q, want /media/external/plex/", dest)
+	}
+	if src := args[len(args)-2]; src != "/mnt/plex-media/" {
+		t.Errorf("source = %q, want /mnt/plex-media/", src)
+	}
+}
+
+func TestBuildRsyncArgs_ProgressFlagByVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		progress2 bool
+	}{
+		{"3.2.7", true},
+		{"3.1.0", true},
+		{"3.0.9", false},
+		{"2.6.9", false},
+		{"", true}, // not detected
+	}
+
+	for _, tt := range tests {
+		cfg := testConfig(t)
+		ex := NewBackupExecutor(cfg)
+		ex.rsyncVersion = tt.version
+
+		args := ex.buildRsyncArgs()
+		joined := strings.Join(args, " ")
+		if got := strings.Contains(joined, "--info=progress2"); got != tt.progress2 {
+			t.Errorf("rsync %q: --info=progress2 present = %v, want %v", tt.version, got, tt.progress2)
+		}
+		if strings.Contains(joined, "--progress") {
+			t.Errorf("rsync %q: per-file --progress should never be passed: %s", tt.version, joined)
+		}
+	}
+}
+
+func TestBuildRsyncArgs_ArchiveOptions(t *testing.T) {
+	off := false
+	on := true
+	tests := []struct {
+		name                string
+		perms, owner, times *bool
+		wantFlag            string
+	}{
+		{"defaults keep -a", nil, nil, nil, "-avz"},
+		{"all explicitly on", &on, &on, &on, "-avz"},
+		{"no perms", &off, nil, nil, "-rltgoDvz"},
+		{"no owner", nil, &off, nil, "-rlptDvz"},
+		{"no times", nil, nil, &off, "-rlpgoDvz"},
+		{"FAT/exFAT: no perms or owner", &off, &off, nil, "-rltDvz"},
+		{"nothing preserved", &off, &off, &off, "-rlDvz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.PreservePerms = tt.perms
+			cfg.PreserveOwner = tt.owner
+			cfg.PreserveTimes = tt.times
+			ex := NewBackupExecutor(cfg)
+
+			if got := ex.buildRsyncArgs()[0]; got != tt.wantFlag {
+				t.Errorf("archive flag = %q, want %q", got, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestBuildRsyncArgs_Verbose(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+
+	if got := ex.rsyncArgs(false, nil)[0]; got != "-avz" {
+		t.Errorf("default flag = %q, want -avz", got)
+	}
+	if got := ex.rsyncArgs(true, nil)[0]; got != "-avvvz" {
+		t.Errorf("verbose flag = %q, want -avvvz", got)
+	}
+
+	cfg.Verbose = true
+	if got := ex.buildRsyncArgs()[0]; got != "-avvvz" {
+		t.Errorf("flag with verbose: true = %q, want -avvvz", got)
+	}
+}
+
+// hasArg reports whether args contains flag exactly.
+func hasArg(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildRsyncArgs_SourcePaths(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SourcePaths = []string{"/etc", "/var/www/"}
+	ex := NewBackupExecutor(cfg)
+
+	args := ex.buildRsyncArgs()
+	got := args[len(args)-3:]
+	want := []string{"/etc", "/var/www/", "user@backup-host:/backups/plex/"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("operands = %q, want %q", got, want)
+	}
+	if hasArg(args, cfg.SourcePath+"/") || hasArg(args, cfg.SourcePath) {
+		t.Errorf("source_path should be ignored when source_paths is set: %v", args)
+	}
+}
+
+func TestBuildRsyncArgs_NumericIDs(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+
+	if hasArg(ex.buildRsyncArgs(), "--numeric-ids") {
+		t.Error("--numeric-ids should not be passed by default")
+	}
+
+	cfg.NumericIDs = true
+	if !hasArg(ex.buildRsyncArgs(), "--numeric-ids") {
+		t.Errorf("expected --numeric-ids with numeric_ids: true, got: %v", ex.buildRsyncArgs())
+	}
+}
+
+func TestBuildRsyncArgs_RsyncPath(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	for _, arg := range ex.buildRsyncArgs() {
+		if strings.HasPrefix(arg, "--rsync-path") {
+			t.Errorf("--rsync-path should not be passed by default: %s", arg)
+		}
+	}
+
+	cfg.RsyncPath = "sudo rsync"
+	args := ex.buildRsyncArgs()
+	if !hasArg(args, "--rsync-path=sudo rsync") {
+		t.Errorf("expected --rsync-path=sudo rsync, got: %v", args)
+	}
+
+	cfg.RemoteHost = ""
+	cfg.RemotePath = t.TempDir()
+	if hasArg(ex.buildRsyncArgs(), "--rsync-path=sudo rsync") {
+		t.Error("--rsync-path should not be passed for a local destination")
+	}
+}
+
+func TestBuildRsyncArgs_FilterFile(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ExtraArgs = []string{"--checksum"}
+	ex := NewBackupExecutor(cfg)
+	for _, arg := range ex.buildRsyncArgs() {
+		if strings.HasPrefix(arg, "--filter") {
+			t.Errorf("--filter should not be passed by default: %s", arg)
+		}
+	}
+
+	cfg.FilterFile = "/etc/rsync-web/filter rules"
+	args := ex.buildRsyncArgs()
+	if !hasArg(args, "--filter=merge /etc/rsync-web/filter rules") {
+		t.Fatalf("expected --filter=merge with the file as one argument, got: %v", args)
+	}
+	// Before extra_args, so their rules can follow
+	if strings.Index(strings.Join(args, "\x00"), "--filter=") > strings.Index(strings.Join(args, "\x00"), "--checksum") {
+		t.Errorf("--filter should come before extra_args: %v", args)
+	}
+}
+
+func TestBuildRsyncArgs_ChmodRules(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	for _, arg := range ex.buildRsyncArgs() {
+		if strings.HasPrefix(arg, "--chmod") {
+			t.Errorf("--chmod should not be passed by default: %s", arg)
+		}
+	}
+
+	cfg.ChmodRules = "D755,F644"
+	if args := ex.buildRsyncArgs(); !hasArg(args, "--chmod=D755,F644") {
+		t.Errorf("expected --chmod=D755,F644, got: %v", args)
+	}
+}
+
+func TestBuildRsyncArgs_KnownHostsFile(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null") {
+		t.Errorf("args = %s, want host keys unchecked by default", joined)
+	}
+
+	cfg.KnownHostsFile = "/var/lib/rsync-web/known_hosts"
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "-o StrictHostKeyChecking=yes -o UserKnownHostsFile=/var/lib/rsync-web/known_hosts") {
+		t.Errorf("args = %s, want strict checking against known_hosts_file", joined)
+	}
+}
+
+func TestSSHOptions_ConsistentAcrossCallers(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = "user@backup-host:2222"
+	cfg.SSHKeyPath = "/keys/a,/keys/b"
+	cfg.SSHProxyJump = "admin@bastion"
+	cfg.SSHConnectTimeout = 30
+	ex := NewBackupExecutor(cfg)
+	var checkArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		checkArgs = args
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+
+	// The options between "ssh" in rsync's -e and the host on the remote
+	// check's command line
+	options := func() (rsync, check string) {
+		args := ex.buildRsyncArgs()
+		for i, arg := range args {
+			if arg == "-e" {
+				rsync = strings.TrimPrefix(args[i+1], "ssh ")
+			}
+		}
+		ex.remoteCheck.invalidate()
+		if _, _, err := ex.CheckRemotePath(); err != nil {
+			t.Fatal(err)
+		}
+		return rsync, strings.Join(checkArgs[:len(checkArgs)-2], " ")
+	}
+
+	want := "-i /keys/a -i /keys/b -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o ConnectTimeout=30 -p 2222 -J admin@bastion"
+	if rsync, check := options(); rsync != want || check != want {
+		t.Errorf("ssh options:\n rsync: %s\n check: %s\n want:  %s", rsync, check, want)
+	}
+
+	cfg.KnownHostsFile = "/var/lib/rsync-web/known_hosts"
+	cfg.RemoteCheckStrictHostKeys = true // known_hosts_file covers every caller
+	want = "-i /keys/a -i /keys/b -o StrictHostKeyChecking=yes -o UserKnownHostsFile=/var/lib/rsync-web/known_hosts -o ConnectTimeout=30 -p 2222 -J admin@bastion"
+	if rsync, check := options(); rsync != want || check != want {
+		t.Errorf("with known_hosts_file:\n rsync: %s\n check: %s\n want:  %s", rsync, check, want)
+	}
+
+	// Strict checking for the remote check alone
+	cfg.KnownHostsFile = ""
+	rsync, check := options()
+	if !strings.Contains(rsync, "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null") {
+		t.Errorf("rsync ssh options = %s, want host keys unchecked", rsync)
+	}
+	if check != "-i /keys/a -i /keys/b -o StrictHostKeyChecking=yes -o ConnectTimeout=30 -p 2222 -J admin@bastion" {
+		t.Errorf("remote check ssh options = %s, want strict checking against the default known_hosts", check)
+	}
+}
+
+func TestBuildRsyncArgs_IPv6Host(t *testing.T) {
+	for _, tt := range []struct {
+		remoteHost string
+		wantDest   string
+		wantSSH    string
+	}{
+		{"user@fe80::1", "user@[fe80::1]:/backups/plex/", "user@fe80::1"},
+		{"user@[2001:db8::10]:2222", "user@[2001:db8::10]:/backups/plex/", "-p 2222 user@2001:db8::10"},
+		{"user@backup-host:2222", "user@backup-host:/backups/plex/", "-p 2222 user@backup-host"},
+	} {
+		cfg := testConfig(t)
+		cfg.RemoteHost = tt.remoteHost
+		ex := NewBackupExecutor(cfg)
+
+		args := ex.buildRsyncArgs()
+		if dest := args[len(args)-1]; dest != tt.wantDest {
+			t.Errorf("%s: destination = %q, want %q", tt.remoteHost, dest, tt.wantDest)
+		}
+
+		var sshArgs []string
+		ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+			sshArgs = args
+			return exec.Command("true")
+		}
+		ex.CheckRemotePath()
+		if !strings.Contains(strings.Join(sshArgs, " "), tt.wantSSH) {
+			t.Errorf("%s: remote check ssh args = %v, want %q", tt.remoteHost, sshArgs, tt.wantSSH)
+		}
+	}
+}
+
+func TestBuildRsyncArgs_InPlace(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SourcePath = "/data/archive.tar.gz"
+	cfg.SourceIsFile = true
+	ex := NewBackupExecutor(cfg)
+
+	if hasArg(ex.buildRsyncArgs(), "--inplace") {
+		t.Error("--inplace should not be passed by default")
+	}
+
+	cfg.InPlace = true
+	args := ex.buildRsyncArgs()
+	if !hasArg(args, "--inplace") || !hasArg(args, "--partial") {
+		t.Errorf("expected --inplace alongside --partial, got: %v", args)
+	}
+}
+
+func TestBuildRsyncArgs_BandwidthPercent(t *testing.T) {
+	bwlimit := func(args []string) string {
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--bwlimit=") {
+				return arg
+			}
+		}
+		return ""
+	}
+
+	cfg := testConfig(t)
+	cfg.BandwidthLimit = 800
+	cfg.BandwidthPercent = 50
+	ex := NewBackupExecutor(cfg)
+
+	cfg.LinkSpeed = 2000
+	if got := bwlimit(ex.buildRsyncArgs()); got != "--bwlimit=1000" {
+		t.Errorf("50%% of link_speed 2000 = %q, want --bwlimit=1000", got)
+	}
+
+	// Without a link speed the static limit applies
+	cfg.LinkSpeed = 0
+	if got := bwlimit(ex.buildRsyncArgs()); got != "--bwlimit=800" {
+		t.Errorf("no link_speed = %q, want the static --bwlimit=800", got)
+	}
+}
+
 func TestBuildRsyncArgs_BandwidthLimit(t *testing.T) {
 	cfg := testConfig(t)
 	cfg.BandwidthLimit = 5000
@@ -145,6 +676,33 @@ func TestBuildRsyncArgs_BandwidthLimit(t *testing.T) {
 	}
 }
 
+func TestBuildRsyncArgs_BandwidthScheduleWindow(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BandwidthLimit = 5000
+	now := time.Now()
+
+	// Window covering the current time overrides the static limit
+	cfg.BandwidthSchedule = []BandwidthWindow{{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+		Limit: 800,
+	}}
+	ex := NewBackupExecutor(cfg)
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "--bwlimit=800") {
+		t.Errorf("expected --bwlimit=800 inside window, got: %s", joined)
+	}
+
+	// Window that does not cover the current time falls back to the static limit
+	cfg.BandwidthSchedule = []BandwidthWindow{{
+		Start: now.Add(2 * time.Hour).Format("15:04"),
+		End:   now.Add(3 * time.Hour).Format("15:04"),
+		Limit: 800,
+	}}
+	if joined := strings.Join(ex.buildRsyncArgs(), " "); !strings.Contains(joined, "--bwlimit=5000") {
+		t.Errorf("expected --bwlimit=5000 outside window, got: %s", joined)
+	}
+}
+
 func TestBuildRsyncArgs_NoBandwidthLimitWhenZero(t *testing.T) {
 	cfg := testConfig(t)
 	cfg.BandwidthLimit = 0
@@ -191,6 +749,26 @@ func TestBuildRsyncArgs_DestinationFormat(t *testing.T) {
 	}
 }
 
+func TestBuildRsyncArgs_ExtraArgsBeforeOperands(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BandwidthLimit = 5000
+	cfg.ExtraArgs = []string{"--exclude=*.tmp", "--checksum"}
+	ex := NewBackupExecutor(cfg)
+
+	args := ex.buildRsyncArgs()
+
+	n := len(args)
+	if args[n-4] != "--exclude=*.tmp" || args[n-3] != "--checksum" {
+		t.Errorf("extra args should come right before source/dest, got: %v", args)
+	}
+	if args[n-5] != "--bwlimit=5000" {
+		t.Errorf("extra args should come after built-in flags, got: %v", args)
+	}
+	if args[n-2] != "/mnt/plex-media/" || args[n-1] != "user@backup-host:/backups/plex/" {
+		t.Errorf("source/dest should remain the last operands, got: %v", args)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // File source support
 // ---------------------------------------------------------------------------
@@ -245,10 +823,151 @@ func TestBuildRsyncArgs_FileSourceDefaultFalse(t *testing.T) {
 	}
 }
 
-// ---------------------------------------------------------------------------
-// Remote path check
-// ---------------------------------------------------------------------------
-
+func TestBackup_RecordsCommand(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "ok")
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	last := ex.LastRun()
+	want := "rsync " + strings.Join(ex.buildRsyncArgs(), " ")
+	if last.Command != want {
+		t.Errorf("Command = %q, want %q", last.Command, want)
+	}
+
+	// Survives a reload from history.json
+	reloaded, ok := NewBackupExecutor(cfg).RunByLogFile(last.LogFile + ".gz")
+	if !ok || reloaded.Command != want {
+		t.Errorf("RunByLogFile() = %+v, %v, want the run with its command", reloaded, ok)
+	}
+}
+
+func TestBackup_RsyncNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		bin  string
+	}{
+		{"not on PATH", "rsync-web-test-no-such-binary"},
+		{"missing absolute path", "/nonexistent/bin/rsync"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			ex := NewBackupExecutor(cfg)
+			ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+				return exec.Command(tt.bin, args...)
+			}
+
+			if err := ex.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if err := waitForStatus(ex, StatusFailed, 10*time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			last := ex.LastRun()
+			if last.Summary != "rsync binary not found" {
+				t.Errorf("summary = %q, want 'rsync binary not found'", last.Summary)
+			}
+			logContent, err := ex.ReadLog(last.LogFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(logContent, "rsync binary not found") || !strings.Contains(logContent, tt.bin) {
+				t.Errorf("log should explain the start failure, got:\n%s", logContent)
+			}
+		})
+	}
+}
+
+func TestStartErrorSummary(t *testing.T) {
+	if got := startErrorSummary(errors.New("permission denied")); got != "failed to start rsync: permission denied" {
+		t.Errorf("startErrorSummary() = %q", got)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// rsync version detection
+// ---------------------------------------------------------------------------
+
+func TestParseRsyncVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+		ok     bool
+	}{
+		{"rsync  version 3.2.7  protocol version 31\nCopyright (C) 1996-2022", "3.2.7", true},
+		{"rsync  version v3.3.0  protocol version 32", "3.3.0", true},
+		{"rsync  version 2.6.9  protocol version 29", "2.6.9", true},
+		{"openrsync: protocol version 29", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRsyncVersion(tt.output)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRsyncVersion(%q) = %q, %v, want %q, %v", tt.output, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		v, min string
+		want   bool
+	}{
+		{"3.2.7", "3.1.0", true},
+		{"3.1.0", "3.1.0", true},
+		{"3.1", "3.1.0", true},
+		{"3.0.9", "3.1.0", false},
+		{"2.6.9", "3.1.0", false},
+		{"10.0.0", "3.1.0", true},
+		{"", "3.1.0", false},
+	}
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.v, tt.min); got != tt.want {
+			t.Errorf("versionAtLeast(%q, %q) = %v, want %v", tt.v, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestDetectRsyncVersion(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = fakeRsyncCmd(0, "rsync  version 3.2.7  protocol version 31\n")
+
+	version, err := ex.DetectRsyncVersion()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != "3.2.7" || ex.RsyncVersion() != "3.2.7" {
+		t.Errorf("DetectRsyncVersion() = %q, RsyncVersion() = %q, want 3.2.7", version, ex.RsyncVersion())
+	}
+}
+
+func TestDetectRsyncVersion_Missing(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("rsync-web-test-no-such-binary", args...)
+	}
+
+	_, err := ex.DetectRsyncVersion()
+	if err == nil || !strings.Contains(err.Error(), "rsync binary not found") {
+		t.Errorf("DetectRsyncVersion() error = %v, want 'rsync binary not found'", err)
+	}
+	if ex.RsyncVersion() != "" {
+		t.Errorf("RsyncVersion() = %q, want empty", ex.RsyncVersion())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Remote path check
+// ---------------------------------------------------------------------------
+
 func TestCheckRemotePath_NonEmpty(t *testing.T) {
 	cfg := testConfig(t)
 	ex := NewBackupExecutor(cfg)
@@ -315,6 +1034,254 @@ func TestCheckRemotePath_SSHFailure(t *testing.T) {
 	}
 }
 
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/backups/plex", `'/backups/plex'`},
+		{"/mnt/Plex Media", `'/mnt/Plex Media'`},
+		{"/backups/it's", `'/backups/it'\''s'`},
+		{"'; rm -rf / #", `''\''; rm -rf / #'`},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteListCommand_QuoteInPath(t *testing.T) {
+	// Run the generated command through a local shell against a directory
+	// whose name contains a single quote.
+	dir := filepath.Join(t.TempDir(), "it's a'; touch pwned; '")
+	os.MkdirAll(dir, 0755)
+	for _, name := range []string{"movies", "tv-shows"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	out, err := exec.Command("sh", "-c", remoteListCommand(dir)).Output()
+	if err != nil {
+		t.Fatalf("running list command: %v", err)
+	}
+	if got := strings.Fields(string(out)); len(got) != 2 || got[0] != "movies" || got[1] != "tv-shows" {
+		t.Errorf("listing = %q, want [movies tv-shows]", got)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		os.Remove("pwned")
+		t.Error("quote in path escaped the shell quoting")
+	}
+}
+
+func TestCheckRemotePath_Windows(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemotePath = "C:/backup/plex"
+	ex := NewBackupExecutor(cfg)
+	var gotArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeRsyncCmd(0, "a\r\nb\r\nc\r\nd\r\ne\r\nf\r\n")(name, args...)
+	}
+
+	nonEmpty, files, err := ex.CheckRemotePath()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `dir /b /a "C:\backup\plex" 2>nul & exit 0`; gotArgs[len(gotArgs)-1] != want {
+		t.Errorf("remote command = %q, want %q", gotArgs[len(gotArgs)-1], want)
+	}
+	if !nonEmpty || len(files) != 5 || files[0] != "a" {
+		t.Errorf("files = %q, want the first five entries without CR", files)
+	}
+}
+
+func TestWindowsListCommand_DriveRoot(t *testing.T) {
+	if got := windowsListCommand("C:"); got != `dir /b /a "C:\" 2>nul & exit 0` {
+		t.Errorf("windowsListCommand(C:) = %q", got)
+	}
+}
+
+func TestCheckRemotePath_LocalDestination(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = ""
+	cfg.RemotePath = filepath.Join(t.TempDir(), "backup")
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		t.Errorf("local check must not run %s", name)
+		return exec.Command("true")
+	}
+
+	// Missing directory counts as empty
+	if nonEmpty, _, err := ex.CheckRemotePath(); err != nil || nonEmpty {
+		t.Errorf("CheckRemotePath() = %v, %v, want empty for a missing directory", nonEmpty, err)
+	}
+
+	os.MkdirAll(cfg.RemotePath, 0755)
+	os.WriteFile(filepath.Join(cfg.RemotePath, "movie.mkv"), []byte("x"), 0644)
+	nonEmpty, files, err := ex.CheckRemotePath()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !nonEmpty || len(files) != 1 || files[0] != "movie.mkv" {
+		t.Errorf("CheckRemotePath() = %v, %v, want movie.mkv", nonEmpty, files)
+	}
+}
+
+func TestRun_LocalFreeSpace(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = ""
+	cfg.RemotePath = filepath.Join(t.TempDir(), "backup", "plex")
+	cfg.RequireLocalFreeSpace = 10 << 30
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "")
+
+	var checked string
+	free := uint64(2 << 30)
+	ex.diskFree = func(path string) (uint64, error) {
+		checked = path
+		return free, nil
+	}
+
+	err := ex.Run()
+	if err == nil || !strings.Contains(err.Error(), "2.0 GiB available, require_local_free_space is 10.0 GiB") {
+		t.Fatalf("Run() error = %v, want a free space error", err)
+	}
+	if ex.Current() != nil || len(ex.History()) != 0 {
+		t.Error("a refused backup must not start or be recorded")
+	}
+	// The destination does not exist yet, so its nearest parent is measured
+	if checked != filepath.Dir(filepath.Dir(cfg.RemotePath)) {
+		t.Errorf("checked free space on %s, want the nearest existing parent", checked)
+	}
+
+	free = 20 << 30
+	if err := ex.Run(); err != nil {
+		t.Fatalf("Run() with enough space: %v", err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_LocalFreeSpace_IgnoredForRemote(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RequireLocalFreeSpace = 10 << 30
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "")
+	ex.diskFree = func(path string) (uint64, error) {
+		t.Errorf("free space checked on %s for a remote destination", path)
+		return 0, nil
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_FilterFileMissing(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.FilterFile = filepath.Join(t.TempDir(), "filter.rules")
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		t.Errorf("%s started with a missing filter_file", name)
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+
+	err := ex.Run()
+	if err == nil || !strings.Contains(err.Error(), "filter_file") || !strings.Contains(err.Error(), cfg.FilterFile) {
+		t.Fatalf("Run() error = %v, want a filter_file error naming the file", err)
+	}
+	if ex.Status() == StatusRunning || ex.LastRun() != nil {
+		t.Error("no run should be recorded when filter_file is missing")
+	}
+
+	// Once the file exists the backup runs
+	os.WriteFile(cfg.FilterFile, []byte("- *.tmp\n"), 0644)
+	ex.cmdFactory = fakeRsyncCmd(0, "")
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRemotePath_RejectsInvalidRemote(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RemoteHost = "user@host; rm -rf /"
+	ex := NewBackupExecutor(cfg)
+	called := false
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		called = true
+		return exec.Command("true")
+	}
+
+	if _, _, err := ex.CheckRemotePath(); err == nil {
+		t.Error("expected error for malicious remote host")
+	}
+	if called {
+		t.Error("ssh must not be run with an invalid remote host")
+	}
+}
+
+func TestTestConnection_Success(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SSHConnectTimeout = 20
+	ex := NewBackupExecutor(cfg)
+	var gotArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+
+	if err := ex.TestConnection("user@backup-host:2222", "~/.ssh/other_key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	joined := strings.Join(gotArgs, " ")
+	for _, want := range []string{"-i ~/.ssh/other_key", "BatchMode=yes", "ConnectTimeout=20", "-p 2222", "user@backup-host true"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("ssh args %q should contain %q", joined, want)
+		}
+	}
+}
+
+func TestTestConnection_Failures(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		wantReason string
+	}{
+		{"auth", "user@backup-host: Permission denied (publickey).", "auth"},
+		{"unreachable", "ssh: connect to host backup-host port 22: No route to host", "unreachable"},
+		{"dns", "ssh: Could not resolve hostname backup-host: Name or service not known", "unreachable"},
+		{"timeout", "ssh: connect to host backup-host port 22: Connection timed out", "timeout"},
+		{"host key", "@@@@@@@@@@@\n@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\nHost key verification failed.", "host_key"},
+		{"other", "kex_exchange_identification: read: Connection reset by peer", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			ex := NewBackupExecutor(cfg)
+			ex.cmdFactory = fakeRsyncCmd(255, tt.output)
+
+			err := ex.TestConnection(cfg.RemoteHost, cfg.SSHKeyPath)
+			var connErr *ConnectionError
+			if !errors.As(err, &connErr) {
+				t.Fatalf("error = %v, want *ConnectionError", err)
+			}
+			if connErr.Reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", connErr.Reason, tt.wantReason)
+			}
+			if connErr.Output != tt.output {
+				t.Errorf("output = %q, want ssh's message", connErr.Output)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Unreachable backup target
 // ---------------------------------------------------------------------------
@@ -423,6 +1390,10 @@ rsync error: some files/attrs were not transferred (code 23)`)
 	if last.Status != StatusWarning {
 		t.Errorf("status = %q, want %q", last.Status, StatusWarning)
 	}
+	want := []RunError{{Path: "/mnt/plex-media/media/movies/restricted.mkv", Message: "send_files failed to open: Permission denied", Errno: 13}}
+	if !reflect.DeepEqual(last.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", last.Errors, want)
+	}
 
 	// The log should contain the rsync partial transfer output
 	logContent, err := ex.ReadLog(last.LogFile)
@@ -475,6 +1446,78 @@ rsync warning: some files vanished before they could be transferred (code 24)`)
 	}
 }
 
+func TestBackup_ExitCodeOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		warning []int
+		ignore  []int
+		want    BackupStatus
+	}{
+		{"vanished ignored", 24, nil, []int{24}, StatusSuccess},
+		{"partial made a failure", 23, []int{24}, nil, StatusFailed},
+		{"timeout made a warning", 30, []int{23, 24, 30}, nil, StatusWarning},
+		{"defaults kept", 23, nil, nil, StatusWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WarningExitCodes = tt.warning
+			cfg.IgnoreExitCodes = tt.ignore
+			ex := NewBackupExecutor(cfg)
+			ex.cmdFactory = fakeRsyncCmd(tt.code, "")
+
+			if err := ex.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if err := waitForStatus(ex, tt.want, 10*time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if last := ex.LastRun(); last.Status != tt.want || last.ExitCode != tt.code {
+				t.Errorf("run = %s (exit %d), want %s (exit %d)", last.Status, last.ExitCode, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestBackup_ExitCodeOverridesSkipStartFailures(t *testing.T) {
+	// An exit code of 1 that rsync never returned: it did not start, or
+	// there was nowhere to log
+	for _, tt := range []struct {
+		name    string
+		warning []int
+		ignore  []int
+		logDir  bool
+	}{
+		{"ignored, rsync missing", nil, []int{1}, false},
+		{"made a warning, rsync missing", []int{1, 23, 24}, nil, false},
+		{"ignored, log dir unwritable", nil, []int{1}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WarningExitCodes = tt.warning
+			cfg.IgnoreExitCodes = tt.ignore
+			if tt.logDir {
+				cfg.LogDir = filepath.Join(t.TempDir(), "not-a-dir")
+				os.WriteFile(cfg.LogDir, nil, 0644)
+			}
+			ex := NewBackupExecutor(cfg)
+			ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+				return exec.Command("rsync-web-test-no-such-binary", args...)
+			}
+
+			if err := ex.Run(); err != nil {
+				t.Fatal(err)
+			}
+			ex.Wait(context.Background())
+			if last := ex.LastRun(); last.Status != StatusFailed {
+				t.Errorf("run = %s (%s), want %s whatever the exit code settings", last.Status, last.Summary, StatusFailed)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // rsyncExitSummary
 // ---------------------------------------------------------------------------
@@ -590,6 +1633,7 @@ func TestBackup_ConcurrentPrevention(t *testing.T) {
 	if err := waitForStatus(ex, StatusRunning, 5*time.Second); err != nil {
 		t.Fatal(err)
 	}
+	waitForLogFile(t, ex)
 
 	// Try second backup — should be rejected
 	err = ex.Run()
@@ -601,6 +1645,88 @@ func TestBackup_ConcurrentPrevention(t *testing.T) {
 	}
 }
 
+func TestBackup_ConcurrentRunsBackToBack(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", "5")
+	}
+
+	// Both calls race for the run slot with no wait in between
+	start := make(chan struct{})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-start
+			errs <- ex.Run()
+		}()
+	}
+	close(start)
+
+	started := 0
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			started++
+		} else if !strings.Contains(err.Error(), "already in progress") {
+			t.Errorf("Run() error = %v, want 'already in progress'", err)
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d runs started, want exactly 1", started)
+	}
+
+	ex.Cancel()
+	ex.Wait(context.Background())
+}
+
+func TestBackup_ConcurrentReadsWhileRunning(t *testing.T) {
+	// Run with -race: status readers must never observe the run while
+	// execute/finishRun are mutating it.
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", "sleep 0.3; echo 'Total transferred file size: 2,048 bytes'")
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ex.Status() == StatusRunning {
+				if cur := ex.Current(); cur != nil {
+					_ = cur.Status
+					_ = cur.Duration
+					_ = cur.Stats
+				}
+				for _, run := range ex.History() {
+					_ = run.Summary
+				}
+				if last := ex.LastRun(); last != nil && last.Stats != nil {
+					_ = last.Stats.TransferredSize
+				}
+				_ = ex.Totals()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if ex.Current() != nil {
+		t.Error("Current() should be nil once the run has finished")
+	}
+	if last := ex.LastRun(); last == nil || last.Stats == nil || last.Stats.TransferredSize != 2048 {
+		t.Errorf("LastRun() = %+v, want stats with 2048 bytes transferred", last)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Resume: verify --partial flag enables rsync resume behavior
 // ---------------------------------------------------------------------------
@@ -662,7 +1788,46 @@ func TestHistory_PersistsAcrossRestarts(t *testing.T) {
 	}
 }
 
-func TestHistory_CappedAt100(t *testing.T) {
+func TestHistory_MarksInterruptedRunOnLoad(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	entries := []BackupRun{
+		{ID: "20260102-030000", StartTime: time.Now(), Status: StatusRunning, LogFile: "backup-20260102-030000.log"},
+		{ID: "20260101-030000", StartTime: time.Now(), Status: StatusSuccess, LogFile: "backup-20260101-030000.log"},
+	}
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	os.WriteFile(filepath.Join(cfg.LogDir, "history.json"), data, 0644)
+
+	ex := NewBackupExecutor(cfg)
+
+	if ex.Status() != StatusFailed {
+		t.Errorf("status = %q, want failed, not running", ex.Status())
+	}
+	if ex.IsRunning() {
+		t.Error("no backup should be reported as running")
+	}
+	last := ex.LastRun()
+	if last.Status != StatusFailed || last.Summary != interruptedSummary {
+		t.Errorf("last run = %s %q, want failed and interrupted", last.Status, last.Summary)
+	}
+
+	// The correction is written back, so it survives another restart
+	ex2 := NewBackupExecutor(cfg)
+	if got := ex2.LastRun(); got.Summary != interruptedSummary {
+		t.Errorf("reloaded summary = %q, want the interrupted summary", got.Summary)
+	}
+
+	// A new backup can start
+	ex.cmdFactory = fakeRsyncCmd(0, "ok")
+	if err := ex.Run(); err != nil {
+		t.Fatalf("Run() after an interrupted run: %v", err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistory_CappedAt100(t *testing.T) {
 	cfg := testConfig(t)
 
 	// Write 105 fake history entries directly
@@ -718,15 +1883,13 @@ func TestLogPruning(t *testing.T) {
 		if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
 			t.Fatal(err)
 		}
-		// Small delay so log filenames differ (they use second-precision timestamps)
-		time.Sleep(1100 * time.Millisecond)
 	}
 
-	// Count .log files
+	// Count log files, plain and compressed
 	entries, _ := os.ReadDir(cfg.LogDir)
 	logCount := 0
 	for _, e := range entries {
-		if strings.HasSuffix(e.Name(), ".log") {
+		if strings.HasSuffix(e.Name(), ".log") || strings.HasSuffix(e.Name(), ".log.gz") {
 			logCount++
 		}
 	}
@@ -736,10 +1899,248 @@ func TestLogPruning(t *testing.T) {
 	}
 }
 
+func TestRun_BackToBackIDsAreUnique(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "ok")
+	// A frozen clock makes every run start in the same millisecond
+	ex.clock = newFakeClock(time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 3; i++ {
+		if err := ex.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := ex.History()
+	want := []string{"20260314-030000.002", "20260314-030000.001", "20260314-030000.000"}
+	for i, run := range history {
+		if run.ID != want[i] || run.LogFile != "backup-"+want[i]+".log" {
+			t.Errorf("run %d: ID = %s, log = %s, want %s", i, run.ID, run.LogFile, want[i])
+		}
+	}
+	entries, _ := os.ReadDir(cfg.LogDir)
+	logs := 0
+	for _, e := range entries {
+		if ex.isLogFile(e.Name()) {
+			logs++
+		}
+	}
+	if logs != 3 {
+		t.Errorf("found %d log files, want one per run", logs)
+	}
+}
+
+// writeAgedLog creates a log file in dir with its modtime set age ago.
+func writeAgedLog(t *testing.T, dir, name string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogPruning_MaxAge(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxLogFiles = 10
+	cfg.MaxLogAge = 7 * 24 * time.Hour
+	os.MkdirAll(cfg.LogDir, 0755)
+
+	day := 24 * time.Hour
+	writeAgedLog(t, cfg.LogDir, "backup-20260101-030000.log.gz", 30*day)
+	writeAgedLog(t, cfg.LogDir, "backup-20260110-030000.log.gz", 8*day)
+	writeAgedLog(t, cfg.LogDir, "backup-20260112-030000.log.gz", 6*day)
+	writeAgedLog(t, cfg.LogDir, "backup-20260117-030000.log", time.Hour)
+	writeAgedLog(t, cfg.LogDir, "notes.txt", 30*day) // not a backup log
+
+	ex := NewBackupExecutor(cfg)
+	ex.pruneOldLogs()
+
+	for name, wantKept := range map[string]bool{
+		"backup-20260101-030000.log.gz": false,
+		"backup-20260110-030000.log.gz": false,
+		"backup-20260112-030000.log.gz": true,
+		"backup-20260117-030000.log":    true,
+		"notes.txt":                     true,
+	} {
+		_, err := os.Stat(filepath.Join(cfg.LogDir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+}
+
+func TestLogPruning_CountOrAge(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxLogFiles = 2
+	cfg.MaxLogAge = 48 * time.Hour
+	os.MkdirAll(cfg.LogDir, 0755)
+
+	// All recent: only the count cap applies
+	writeAgedLog(t, cfg.LogDir, "backup-20260101-030000.log.gz", 3*time.Hour)
+	writeAgedLog(t, cfg.LogDir, "backup-20260102-030000.log.gz", 2*time.Hour)
+	writeAgedLog(t, cfg.LogDir, "backup-20260103-030000.log", time.Hour)
+
+	ex := NewBackupExecutor(cfg)
+	ex.pruneOldLogs()
+
+	entries, _ := os.ReadDir(cfg.LogDir)
+	if len(entries) != 2 {
+		t.Fatalf("log count = %d, want 2 after count cap", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LogDir, "backup-20260101-030000.log.gz")); !os.IsNotExist(err) {
+		t.Error("oldest log should be removed by the count cap")
+	}
+
+	// Within the count cap, but too old
+	mtime := time.Now().Add(-72 * time.Hour)
+	os.Chtimes(filepath.Join(cfg.LogDir, "backup-20260102-030000.log.gz"), mtime, mtime)
+	ex.pruneOldLogs()
+	if _, err := os.Stat(filepath.Join(cfg.LogDir, "backup-20260102-030000.log.gz")); !os.IsNotExist(err) {
+		t.Error("log older than max_log_age should be removed even under the count cap")
+	}
+}
+
+func TestCompressOldLogs_PreservesModTime(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	writeAgedLog(t, cfg.LogDir, "backup-20260101-030000.log", 10*24*time.Hour)
+	writeAgedLog(t, cfg.LogDir, "backup-20260102-030000.log", time.Hour)
+
+	ex := NewBackupExecutor(cfg)
+	ex.compressOldLogs()
+
+	info, err := os.Stat(filepath.Join(cfg.LogDir, "backup-20260101-030000.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := time.Since(info.ModTime()); age < 9*24*time.Hour {
+		t.Errorf("compressed log age = %v, want the original modtime kept", age)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Log compression
+// ---------------------------------------------------------------------------
+
+func TestCompressOldLogs_KeepsNewestPlain(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	for _, id := range []string{"20260101-030000", "20260102-030000", "20260103-030000"} {
+		os.WriteFile(filepath.Join(cfg.LogDir, "backup-"+id+".log"), []byte("log "+id), 0644)
+	}
+	ex := NewBackupExecutor(cfg)
+
+	ex.compressOldLogs()
+
+	for _, id := range []string{"20260101-030000", "20260102-030000"} {
+		if _, err := os.Stat(filepath.Join(cfg.LogDir, "backup-"+id+".log")); !os.IsNotExist(err) {
+			t.Errorf("backup-%s.log should have been replaced by its compressed copy", id)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.LogDir, "backup-"+id+".log.gz")); err != nil {
+			t.Errorf("backup-%s.log.gz should exist: %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LogDir, "backup-20260103-030000.log")); err != nil {
+		t.Errorf("newest log should stay uncompressed: %v", err)
+	}
+}
+
+func TestReadLog_CompressedFallback(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-20260101-030000.log"), []byte("old rsync output"), 0644)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-20260102-030000.log"), []byte("new rsync output"), 0644)
+	ex := NewBackupExecutor(cfg)
+	ex.compressOldLogs()
+
+	// The logical .log name still resolves after compression
+	content, err := ex.ReadLog("backup-20260101-030000.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "old rsync output" {
+		t.Errorf("content = %q, want 'old rsync output'", content)
+	}
+
+	if _, err := ex.ReadLog("backup-20260105-030000.log"); !os.IsNotExist(err) {
+		t.Errorf("missing log should return a not-exist error, got: %v", err)
+	}
+}
+
+func TestBackup_CompressesPreviousLog(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "first run output")
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	first := ex.LastRun()
+
+	time.Sleep(1100 * time.Millisecond)
+	ex.cmdFactory = fakeRsyncCmd(0, "second run output")
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for ex.LastRun().ID == first.ID && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// Compression runs right after the history entry is recorded
+	gzPath := filepath.Join(cfg.LogDir, first.LogFile+".gz")
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(gzPath); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := os.Stat(gzPath); err != nil {
+		t.Fatalf("previous log should be compressed: %v", err)
+	}
+	if first.LogFile != "backup-"+first.ID+".log" {
+		t.Errorf("history LogFile = %q, want the logical .log name", first.LogFile)
+	}
+	content, err := ex.ReadLog(first.LogFile)
+	if err != nil {
+		t.Fatalf("reading compressed log: %v", err)
+	}
+	if !strings.Contains(content, "first run output") {
+		t.Errorf("decompressed log should contain the first run output, got:\n%s", content)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Log reading — path traversal prevention
 // ---------------------------------------------------------------------------
 
+func TestLogUsage_MissingDir(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+
+	usage, err := ex.LogUsage()
+	if err != nil {
+		t.Fatalf("LogUsage() on a missing log dir: %v", err)
+	}
+	if usage.TotalBytes != 0 || usage.LogFiles != 0 {
+		t.Errorf("usage = %+v, want empty", usage)
+	}
+}
+
 func TestReadLog_PathTraversalPrevention(t *testing.T) {
 	cfg := testConfig(t)
 	os.MkdirAll(cfg.LogDir, 0755)
@@ -759,6 +2160,71 @@ func TestReadLog_PathTraversalPrevention(t *testing.T) {
 	}
 }
 
+func TestReadLog_RejectsUnexpectedNames(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "history.json"), []byte("[]"), 0644)
+	os.WriteFile(filepath.Join(cfg.LogDir, "settings.json"), []byte("{}"), 0644)
+	ex := NewBackupExecutor(cfg)
+
+	for _, name := range []string{"history.json", "settings.json", "notes.log", "backup-x.txt", "backup-a/../../x.log"} {
+		if _, err := ex.ReadLog(name); !errors.Is(err, errInvalidLogName) {
+			t.Errorf("ReadLog(%q) error = %v, want errInvalidLogName", name, err)
+		}
+	}
+}
+
+func TestReadLog_DotsInName(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-manual..retry.log"), []byte("ok"), 0644)
+	ex := NewBackupExecutor(cfg)
+
+	content, err := ex.ReadLog("backup-manual..retry.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "ok" {
+		t.Errorf("content = %q, want ok", content)
+	}
+}
+
+func TestReadLog_SymlinkEscape(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(secret, []byte("top secret"), 0644)
+	if err := os.Symlink(secret, filepath.Join(cfg.LogDir, "backup-evil.log")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	// Same trick via the compressed fallback
+	os.Symlink(secret, filepath.Join(cfg.LogDir, "backup-evil2.log.gz"))
+
+	// A symlink that stays inside the log dir is fine
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-real.log"), []byte("real log"), 0644)
+	os.Symlink("backup-real.log", filepath.Join(cfg.LogDir, "backup-latest.log"))
+
+	ex := NewBackupExecutor(cfg)
+
+	for _, name := range []string{"backup-evil.log", "backup-evil2.log"} {
+		content, err := ex.ReadLog(name)
+		if !errors.Is(err, errInvalidLogName) {
+			t.Errorf("ReadLog(%q) error = %v, want errInvalidLogName", name, err)
+		}
+		if strings.Contains(content, "top secret") {
+			t.Errorf("ReadLog(%q) leaked a file outside the log dir", name)
+		}
+	}
+	if _, err := ex.ReadLogTail("backup-evil.log", 10); !errors.Is(err, errInvalidLogName) {
+		t.Errorf("ReadLogTail error = %v, want errInvalidLogName", err)
+	}
+
+	content, err := ex.ReadLog("backup-latest.log")
+	if err != nil || content != "real log" {
+		t.Errorf("ReadLog(backup-latest.log) = %q, %v, want the linked log", content, err)
+	}
+}
+
 func TestReadLog_ValidFile(t *testing.T) {
 	cfg := testConfig(t)
 	os.MkdirAll(cfg.LogDir, 0755)
@@ -773,3 +2239,453 @@ func TestReadLog_ValidFile(t *testing.T) {
 		t.Errorf("content = %q, want 'test log content'", content)
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Log tailing
+// ---------------------------------------------------------------------------
+
+func TestReadLogTail_Bytes(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-test.log"), []byte("0123456789"), 0644)
+	ex := NewBackupExecutor(cfg)
+
+	content, err := ex.ReadLogTail("backup-test.log", 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "6789" {
+		t.Errorf("content = %q, want '6789'", content)
+	}
+
+	// Requesting more than the file size returns the whole file
+	content, err = ex.ReadLogTail("backup-test.log", 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "0123456789" {
+		t.Errorf("content = %q, want the full file", content)
+	}
+}
+
+func TestReadLogLines(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-test.log"), []byte("one\ntwo\nthree\nfour\n"), 0644)
+	ex := NewBackupExecutor(cfg)
+
+	content, err := ex.ReadLogLines("backup-test.log", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "three\nfour\n" {
+		t.Errorf("content = %q, want 'three\\nfour\\n'", content)
+	}
+
+	// Requesting more lines than the file has returns the whole file
+	content, err = ex.ReadLogLines("backup-test.log", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "one\ntwo\nthree\nfour\n" {
+		t.Errorf("content = %q, want the full file", content)
+	}
+}
+
+func TestReadLogLines_SpansChunks(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	var sb strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&sb, "line %05d\n", i)
+	}
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-big.log"), []byte(sb.String()), 0644)
+	ex := NewBackupExecutor(cfg)
+
+	content, err := ex.ReadLogLines("backup-big.log", 9000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if len(lines) != 9000 {
+		t.Fatalf("got %d lines, want 9000", len(lines))
+	}
+	if lines[0] != "line 11000" || lines[8999] != "line 19999" {
+		t.Errorf("first/last line = %q/%q, want 'line 11000'/'line 19999'", lines[0], lines[8999])
+	}
+}
+
+func TestReadLogTail_Compressed(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-20260101-030000.log"), []byte("a\nb\nc\n"), 0644)
+	os.WriteFile(filepath.Join(cfg.LogDir, "backup-20260102-030000.log"), []byte("newest"), 0644)
+	ex := NewBackupExecutor(cfg)
+	ex.compressOldLogs()
+
+	content, err := ex.ReadLogLines("backup-20260101-030000.log", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "c\n" {
+		t.Errorf("content = %q, want 'c\\n'", content)
+	}
+
+	content, err = ex.ReadLogTail("backup-20260101-030000.log", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content != "c\n" {
+		t.Errorf("content = %q, want 'c\\n'", content)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Shutdown with a backup in progress
+// ---------------------------------------------------------------------------
+
+// sleepCmd returns a CmdFactory whose "rsync" just sleeps for d.
+func sleepCmd(d time.Duration) CmdFactory {
+	return func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", fmt.Sprintf("%.1f", d.Seconds()))
+	}
+}
+
+func TestShutdown_Cancel(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = sleepCmd(10 * time.Second)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, ex)
+
+	start := time.Now()
+	ex.Shutdown(ShutdownCancel, time.Minute)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancel took %v, want rsync stopped right away", elapsed)
+	}
+	if ex.IsRunning() {
+		t.Fatal("backup should have stopped")
+	}
+	last := ex.LastRun()
+	if last.Status != StatusFailed || last.Summary != "cancelled during shutdown" {
+		t.Errorf("last run = %s %q, want failed, cancelled during shutdown", last.Status, last.Summary)
+	}
+}
+
+func TestShutdown_WaitFinishesWithinGrace(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = sleepCmd(300 * time.Millisecond)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ex.Shutdown(ShutdownWait, 10*time.Second)
+
+	if ex.IsRunning() {
+		t.Fatal("Shutdown should return only after the backup finished")
+	}
+	if last := ex.LastRun(); last.Status != StatusSuccess {
+		t.Errorf("last run status = %s, want success", last.Status)
+	}
+}
+
+func TestShutdown_WaitCancelsAfterGrace(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = sleepCmd(10 * time.Second)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, ex)
+
+	start := time.Now()
+	ex.Shutdown(ShutdownWait, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Shutdown took %v, want the grace period then a prompt cancel", elapsed)
+	}
+	if last := ex.LastRun(); last == nil || last.Summary != "cancelled during shutdown" {
+		t.Errorf("last run = %+v, want it cancelled after the grace period", last)
+	}
+}
+
+func TestShutdown_Detach(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.cmdFactory = sleepCmd(10 * time.Second)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, ex)
+
+	ex.Shutdown(ShutdownDetach, time.Minute)
+	if !ex.IsRunning() {
+		t.Error("detach should leave the backup running")
+	}
+
+	// Clean up the sleeping process
+	ex.Cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !ex.Wait(ctx) {
+		t.Fatal("backup did not stop after Cancel")
+	}
+}
+
+func TestCancel_Idle(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	if ex.Cancel() {
+		t.Error("Cancel() with no backup running should report false")
+	}
+}
+
+// firstRunCmd fakes ssh listing remoteFiles and a successful rsync, and
+// records the arguments of each rsync call.
+func firstRunCmd(remoteFiles string, rsyncArgs *[][]string) CmdFactory {
+	return func(name string, args ...string) *exec.Cmd {
+		if name == "ssh" {
+			return fakeRsyncCmd(0, remoteFiles)(name, args...)
+		}
+		*rsyncArgs = append(*rsyncArgs, args)
+		return fakeRsyncCmd(0, "Number of files: 1\n")(name, args...)
+	}
+}
+
+func TestBackup_FirstRunDryRun(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.FirstRunDryRun = true
+	ex := NewBackupExecutor(cfg)
+	var calls [][]string
+	ex.cmdFactory = firstRunCmd("movies\ntv-shows", &calls)
+
+	run := func(opts RunOptions) BackupRun {
+		t.Helper()
+		if err := ex.RunWithOptions(opts); err != nil {
+			t.Fatalf("RunWithOptions(%+v) = %v", opts, err)
+		}
+		ex.Wait(context.Background())
+		return *ex.LastRun()
+	}
+
+	// Unconfirmed runs against a non-empty destination stay dry runs.
+	for i := 0; i < 2; i++ {
+		last := run(RunOptions{})
+		if !last.DryRun || !hasArg(calls[len(calls)-1], "--dry-run") {
+			t.Fatalf("run %d: dry_run = %v, args = %v; want a forced dry run", i, last.DryRun, calls[len(calls)-1])
+		}
+		if !strings.Contains(last.Summary, "dry run") {
+			t.Errorf("summary = %q, want it to say dry run", last.Summary)
+		}
+		if !ex.AwaitingConfirmation() {
+			t.Error("AwaitingConfirmation() = false after a forced dry run")
+		}
+	}
+	if got := ex.Totals().TotalRuns; got != 0 {
+		t.Errorf("totals count %d runs, want dry runs left out", got)
+	}
+	if !ex.LastSuccess().IsZero() {
+		t.Error("LastSuccess() counts a dry run")
+	}
+
+	// A confirmed run is real, and later runs no longer need confirming.
+	for _, opts := range []RunOptions{{Confirmed: true}, {}} {
+		last := run(opts)
+		if last.DryRun || hasArg(calls[len(calls)-1], "--dry-run") {
+			t.Errorf("run %+v: dry_run = %v, args = %v; want a real run", opts, last.DryRun, calls[len(calls)-1])
+		}
+	}
+	if ex.AwaitingConfirmation() {
+		t.Error("AwaitingConfirmation() = true after a real run")
+	}
+}
+
+func TestBackup_FirstRunDryRun_EmptyDestination(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.FirstRunDryRun = true
+	ex := NewBackupExecutor(cfg)
+	var calls [][]string
+	ex.cmdFactory = firstRunCmd("", &calls)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ex.Wait(context.Background())
+	if last := ex.LastRun(); last.DryRun || hasArg(calls[0], "--dry-run") {
+		t.Errorf("dry_run = %v, args = %v; want a real run into an empty destination", last.DryRun, calls[0])
+	}
+}
+
+func TestBackup_ErrorOutput(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	stderr := "rsync: [sender] change_dir \"/mnt/plex-media/missing\" failed: No such file or directory (2)\n" +
+		"rsync error: some files/attrs were not transferred (see previous errors) (code 23)\n"
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		cmd := fakeRsyncCmd(23, "sending incremental file list\nmedia/movies/file1.mkv\n")(name, args...)
+		cmd.Env = append(cmd.Env, "GO_TEST_STDERR="+stderr)
+		return cmd
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ex.Wait(context.Background())
+
+	last := ex.LastRun()
+	if last.ErrorOutput != strings.TrimSpace(stderr) {
+		t.Errorf("error_output = %q, want only stderr %q", last.ErrorOutput, stderr)
+	}
+	logContent, err := ex.ReadLog(last.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logContent, "change_dir") || !strings.Contains(logContent, "file1.mkv") {
+		t.Errorf("combined log should still have both streams:\n%s", logContent)
+	}
+}
+
+func TestBackup_SlowWarning(t *testing.T) {
+	for _, tt := range []struct {
+		took     time.Duration
+		wantSlow bool
+	}{
+		{3 * time.Hour, true},
+		{90 * time.Minute, false},
+	} {
+		cfg := testConfig(t)
+		cfg.ExpectedDuration = time.Hour
+		ex := NewBackupExecutor(cfg)
+		clock := newFakeClock(time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC))
+		ex.clock = clock
+		sent := make(chan string, 2)
+		ex.notifiers = []configuredNotifier{
+			{cfg: NotifierConfig{Type: "fake", OnSlow: true}, Notifier: &fakeNotifier{name: "slow", sent: sent}},
+			{cfg: NotifierConfig{Type: "fake"}, Notifier: &fakeNotifier{name: "default", sent: sent}},
+		}
+		// rsync succeeds, but only after the clock has moved on
+		ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+			clock.Advance(tt.took)
+			return fakeRsyncCmd(0, "")(name, args...)
+		}
+
+		if err := ex.Run(); err != nil {
+			t.Fatal(err)
+		}
+		ex.Wait(context.Background())
+		ex.FlushNotifications(5 * time.Second)
+
+		last := ex.LastRun()
+		if last.Status != StatusSuccess || last.SlowWarning != tt.wantSlow {
+			t.Errorf("took %s: status = %s, slow_warning = %v; want success, %v", tt.took, last.Status, last.SlowWarning, tt.wantSlow)
+		}
+		var got []string
+		for len(sent) > 0 {
+			got = append(got, <-sent)
+		}
+		var want []string
+		if tt.wantSlow {
+			want = []string{"slow:success"} // only the notifier with on_slow
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("took %s: notifications = %v, want %v", tt.took, got, want)
+		}
+	}
+}
+
+func TestBackup_VerifySizes(t *testing.T) {
+	dryRunStats := func(pending string) string {
+		return "Number of files: 1,234\nTotal file size: 73,400,320 bytes\nTotal transferred file size: " + pending + " bytes\n"
+	}
+	for _, tt := range []struct {
+		name       string
+		pending    string
+		wantDest   int64
+		wantStatus BackupStatus
+	}{
+		{"in sync", "0", 73400320, StatusSuccess},
+		{"within tolerance", "4,096", 73396224, StatusSuccess},
+		{"mismatch", "52,428,800", 20971520, StatusWarning},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.VerifySizes = true
+			cfg.FilterFile = filepath.Join(t.TempDir(), "filter.rules")
+			os.WriteFile(cfg.FilterFile, []byte("- *.tmp\n"), 0644)
+			ex := NewBackupExecutor(cfg)
+			var dryRunArgs []string
+			ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+				if name == "rsync" && hasArg(args, "--dry-run") {
+					dryRunArgs = args
+					return fakeRsyncCmd(0, dryRunStats(tt.pending))(name, args...)
+				}
+				return fakeRsyncCmd(0, "")(name, args...)
+			}
+
+			if err := ex.Run(); err != nil {
+				t.Fatal(err)
+			}
+			ex.Wait(context.Background())
+
+			// The same transfer, so excludes and filters apply to the count
+			if !hasArg(dryRunArgs, "--filter=merge "+cfg.FilterFile) || dryRunArgs[len(dryRunArgs)-1] != "user@backup-host:/backups/plex/" {
+				t.Errorf("dry run args = %v, want the backup's filters and destination", dryRunArgs)
+			}
+			last := ex.LastRun()
+			if last.Status != tt.wantStatus || last.SourceSize != 73400320 || last.DestSize != tt.wantDest {
+				t.Errorf("status = %s, sizes = %d/%d; want %s, 73400320/%d", last.Status, last.SourceSize, last.DestSize, tt.wantStatus, tt.wantDest)
+			}
+			if last.SizeMismatch != (tt.wantStatus == StatusWarning) {
+				t.Errorf("size_mismatch = %v", last.SizeMismatch)
+			}
+		})
+	}
+
+	// Without verify_sizes nothing is measured
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		if hasArg(args, "--dry-run") {
+			t.Errorf("ran a dry run without verify_sizes: %v", args)
+		}
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ex.Wait(context.Background())
+}
+
+func TestBackup_VerifySizesCancelled(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.VerifySizes = true
+	ex := NewBackupExecutor(cfg)
+	verifying := make(chan struct{})
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		if hasArg(args, "--dry-run") {
+			close(verifying)
+			return sleepCmd(10*time.Second)(name, args...)
+		}
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-verifying:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the size check never started")
+	}
+	if !ex.Cancel() {
+		t.Fatal("Cancel() = false during the size check")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !ex.Wait(ctx) {
+		t.Fatal("the size check was not stopped by Cancel")
+	}
+	if last := ex.LastRun(); last.Status != StatusFailed || !strings.Contains(last.Summary, "cancelled") {
+		t.Errorf("run = %s (%s), want a cancelled failure", last.Status, last.Summary)
+	}
+}
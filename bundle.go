@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// bundleFiles are the state files carried by an export bundle, in the log
+// dir. Logs are deliberately left out.
+var bundleFiles = []string{"settings.json", "history.json", "stats.json"}
+
+// bundleManifestName is the manifest member every bundle starts with.
+const bundleManifestName = "manifest.json"
+
+// maxBundleMember bounds each member read on import; the real files are a
+// few hundred KB at most (history is capped at 100 runs).
+const maxBundleMember = 16 << 20
+
+// errRestoreBusy is returned by RestoreBundle while the run slot is taken.
+var errRestoreBusy = errors.New("cannot import while a backup is in progress")
+
+// BundleManifest describes an export bundle.
+type BundleManifest struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []string  `json:"files"`
+}
+
+// WriteBundle writes a tar.gz of the manifest and the state files in the
+// log dir (settings, history and lifetime stats) to w, for restoring on
+// another host with RestoreBundle. Missing files are skipped.
+func (ex *BackupExecutor) WriteBundle(w io.Writer) error {
+	contents := map[string][]byte{}
+	manifest := BundleManifest{Version: version, CreatedAt: ex.clock.Now()}
+	for _, name := range bundleFiles {
+		data, err := os.ReadFile(filepath.Join(ex.cfg.LogDir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		contents[name] = data
+		manifest.Files = append(manifest.Files, name)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(bundleManifestName, manifestData); err != nil {
+		return err
+	}
+	for _, name := range manifest.Files {
+		if err := add(name, contents[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readBundle reads and checks the members of a bundle. Only regular files
+// named like the manifest or one of bundleFiles are accepted, so a crafted
+// archive cannot write anywhere else.
+func readBundle(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	allowed := map[string]bool{bundleManifestName: true}
+	for _, name := range bundleFiles {
+		allowed[name] = true
+	}
+
+	members := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if !allowed[hdr.Name] {
+			return nil, fmt.Errorf("unexpected archive member %q", hdr.Name)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("archive member %q is not a regular file", hdr.Name)
+		}
+		if _, dup := members[hdr.Name]; dup {
+			return nil, fmt.Errorf("duplicate archive member %q", hdr.Name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleMember+1))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		if len(data) > maxBundleMember {
+			return nil, fmt.Errorf("archive member %q is too large", hdr.Name)
+		}
+		members[hdr.Name] = data
+	}
+	if _, ok := members[bundleManifestName]; !ok {
+		return nil, fmt.Errorf("archive has no %s; not an rsync-web export", bundleManifestName)
+	}
+	return members, nil
+}
+
+// RestoreBundle replaces settings, history and lifetime stats with those
+// in a bundle written by WriteBundle. Every member is parsed and validated
+// before anything is written; files missing from the bundle are left as
+// they are. It is refused while a backup or dry run is in progress.
+func (ex *BackupExecutor) RestoreBundle(r io.Reader) error {
+	members, err := readBundle(r)
+	if err != nil {
+		return err
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(members[bundleManifestName], &manifest); err != nil {
+		return fmt.Errorf("invalid %s: %w", bundleManifestName, err)
+	}
+	var settings TransferSettings
+	if data, ok := members["settings.json"]; ok {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("invalid settings.json: %w", err)
+		}
+		if err := ex.cfg.checkTransferSettings(settings); err != nil {
+			return fmt.Errorf("invalid settings.json: %w", err)
+		}
+	}
+	var runs []BackupRun
+	if data, ok := members["history.json"]; ok {
+		if err := json.Unmarshal(data, &runs); err != nil {
+			return fmt.Errorf("invalid history.json: %w", err)
+		}
+	}
+	var totals CumulativeStats
+	if data, ok := members["stats.json"]; ok {
+		if err := json.Unmarshal(data, &totals); err != nil {
+			return fmt.Errorf("invalid stats.json: %w", err)
+		}
+	}
+
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.running || ex.estimating {
+		return errRestoreBusy
+	}
+	if err := os.MkdirAll(ex.cfg.LogDir, 0755); err != nil {
+		return fmt.Errorf("creating log dir: %w", err)
+	}
+
+	if _, ok := members["settings.json"]; ok {
+		ex.cfg.ApplyTransferSettings(settings)
+		if err := ex.cfg.SaveTransferSettings(); err != nil {
+			return fmt.Errorf("saving settings: %w", err)
+		}
+	}
+	if _, ok := members["history.json"]; ok {
+		for i := range runs {
+			if runs[i].Status == StatusRunning {
+				runs[i].Status = StatusFailed
+				runs[i].Summary = interruptedSummary
+			}
+		}
+		ex.history = runs
+		ex.saveHistory()
+		ex.status = StatusIdle
+		if len(ex.history) > 0 {
+			ex.status = ex.history[0].Status
+		}
+	}
+	if _, ok := members["stats.json"]; ok {
+		ex.totals = totals
+		if err := ex.saveTotals(); err != nil {
+			return fmt.Errorf("saving stats: %w", err)
+		}
+	}
+
+	log.Info().Str("bundle_version", manifest.Version).Time("created_at", manifest.CreatedAt).
+		Strs("files", manifest.Files).Msg("restored settings and history from bundle")
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_ExportImportRoundTrip(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	srv.cfg.Schedule = "0 4 * * *"
+	srv.cfg.savedSchedule = "0 4 * * *"
+	if err := srv.cfg.SaveTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/export", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("GET /api/export = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	bundle := w.Body.Bytes()
+
+	members, err := readBundle(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("export is not a valid bundle: %v", err)
+	}
+	for _, name := range []string{"manifest.json", "settings.json", "history.json", "stats.json"} {
+		if _, ok := members[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+
+	// Import on a fresh host
+	dst, dstExecutor := testServer(t)
+	dstMux := http.NewServeMux()
+	dst.RegisterRoutes(dstMux)
+
+	w = httptest.NewRecorder()
+	dstMux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", "/api/import", bytes.NewReader(bundle))))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("POST /api/import = %d: %s", w.Code, w.Body.String())
+	}
+
+	if got, want := dstExecutor.History(), executor.History(); len(got) != 1 || got[0].ID != want[0].ID {
+		t.Errorf("imported history = %+v, want run %s", got, want[0].ID)
+	}
+	if got := dstExecutor.Totals(); got.TotalRuns != 1 {
+		t.Errorf("imported totals = %+v, want 1 run", got)
+	}
+	if dst.cfg.Schedule != "0 4 * * *" || dst.scheduler.Schedule() != "0 4 * * *" {
+		t.Errorf("schedule = %q (scheduler %q), want the imported 0 4 * * *", dst.cfg.Schedule, dst.scheduler.Schedule())
+	}
+	if _, err := os.Stat(filepath.Join(dst.cfg.LogDir, "history.json")); err != nil {
+		t.Errorf("history.json should be written on import: %v", err)
+	}
+}
+
+// tarGz builds a bundle-like archive from name/content pairs.
+func tarGz(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i < len(files); i += 2 {
+		tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[i+1]))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestRestoreBundle_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  []byte
+		wantErr string
+	}{
+		{"path traversal", tarGz(t, "manifest.json", "{}", "../../etc/passwd", "x"), "unexpected archive member"},
+		{"nested path", tarGz(t, "manifest.json", "{}", "logs/history.json", "[]"), "unexpected archive member"},
+		{"no manifest", tarGz(t, "history.json", "[]"), "manifest.json"},
+		{"invalid history", tarGz(t, "manifest.json", "{}", "history.json", "not json"), "history.json"},
+		{"not gzip", []byte("plain text"), "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := NewBackupExecutor(testConfig(t))
+			err := ex.RestoreBundle(bytes.NewReader(tt.bundle))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RestoreBundle() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(ex.cfg.LogDir, "history.json")); !os.IsNotExist(err) {
+				t.Error("a rejected bundle should not write anything")
+			}
+		})
+	}
+}
+
+func TestRestoreBundle_RefusedWhileRunning(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.mu.Lock()
+	ex.status = StatusRunning
+	ex.running = true
+	ex.mu.Unlock()
+
+	err := ex.RestoreBundle(bytes.NewReader(tarGz(t, "manifest.json", "{}", "history.json", "[]")))
+	if err != errRestoreBusy {
+		t.Errorf("RestoreBundle() error = %v, want %v", err, errRestoreBusy)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "time"
+
+// Clock tells the time. The executor, scheduler and watchdog read the time
+// through it so tests can substitute a frozen clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
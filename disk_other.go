@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// diskFree is not implemented on this platform; the free-space check is
+// skipped.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,114 @@
+package main
+
+import "strings"
+
+// maxDiffPaths bounds the paths listed per change type; the counts still
+// cover every change.
+const maxDiffPaths = 1000
+
+// ChangeGroup is one kind of change in a dry-run diff.
+type ChangeGroup struct {
+	Count int      `json:"count"`
+	Paths []string `json:"paths"`
+}
+
+// add records a change, listing the path while there is room.
+func (g *ChangeGroup) add(path string) {
+	g.Count++
+	if len(g.Paths) < maxDiffPaths {
+		g.Paths = append(g.Paths, path)
+	}
+}
+
+// DryRunDiff is what the next backup would change on the destination,
+// grouped from rsync's --itemize-changes output.
+type DryRunDiff struct {
+	New      ChangeGroup `json:"new"`
+	Modified ChangeGroup `json:"modified"`
+	Deleted  ChangeGroup `json:"deleted"`
+	// Metadata lists items whose content is unchanged but whose
+	// permissions, owner, group or times would be updated.
+	Metadata ChangeGroup `json:"metadata"`
+}
+
+// Change types reported by parseItemizeLine.
+const (
+	changeNew      = "new"
+	changeModified = "modified"
+	changeDeleted  = "deleted"
+	changeMetadata = "metadata"
+)
+
+// parseItemizeLine classifies one line of rsync --itemize-changes output.
+// The 11-character code is YXcstpoguax: Y is the update type ('<' sent,
+// '>' received, 'c' created locally, 'h' hard link, '.' attributes only,
+// '*' a message such as "*deleting"), X the file type, and the rest one
+// character per attribute, all '+' for a new item and '.' when unchanged.
+// Lines that are not itemized changes, or report no change, return false.
+func parseItemizeLine(line string) (kind, path string, ok bool) {
+	if len(line) < 13 || line[11] != ' ' {
+		return "", "", false
+	}
+	code, path := line[:11], line[12:]
+	if strings.HasPrefix(code, "*deleting") {
+		return changeDeleted, path, true
+	}
+	if !strings.ContainsRune("<>ch.", rune(code[0])) || !strings.ContainsRune("fdLDS", rune(code[1])) {
+		return "", "", false
+	}
+
+	attrs := strings.TrimRight(code[2:], " ")
+	switch {
+	case attrs != "" && strings.Trim(attrs, "+") == "":
+		return changeNew, path, true
+	case code[0] == '.':
+		if strings.Trim(attrs, ". ") == "" {
+			return "", "", false // unchanged, only listed with -ii
+		}
+		return changeMetadata, path, true
+	default:
+		return changeModified, path, true
+	}
+}
+
+// parseItemizeChanges groups rsync --itemize-changes output by change type.
+// rsync's --info=progress2 updates are separated by carriage returns, so
+// both line endings split the output.
+func parseItemizeChanges(out string) *DryRunDiff {
+	diff := &DryRunDiff{
+		New:      ChangeGroup{Paths: []string{}},
+		Modified: ChangeGroup{Paths: []string{}},
+		Deleted:  ChangeGroup{Paths: []string{}},
+		Metadata: ChangeGroup{Paths: []string{}},
+	}
+	lines := strings.FieldsFunc(out, func(r rune) bool { return r == '\n' || r == '\r' })
+	for _, line := range lines {
+		kind, path, ok := parseItemizeLine(line)
+		if !ok {
+			continue
+		}
+		switch kind {
+		case changeNew:
+			diff.New.add(path)
+		case changeModified:
+			diff.Modified.add(path)
+		case changeDeleted:
+			diff.Deleted.add(path)
+		case changeMetadata:
+			diff.Metadata.add(path)
+		}
+	}
+	return diff
+}
+
+// DryRun runs rsync with --dry-run --itemize-changes using the normal
+// backup arguments and reports what the next backup would create, modify,
+// delete or only update metadata for. Like Estimate, nothing is copied and
+// no history is written.
+func (ex *BackupExecutor) DryRun() (*DryRunDiff, error) {
+	out, err := ex.dryRun("--itemize-changes")
+	if err != nil {
+		return nil, err
+	}
+	return parseItemizeChanges(out), nil
+}
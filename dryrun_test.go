@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseItemizeLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantKind string
+		wantPath string
+	}{
+		{">f+++++++++ movies/New Movie (2025).mkv", changeNew, "movies/New Movie (2025).mkv"},
+		{"cd+++++++++ movies/New Movie (2025)/", changeNew, "movies/New Movie (2025)/"},
+		{"cL+++++++++ current -> movies", changeNew, "current -> movies"},
+		{"hf+++++++++ tv/copy.mkv => tv/orig.mkv", changeNew, "tv/copy.mkv => tv/orig.mkv"},
+		{">f.st...... library.db", changeModified, "library.db"},
+		{">f..t...... notes.txt", changeModified, "notes.txt"},
+		{"cLc.T...... current -> movies", changeModified, "current -> movies"},
+		{"*deleting   old/episode.mkv", changeDeleted, "old/episode.mkv"},
+		{"*deleting   old/", changeDeleted, "old/"},
+		{".d..t...... movies/", changeMetadata, "movies/"},
+		{".f...p..... script.sh", changeMetadata, "script.sh"},
+		{".f....og... shared.mkv", changeMetadata, "shared.mkv"},
+
+		// Not changes
+		{".f          unchanged.mkv", "", ""},
+		{".d..........  ./", "", ""},
+		{"sending incremental file list", "", ""},
+		{"      1,234,567  12%   10.50MB/s    0:01:23 (xfr#5, to-chk=100/200)", "", ""},
+		{"Number of files: 1,234 (reg: 1,000, dir: 234)", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		kind, path, ok := parseItemizeLine(tt.line)
+		if ok != (tt.wantKind != "") || kind != tt.wantKind || path != tt.wantPath {
+			t.Errorf("parseItemizeLine(%q) = %q, %q, %v; want %q, %q", tt.line, kind, path, ok, tt.wantKind, tt.wantPath)
+		}
+	}
+}
+
+func TestParseItemizeChanges(t *testing.T) {
+	out := "sending incremental file list\n" +
+		"      0   0%    0.00kB/s    0:00:00\r" +
+		"*deleting   old.mkv\n" +
+		".d..t...... ./\n" +
+		">f+++++++++ new.mkv\n" +
+		">f.st...... changed.mkv\n" +
+		"cd+++++++++ season 2/\n" +
+		"\n" +
+		"Number of files: 4 (reg: 3, dir: 1)\n"
+
+	diff := parseItemizeChanges(out)
+	if diff.New.Count != 2 || strings.Join(diff.New.Paths, ",") != "new.mkv,season 2/" {
+		t.Errorf("new = %+v", diff.New)
+	}
+	if diff.Modified.Count != 1 || diff.Modified.Paths[0] != "changed.mkv" {
+		t.Errorf("modified = %+v", diff.Modified)
+	}
+	if diff.Deleted.Count != 1 || diff.Deleted.Paths[0] != "old.mkv" {
+		t.Errorf("deleted = %+v", diff.Deleted)
+	}
+	if diff.Metadata.Count != 1 || diff.Metadata.Paths[0] != "./" {
+		t.Errorf("metadata = %+v", diff.Metadata)
+	}
+
+	// Counts keep going past the listed paths
+	many := strings.Repeat(">f+++++++++ file.mkv\n", maxDiffPaths+5)
+	if diff := parseItemizeChanges(many); diff.New.Count != maxDiffPaths+5 || len(diff.New.Paths) != maxDiffPaths {
+		t.Errorf("new = %d changes, %d paths; want %d, %d", diff.New.Count, len(diff.New.Paths), maxDiffPaths+5, maxDiffPaths)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	var gotArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeRsyncCmd(0, ">f+++++++++ new.mkv\n*deleting   old.mkv")(name, args...)
+	}
+
+	diff, err := ex.DryRun()
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if diff.New.Count != 1 || diff.Deleted.Count != 1 {
+		t.Errorf("DryRun() = %+v, want one new and one deleted file", diff)
+	}
+	if !hasArg(gotArgs, "--dry-run") || !hasArg(gotArgs, "--itemize-changes") {
+		t.Errorf("rsync args should include --dry-run --itemize-changes: %v", gotArgs)
+	}
+	if len(ex.History()) != 0 || ex.Status() != StatusIdle {
+		t.Errorf("dry run should not touch history or status, got %d runs, status %s", len(ex.History()), ex.Status())
+	}
+}
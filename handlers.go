@@ -1,15 +1,23 @@
 package main
 
 import (
+	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"net/http"
+	"os"
 
 	"github.com/rs/zerolog/log"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 type Server struct {
@@ -17,9 +25,47 @@ type Server struct {
 	scheduler *Scheduler
 	cfg       *Config
 	templates *template.Template
+
+	triggerLimiter minIntervalLimiter
+
+	// shuttingDown refuses new backups once shutdown has begun, see
+	// BeginShutdown.
+	shuttingDown atomic.Bool
 }
 
-func NewServer(cfg *Config, executor *BackupExecutor, scheduler *Scheduler) *Server {
+// shutdownRetryAfter is the Retry-After sent to triggers refused during
+// shutdown: long enough for a service manager to restart the server.
+const shutdownRetryAfter = 30 * time.Second
+
+// BeginShutdown makes backup triggers fail with 503 from now on, so one
+// arriving while the scheduler and HTTP server stop is refused cleanly
+// instead of racing them.
+func (s *Server) BeginShutdown() {
+	s.shuttingDown.Store(true)
+}
+
+// refuseDuringShutdown answers 503 with Retry-After, and reports true, once
+// BeginShutdown has been called.
+func (s *Server) refuseDuringShutdown(w http.ResponseWriter) bool {
+	if !s.shuttingDown.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", retryAfterSeconds(shutdownRetryAfter))
+	http.Error(w, "server is shutting down, try again later", http.StatusServiceUnavailable)
+	return true
+}
+
+// embeddedTemplates is the built-in copy of templates/, used when no
+// templates directory exists next to the binary.
+//
+//go:embed templates/*.html
+var embeddedTemplates embed.FS
+
+// templateDir is checked for on-disk templates, which take precedence over the
+// embedded ones so they can be customized without rebuilding.
+const templateDir = "templates"
+
+func NewServer(cfg *Config, executor *BackupExecutor, scheduler *Scheduler) (*Server, error) {
 	funcMap := template.FuncMap{
 		"formatTime": func(t time.Time) string {
 			if t.IsZero() {
@@ -41,52 +87,164 @@ func NewServer(cfg *Config, executor *BackupExecutor, scheduler *Scheduler) *Ser
 				return "idle"
 			}
 		},
+		"formatBytes": formatBytes,
 		"timeUntil": func(t time.Time) string {
 			if t.IsZero() {
 				return "—"
 			}
-			d := time.Until(t).Truncate(time.Second)
+			d := time.Until(t)
 			if d < 0 {
 				return "imminent"
 			}
-			h := int(d.Hours())
-			m := int(d.Minutes()) % 60
-			s := int(d.Seconds()) % 60
-			if h > 0 {
-				return fmt.Sprintf("%dh %dm %ds", h, m, s)
-			}
-			if m > 0 {
-				return fmt.Sprintf("%dm %ds", m, s)
-			}
-			return fmt.Sprintf("%ds", s)
+			return formatDuration(d)
 		},
 	}
 
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseGlob(
-		filepath.Join("templates", "*.html"),
-	))
+	tmpl, err := loadTemplates(funcMap)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Server{
 		executor:  executor,
 		scheduler: scheduler,
 		cfg:       cfg,
 		templates: tmpl,
+	}, nil
+}
+
+// formatDuration renders d to the second, e.g. "6h 3m 12s" or "45s".
+func formatDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%dh %dm %ds", h, m, s)
+	}
+	if m > 0 {
+		return fmt.Sprintf("%dm %ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// formatBytes renders a byte count using binary units, e.g. "4.2 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// loadTemplates parses the HTML templates from templateDir if it contains any,
+// falling back to the copies embedded in the binary.
+func loadTemplates(funcMap template.FuncMap) (*template.Template, error) {
+	pattern := filepath.Join(templateDir, "*.html")
+	if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+		tmpl, err := template.New("").Funcs(funcMap).ParseFiles(matches...)
+		if err != nil {
+			return nil, fmt.Errorf("parsing templates from %s: %w", templateDir, err)
+		}
+		return tmpl, nil
 	}
+
+	tmpl, err := template.New("").Funcs(funcMap).ParseFS(embeddedTemplates, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parsing embedded templates: %w", err)
+	}
+	return tmpl, nil
 }
 
+// RegisterRoutes registers the dashboard and API on mux, under base_path
+// when one is set. With read_only, only GET, HEAD and OPTIONS requests get
+// through.
 func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	if s.cfg.BasePath != "" || s.cfg.ReadOnly {
+		routes := http.NewServeMux()
+		var handler http.Handler = routes
+		if s.cfg.ReadOnly {
+			handler = readOnlyMiddleware(handler)
+		}
+		if s.cfg.BasePath != "" {
+			// The mux redirects the bare base path to base_path + "/"
+			mux.Handle(s.cfg.BasePath+"/", http.StripPrefix(s.cfg.BasePath, handler))
+		} else {
+			mux.Handle("/", handler)
+		}
+		mux = routes
+	}
 	mux.HandleFunc("/", s.handleDashboard)
 	mux.HandleFunc("/api/status", s.handleStatus)
 	mux.HandleFunc("/api/backup", s.handleTriggerBackup)
 	mux.HandleFunc("/api/history", s.handleHistory)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/metrics/throughput", s.handleThroughput)
+	mux.HandleFunc("/api/history/", s.handleHistoryRun)
+	mux.HandleFunc("/api/logs", s.handleLogList)
 	mux.HandleFunc("/api/logs/", s.handleLogs)
+	mux.HandleFunc("/api/logs.zip", s.handleLogsArchive)
+	mux.HandleFunc("/api/export", s.handleExport)
+	mux.HandleFunc("/api/import", s.handleImport)
+	mux.HandleFunc("/api/current/log", s.handleCurrentLog)
+	mux.HandleFunc("/api/logs/usage", s.handleLogUsage)
 	mux.HandleFunc("/api/remote-check", s.handleRemoteCheck)
+	mux.HandleFunc("/api/test-connection", s.handleTestConnection)
+	mux.HandleFunc("/api/remote/trust", s.handleRemoteTrust)
+	mux.HandleFunc("/api/estimate", s.handleEstimate)
+	mux.HandleFunc("/api/dry-run", s.handleDryRun)
 	mux.HandleFunc("/api/settings", s.handleSettings)
+	mux.HandleFunc("/api/lock", s.handleLock(true))
+	mux.HandleFunc("/api/unlock", s.handleLock(false))
+	mux.HandleFunc("/api/version", s.handleVersion)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
 	mux.HandleFunc("/fragment/status", s.handleStatusFragment)
 	mux.HandleFunc("/fragment/history", s.handleHistoryFragment)
 	mux.HandleFunc("/fragment/remote-warning", s.handleRemoteWarningFragment)
 	mux.HandleFunc("/fragment/settings", s.handleSettingsFragment)
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(s.staticFS())))
+}
+
+// basePath returns the URL prefix the dashboard is served under, for
+// redirects and links: base_path, behind the X-Forwarded-Prefix of a
+// reverse proxy that strips its own prefix before forwarding. An invalid
+// header is ignored.
+func (s *Server) basePath(r *http.Request) string {
+	prefix, err := normalizeBasePath(r.Header.Get("X-Forwarded-Prefix"))
+	if err != nil {
+		log.Debug().Err(err).Msg("ignoring X-Forwarded-Prefix")
+		prefix = ""
+	}
+	return prefix + s.cfg.BasePath
+}
+
+// redirectHome sends a non-htmx form post back to the dashboard.
+func (s *Server) redirectHome(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, s.basePath(r)+"/", http.StatusSeeOther)
+}
+
+// embeddedStatic is the built-in copy of the static/ assets.
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticFS returns the filesystem for /static/: the configured static_dir on
+// disk if set (handy during development), otherwise the embedded assets.
+func (s *Server) staticFS() http.FileSystem {
+	if s.cfg.StaticDir != "" {
+		return http.Dir(s.cfg.StaticDir)
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		panic("embedded static assets missing: " + err.Error())
+	}
+	return http.FS(sub)
 }
 
 // --- Page handlers ---
@@ -98,6 +256,8 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := s.dashboardData()
+	data.CSRFToken = ensureCSRFToken(w, r)
+	data.BasePath = s.basePath(r)
 	if err := s.templates.ExecuteTemplate(w, "index.html", data); err != nil {
 		log.Error().Err(err).Msg("template error")
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -117,16 +277,40 @@ func (s *Server) handleTriggerBackup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !requireCSRF(w, r) {
+		return
+	}
+	if s.refuseDuringShutdown(w) {
+		return
+	}
+	opts, err := backupOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Path != "" {
+		if opts.Path, err = s.cfg.Subpath(opts.Path); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if ok, wait := s.triggerLimiter.allow(s.cfg.MinTriggerInterval, time.Now()); !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		http.Error(w, "backup triggered too recently, try again later", http.StatusTooManyRequests)
+		return
+	}
 
-	if err := s.executor.Run(); err != nil {
+	opts.Verbose, _ = strconv.ParseBool(r.URL.Query().Get("verbose"))
+	opts.Confirmed, _ = strconv.ParseBool(r.URL.Query().Get("confirm"))
+	if err := s.executor.RunWithOptions(opts); err != nil {
 		// If htmx request, return a fragment
 		if r.Header.Get("HX-Request") == "true" {
 			w.Header().Set("HX-Reswap", "none")
-			w.WriteHeader(http.StatusConflict)
+			w.WriteHeader(runErrorStatus(err))
 			w.Write([]byte(err.Error()))
 			return
 		}
-		http.Error(w, err.Error(), http.StatusConflict)
+		http.Error(w, err.Error(), runErrorStatus(err))
 		return
 	}
 
@@ -137,12 +321,263 @@ func (s *Server) handleTriggerBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	s.redirectHome(w, r)
+}
+
+// maxNoteLength bounds a run note, in characters.
+const maxNoteLength = 200
+
+// backupOptions reads the optional run note, subpath and bandwidth limit
+// for POST /api/backup, from a JSON body ({"note": "...", "path": "...",
+// "bwlimit": 500}) or the note, path and bwlimit form fields. The path is
+// validated by the caller.
+func backupOptions(r *http.Request) (RunOptions, error) {
+	var opts RunOptions
+	var bwlimit string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Note    string          `json:"note"`
+			Path    string          `json:"path"`
+			BWLimit json.RawMessage `json:"bwlimit"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil && err != io.EOF {
+			return opts, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		opts.Note, opts.Path = body.Note, body.Path
+		// bwlimit may be a number of KB/s or a string such as "5M"
+		if len(body.BWLimit) > 0 && string(body.BWLimit) != "null" {
+			if err := json.Unmarshal(body.BWLimit, &bwlimit); err != nil {
+				bwlimit = string(body.BWLimit)
+			}
+		}
+	} else {
+		opts.Note, opts.Path = r.FormValue("note"), r.FormValue("path")
+		bwlimit = r.FormValue("bwlimit")
+	}
+	opts.Note = strings.TrimSpace(opts.Note)
+	if utf8.RuneCountInString(opts.Note) > maxNoteLength {
+		return opts, fmt.Errorf("note must be at most %d characters", maxNoteLength)
+	}
+	if bwlimit = strings.TrimSpace(bwlimit); bwlimit != "" {
+		bw, err := parseBandwidth(bwlimit)
+		if err != nil {
+			return opts, fmt.Errorf("bwlimit: %v", err)
+		}
+		opts.BandwidthLimit = &bw
+	}
+	return opts, nil
+}
+
+// formBool reads a checkbox field: browsers send "on" when it is checked and
+// omit it otherwise; API clients may also send true/false or 1/0.
+func formBool(v string) bool {
+	if v == "on" {
+		return true
+	}
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// runErrorStatus maps an error from starting a backup to an HTTP status:
+// 423 while backups are locked, 409 otherwise (already running, not
+// configured).
+func runErrorStatus(err error) int {
+	if errors.Is(err, ErrBackupsLocked) {
+		return http.StatusLocked
+	}
+	return http.StatusConflict
+}
+
+// handleLock returns a handler that sets (POST /api/lock) or clears
+// (POST /api/unlock) the maintenance lock.
+func (s *Server) handleLock(locked bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireCSRF(w, r) {
+			return
+		}
+
+		if err := s.cfg.SetLocked(locked); err != nil {
+			log.Error().Err(err).Msg("failed to save lock state")
+			http.Error(w, "failed to save lock state", http.StatusInternalServerError)
+			return
+		}
+		log.Info().Bool("locked", locked).Msg("backup lock changed")
+
+		if r.Header.Get("HX-Request") == "true" {
+			s.handleStatusFragment(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"locked": locked})
+	}
 }
 
+// handleHistory returns the backup history, newest first. Optional ?status=
+// filters by run status and ?offset=/?limit= page through the results; the
+// number of matching runs before paging is reported in X-Total-Count.
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	status := BackupStatus(q.Get("status"))
+	switch status {
+	case "", StatusSuccess, StatusWarning, StatusFailed:
+	default:
+		http.Error(w, "status must be one of success, warning, failed", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(q.Get("limit"), 0)
+	if err != nil || limit < 0 {
+		http.Error(w, "limit must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+
+	page, total := filterHistory(s.executor.History(), status, offset, limit)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.executor.History())
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(page)
+}
+
+// handleStats returns the lifetime totals plus the success rate over the
+// last ?last=N runs (default successRateWindow; 0 for the whole history).
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	last, err := queryInt(r.URL.Query().Get("last"), successRateWindow)
+	if err != nil || last < 0 {
+		http.Error(w, "last must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	res := struct {
+		CumulativeStats
+		SuccessRate SuccessRate `json:"success_rate"`
+	}{s.executor.Totals(), s.executor.SuccessRate(last)}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleHistoryRun serves per-run actions under /api/history/{id}/...
+func (s *Server) handleHistoryRun(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/history/")
+	id, action, _ := strings.Cut(rest, "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		s.handleGetRun(w, r, id)
+	case "retry":
+		s.handleRetryRun(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleGetRun returns a single run, past or in progress, as JSON.
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	run, ok := s.executor.RunByID(id)
+	if !ok {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// handleRetryRun starts a fresh backup (with the current settings) for a past
+// run that failed or finished with warnings.
+func (s *Server) handleRetryRun(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+	if s.refuseDuringShutdown(w) {
+		return
+	}
+
+	run, ok := s.executor.RunByID(id)
+	if !ok {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if run.Status != StatusFailed && run.Status != StatusWarning {
+		http.Error(w, "only failed or warning runs can be retried", http.StatusConflict)
+		return
+	}
+	if ok, wait := s.triggerLimiter.allow(s.cfg.MinTriggerInterval, time.Now()); !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		http.Error(w, "backup triggered too recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := s.executor.RunWithOptions(RunOptions{RetryOf: id}); err != nil {
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Reswap", "none")
+			w.WriteHeader(runErrorStatus(err))
+			w.Write([]byte(err.Error()))
+			return
+		}
+		http.Error(w, err.Error(), runErrorStatus(err))
+		return
+	}
+
+	log.Info().Str("retry_of", id).Msg("retry backup triggered")
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Trigger", "backup-started")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	s.redirectHome(w, r)
+}
+
+// queryInt parses an integer query parameter, returning def when it is empty.
+func queryInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// filterHistory returns the runs matching status (all runs if empty), skipping
+// the first offset matches and returning at most limit of them (no limit if
+// zero), along with the total number of matches.
+func filterHistory(runs []BackupRun, status BackupStatus, offset, limit int) ([]BackupRun, int) {
+	matched := make([]BackupRun, 0, len(runs))
+	for _, run := range runs {
+		if status == "" || run.Status == status {
+			matched = append(matched, run)
+		}
+	}
+
+	total := len(matched)
+	if offset >= total {
+		return []BackupRun{}, total
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total
 }
 
 func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
@@ -152,8 +587,78 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "log filename required", http.StatusBadRequest)
 		return
 	}
+	s.writeLog(w, r, filename, r.URL.Query().Get("run"))
+}
+
+// handleCurrentLog serves the log of the running backup, so the dashboard
+// can poll it without knowing the filename, or 204 No Content when idle.
+// It takes the same ?tail and ?lines parameters as /api/logs/{file}.
+func (s *Server) handleCurrentLog(w http.ResponseWriter, r *http.Request) {
+	cur := s.executor.Current()
+	if cur == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("X-Run-ID", cur.ID)
+	// With single_log_file, cur.LogFile is shared with every earlier run
+	s.writeLog(w, r, cur.LogFile, cur.ID)
+}
 
-	content, err := s.executor.ReadLog(filename)
+// writeLog writes a log file as plain text, or as an HTML fragment for htmx.
+// With single_log_file, a non-empty runID limits it to that run's section.
+func (s *Server) writeLog(w http.ResponseWriter, r *http.Request, filename, runID string) {
+	// Optional ?tail=<bytes> or ?lines=<n> limit the response to the end of the log
+	tail := r.URL.Query().Get("tail")
+	lines := r.URL.Query().Get("lines")
+	if tail != "" && lines != "" {
+		http.Error(w, "use either tail or lines, not both", http.StatusBadRequest)
+		return
+	}
+	var tailBytes int64
+	var lineCount int
+	if tail != "" {
+		n, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || n <= 0 {
+			http.Error(w, "tail must be a positive number of bytes", http.StatusBadRequest)
+			return
+		}
+		tailBytes = n
+	}
+	if lines != "" {
+		n, err := strconv.Atoi(lines)
+		if err != nil || n <= 0 {
+			http.Error(w, "lines must be a positive number", http.StatusBadRequest)
+			return
+		}
+		lineCount = n
+	}
+	if !s.cfg.SingleLogFile {
+		runID = ""
+	}
+
+	var content string
+	var err error
+	switch {
+	case runID != "":
+		content, err = s.executor.ReadRunLog(runID)
+		if errors.Is(err, os.ErrNotExist) {
+			// A run that has just started may not have written its section yet
+			if cur := s.executor.Current(); cur != nil && cur.ID == runID {
+				content, err = "", nil
+			}
+		}
+		if tailBytes > 0 && int64(len(content)) > tailBytes {
+			content = content[int64(len(content))-tailBytes:]
+		} else if lineCount > 0 {
+			content = lastLines(content, lineCount)
+		}
+	case tailBytes > 0:
+		content, err = s.executor.ReadLogTail(filename, tailBytes)
+	case lineCount > 0:
+		content, err = s.executor.ReadLogLines(filename, lineCount)
+	default:
+		content, err = s.executor.ReadLog(filename)
+	}
 	if err != nil {
 		http.Error(w, "log not found", http.StatusNotFound)
 		return
@@ -162,7 +667,19 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	// If htmx request, return just the log content wrapped in a pre tag
 	if r.Header.Get("HX-Request") == "true" {
 		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(`<pre class="log-content">` + template.HTMLEscapeString(content) + `</pre>`))
+		run, ok := s.executor.RunByLogFile(filename)
+		if runID != "" {
+			run, ok = s.executor.RunByID(runID)
+		}
+		if ok {
+			if run.Command != "" {
+				w.Write([]byte(`<div class="log-command"><code>` + template.HTMLEscapeString(run.Command) + `</code></div>`))
+			}
+			if run.ErrorOutput != "" {
+				w.Write([]byte(`<div class="log-stderr"><strong>rsync errors</strong><pre>` + template.HTMLEscapeString(run.ErrorOutput) + `</pre></div>`))
+			}
+		}
+		w.Write([]byte(`<pre class="log-content">` + highlightLog(content) + `</pre>`))
 		return
 	}
 
@@ -170,6 +687,137 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(content))
 }
 
+// logErrorMarkers and logWarningMarkers pick out the log lines worth
+// finding in a long run, matched case-insensitively. Errors are checked
+// first.
+var (
+	logErrorMarkers   = []string{"rsync error", "rsync: ", "failed", "permission denied", "no such file or directory", "error:"}
+	logWarningMarkers = []string{"vanished", "warning", "cannot delete", "skipping"}
+)
+
+// logLineClass returns the CSS class for a log line: "log-error",
+// "log-warning", or "" for an ordinary line.
+func logLineClass(line string) string {
+	lower := strings.ToLower(line)
+	for _, m := range logErrorMarkers {
+		if strings.Contains(lower, m) {
+			return "log-error"
+		}
+	}
+	for _, m := range logWarningMarkers {
+		if strings.Contains(lower, m) {
+			return "log-warning"
+		}
+	}
+	return ""
+}
+
+// highlightLog HTML-escapes log content for the log viewer, wrapping error
+// and warning lines in spans with their logLineClass.
+func highlightLog(content string) string {
+	var b strings.Builder
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if class := logLineClass(line); class != "" {
+			b.WriteString(`<span class="` + class + `">` + template.HTMLEscapeString(line) + `</span>`)
+		} else {
+			b.WriteString(template.HTMLEscapeString(line))
+		}
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func (s *Server) handleLogsArchive(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("rsync-web-logs-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// Streamed directly to the client; once writing has started the status can
+	// no longer be changed, so failures are only logged.
+	if err := s.executor.WriteLogArchive(w); err != nil {
+		log.Error().Err(err).Msg("failed to write log archive")
+	}
+}
+
+// handleExport downloads settings, history and lifetime stats as a tar.gz
+// bundle for POST /api/import on another host.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("rsync-web-export-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// Streamed like the log archive, so failures can only be logged
+	if err := s.executor.WriteBundle(w); err != nil {
+		log.Error().Err(err).Msg("failed to write export bundle")
+	}
+}
+
+// maxImportSize bounds the request body of POST /api/import.
+const maxImportSize = 32 << 20
+
+// handleImport restores a bundle from GET /api/export, sent as the request
+// body.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+
+	if err := s.executor.RestoreBundle(http.MaxBytesReader(w, r.Body, maxImportSize)); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errRestoreBusy) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// A restored settings.json may carry a different schedule
+	if s.cfg.Schedule != s.scheduler.Schedule() {
+		if err := s.scheduler.Reschedule(s.cfg.Schedule); err != nil {
+			log.Error().Err(err).Msg("failed to reschedule backups")
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleThroughput returns the bytes, duration and speed of each finished
+// run in history, oldest first, for charting.
+func (s *Server) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.executor.Throughput())
+}
+
+// handleLogList lists the backup logs on disk with their size and modtime,
+// flagging those no run in history refers to.
+func (s *Server) handleLogList(w http.ResponseWriter, r *http.Request) {
+	logs, err := s.executor.ListLogs()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list logs")
+		http.Error(w, "failed to read log directory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
+
+func (s *Server) handleLogUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.executor.LogUsage()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to compute log dir usage")
+		http.Error(w, "failed to read log directory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
 func (s *Server) handleRemoteCheck(w http.ResponseWriter, r *http.Request) {
 	nonEmpty, files, err := s.executor.CheckRemotePath()
 
@@ -188,6 +836,178 @@ func (s *Server) handleRemoteCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
+// handleTestConnection checks SSH login for the host and key in the request
+// form, falling back to the saved settings, so the settings form can verify
+// them before saving.
+func (s *Server) handleTestConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	host := strings.TrimSpace(r.FormValue("remote_host"))
+	if host == "" {
+		host = s.cfg.RemoteHost
+	}
+	key := strings.TrimSpace(r.FormValue("ssh_key_path"))
+	if key == "" {
+		key = s.cfg.SSHKeyPath
+	}
+	if host == "" || (key == "" && s.cfg.SSHKeyRequired()) {
+		http.Error(w, "remote_host and ssh_key_path are required", http.StatusBadRequest)
+		return
+	}
+
+	type result struct {
+		OK     bool   `json:"ok"`
+		Error  string `json:"error,omitempty"`
+		Reason string `json:"reason,omitempty"`
+		Output string `json:"output,omitempty"`
+	}
+
+	res := result{OK: true}
+	if err := s.executor.TestConnection(host, key); err != nil {
+		res = result{Error: err.Error()}
+		var connErr *ConnectionError
+		if errors.As(err, &connErr) {
+			res.Reason = connErr.Reason
+			res.Output = connErr.Output
+		}
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		if res.OK {
+			fmt.Fprint(w, `<div class="status-hint success-hint">Connection OK.</div>`)
+			return
+		}
+		fmt.Fprintf(w, `<div class="status-hint failed-hint">%s`, template.HTMLEscapeString(res.Error))
+		if res.Output != "" {
+			fmt.Fprintf(w, `<pre class="log-content">%s</pre>`, template.HTMLEscapeString(res.Output))
+		}
+		fmt.Fprint(w, `</div>`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleRemoteTrust re-scans the remote host's keys and pins them in
+// known_hosts_file (POST /api/remote/trust), to recover from a changed host
+// key without logging in to the server. It answers 409 when host keys are
+// not checked or there is no remote host, and 502 when the scan fails.
+func (s *Server) handleRemoteTrust(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+
+	status := http.StatusConflict
+	err := s.executor.CanTrustRemoteHost()
+	var keys []HostKey
+	if err == nil {
+		status = http.StatusBadGateway
+		keys, err = s.executor.TrustRemoteHost()
+	}
+	if err != nil {
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<div class="status-hint failed-hint">%s</div>`, template.HTMLEscapeString(err.Error()))
+			return
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Info().Str("host", keys[0].Host).Int("keys", len(keys)).Msg("remote host keys pinned")
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<div class="status-hint success-hint">Host keys pinned:`)
+		for _, k := range keys {
+			fmt.Fprintf(w, `<br><code>%s %s</code>`, template.HTMLEscapeString(k.Type), template.HTMLEscapeString(k.Fingerprint))
+		}
+		fmt.Fprint(w, `</div>`)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+// handleEstimate reports the source size and what the next backup would
+// transfer, from an rsync dry run.
+func (s *Server) handleEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+
+	est, err := s.executor.Estimate()
+	if err != nil {
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<div class="status-hint failed-hint">Estimate failed: %s</div>`, template.HTMLEscapeString(err.Error()))
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<div class="status-hint success-hint">Source: %d files, %s. The next backup would transfer %d files, %s.</div>`,
+			est.NumFiles, formatBytes(est.TotalSize), est.FilesToTransfer, formatBytes(est.BytesToTransfer))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(est)
+}
+
+// handleDryRun reports what the next backup would change, grouped into new,
+// modified, deleted and metadata-only items, from an rsync dry run.
+func (s *Server) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCSRF(w, r) {
+		return
+	}
+
+	diff, err := s.executor.DryRun()
+	if err != nil {
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<div class="status-hint failed-hint">Dry run failed: %s</div>`, template.HTMLEscapeString(err.Error()))
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<div class="status-hint success-hint">The next backup would add %d, modify %d and delete %d items, and update metadata on %d.</div>`,
+			diff.New.Count, diff.Modified.Count, diff.Deleted.Count, diff.Metadata.Count)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
 func (s *Server) handleRemoteWarningFragment(w http.ResponseWriter, r *http.Request) {
 	// Only check if there's no backup history (first run scenario)
 	if len(s.executor.History()) > 0 {
@@ -213,10 +1033,77 @@ func (s *Server) handleRemoteWarningFragment(w http.ResponseWriter, r *http.Requ
 		`</div>`, template.HTMLEscapeString(preview))
 }
 
+// handleVersion reports the build the server is running.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildInfo())
+}
+
+// --- Health handlers ---
+
+// handleHealthz is a cheap liveness check: if the process can serve HTTP, it is alive.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports ready only once transfer settings are configured and
+// the log directory is writable, so backups can actually run. With ?deep=1
+// the remote host must also accept an SSH login.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	type result struct {
+		Status string `json:"status"`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// The SSH result is cached, so frequent deep probes stay cheap
+	deep, _ := strconv.ParseBool(r.URL.Query().Get("deep"))
+
+	res := result{Status: "ready"}
+	if !s.cfg.TransferConfigured() {
+		res = result{Status: "not ready", Reason: "transfer settings not configured"}
+	} else if err := checkDirWritable(s.cfg.LogDir); err != nil {
+		res = result{Status: "not ready", Reason: "log directory not writable: " + err.Error()}
+	} else if deep {
+		if err := s.executor.CheckReachable(); err != nil {
+			res = result{Status: "not ready", Reason: "remote not reachable: " + err.Error()}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// checkDirWritable verifies dir exists (creating it if needed) and that a file
+// can be created in it.
+func checkDirWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // --- Fragment handlers (for htmx partial updates) ---
 
+// handleStatusFragment renders the status card. A card rendered during a
+// run sends that run's ID back as ?running= on its next poll; once the run
+// has finished, the response carries a backup-finished HX-Trigger event
+// with the run's outcome so the page can react without further polling.
 func (s *Server) handleStatusFragment(w http.ResponseWriter, r *http.Request) {
 	data := s.dashboardData()
+	if id := r.URL.Query().Get("running"); id != "" {
+		if trigger, ok := s.finishedTrigger(id); ok {
+			w.Header().Set("HX-Trigger", trigger)
+		}
+	}
 	w.Header().Set("Content-Type", "text/html")
 	if err := s.templates.ExecuteTemplate(w, "status-card", data); err != nil {
 		log.Error().Err(err).Msg("template error")
@@ -224,6 +1111,22 @@ func (s *Server) handleStatusFragment(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// finishedTrigger returns the HX-Trigger value announcing that the run with
+// the given ID has finished, or false while it is still running or unknown.
+func (s *Server) finishedTrigger(id string) (string, bool) {
+	run, ok := s.executor.RunByID(id)
+	if !ok || run.Status == StatusRunning {
+		return "", false
+	}
+	trigger, err := json.Marshal(map[string]any{
+		"backup-finished": map[string]any{"id": run.ID, "status": run.Status},
+	})
+	if err != nil {
+		return "", false
+	}
+	return string(trigger), true
+}
+
 func (s *Server) handleHistoryFragment(w http.ResponseWriter, r *http.Request) {
 	data := s.dashboardData()
 	w.Header().Set("Content-Type", "text/html")
@@ -242,6 +1145,9 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(s.cfg.GetTransferSettings())
 
 	case http.MethodPost:
+		if !requireCSRF(w, r) {
+			return
+		}
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "invalid form data", http.StatusBadRequest)
 			return
@@ -249,14 +1155,22 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 
 		settings := TransferSettings{
 			SourcePath:   strings.TrimSpace(r.FormValue("source_path")),
-			SourceIsFile: r.FormValue("source_is_file") == "on",
+			SourceIsFile: formBool(r.FormValue("source_is_file")),
 			RemoteHost:   strings.TrimSpace(r.FormValue("remote_host")),
 			RemotePath:   strings.TrimSpace(r.FormValue("remote_path")),
 			SSHKeyPath:   strings.TrimSpace(r.FormValue("ssh_key_path")),
+			Schedule:     strings.TrimSpace(r.FormValue("schedule")),
 		}
+		if settings.Schedule == s.cfg.ConfigSchedule() {
+			settings.Schedule = "" // same as config.yaml, so no override needed
+		}
+		settings.Locked = s.cfg.Locked() // only changed via /api/lock and /api/unlock
 
 		// Validate required fields
-		if settings.SourcePath == "" || settings.RemoteHost == "" || settings.RemotePath == "" || settings.SSHKeyPath == "" {
+		// Remote host and SSH key may both be left empty for a local
+		// destination, and the key alone when ssh_use_agent is set. The
+		// source path is unused when source_paths is set in config.yaml.
+		if (settings.SourcePath == "" && len(s.cfg.SourcePaths) == 0) || settings.RemotePath == "" || (settings.RemoteHost != "" && settings.SSHKeyPath == "" && s.cfg.SSHKeyRequired()) {
 			if r.Header.Get("HX-Request") == "true" {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte(`<div class="status-hint failed-hint">All fields are required.</div>`))
@@ -265,6 +1179,15 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "all fields are required", http.StatusBadRequest)
 			return
 		}
+		if err := s.cfg.checkTransferSettings(settings); err != nil {
+			if r.Header.Get("HX-Request") == "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `<div class="status-hint failed-hint">%s</div>`, template.HTMLEscapeString(err.Error()))
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		s.cfg.ApplyTransferSettings(settings)
 		if err := s.cfg.SaveTransferSettings(); err != nil {
@@ -278,15 +1201,22 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		log.Info().Str("source", settings.SourcePath).Str("dest", settings.RemoteHost+":"+settings.RemotePath).Msg("settings updated")
+		if s.cfg.Schedule != s.scheduler.Schedule() {
+			// Already validated above, so this cannot fail
+			if err := s.scheduler.Reschedule(s.cfg.Schedule); err != nil {
+				log.Error().Err(err).Msg("failed to reschedule backups")
+			}
+		}
+
+		log.Info().Str("source", settings.SourcePath).Str("dest", s.cfg.Destination()).Msg("settings updated")
 
 		if r.Header.Get("HX-Request") == "true" {
 			w.Header().Set("HX-Trigger", "settings-saved")
-			w.Header().Set("HX-Redirect", "/")
+			w.Header().Set("HX-Redirect", s.basePath(r)+"/")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		s.redirectHome(w, r)
 
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -305,15 +1235,47 @@ func (s *Server) handleSettingsFragment(w http.ResponseWriter, r *http.Request)
 // --- Data ---
 
 type DashboardData struct {
-	Status     BackupStatus     `json:"status"`
-	LastRun    *BackupRun       `json:"last_run"`
-	NextRun    time.Time        `json:"next_run"`
-	History    []BackupRun      `json:"history"`
-	Schedule   string           `json:"schedule"`
-	Source     string           `json:"source"`
-	Dest       string           `json:"dest"`
-	Configured bool             `json:"configured"`
-	Settings   TransferSettings `json:"settings"`
+	Status     BackupStatus  `json:"status"`
+	Running    bool          `json:"running"`
+	LastStatus BackupStatus  `json:"last_status"`
+	LastRun    *BackupRun    `json:"last_run"`
+	Current    *BackupRun    `json:"current,omitempty"`
+	ETA        string        `json:"eta,omitempty"`
+	LastSkip   *ScheduleSkip `json:"last_skip,omitempty"`
+	NextRun    time.Time     `json:"next_run"`
+	History    []BackupRun   `json:"history"`
+	Schedule   string        `json:"schedule"`
+	Source     string        `json:"source"`
+	Dest       string        `json:"dest"`
+	Configured bool          `json:"configured"`
+	Locked     bool          `json:"locked"`
+	// AwaitingConfirmation is set while first_run_dry_run holds back the
+	// first real backup until it is confirmed.
+	AwaitingConfirmation bool `json:"awaiting_confirmation"`
+	// InstanceName is instance_name, the hostname unless configured.
+	InstanceName string `json:"instance_name"`
+	// ReadOnly hides the controls that would be refused with read_only.
+	ReadOnly bool `json:"read_only"`
+	// RsyncVersion is the local rsync version, empty if rsync was not found.
+	RsyncVersion string `json:"rsync_version"`
+	// LastSuccess is when the most recent successful run ended, nil if
+	// there has been none; LastSuccessAgo is the time since as text, e.g.
+	// "6h 3m 12s ago", or "never". Warnings count with
+	// last_success_includes_warnings.
+	LastSuccess    *time.Time `json:"last_success"`
+	LastSuccessAgo string     `json:"last_success_ago"`
+	// CheckHostKeys is set when known_hosts_file is, so the host key can be
+	// re-pinned from the dashboard.
+	CheckHostKeys bool `json:"check_host_keys"`
+	// LocalFreeSpace is the free space on a local destination, in bytes.
+	LocalFreeSpace *int64           `json:"local_free_space,omitempty"`
+	Settings       TransferSettings `json:"settings"`
+	Totals         CumulativeStats  `json:"totals"`
+	SuccessRate    SuccessRate      `json:"success_rate"`
+	LogUsage       LogUsage         `json:"log_usage"`
+	CSRFToken      string           `json:"-"`
+	// BasePath prefixes the page's links, see Server.basePath.
+	BasePath string `json:"-"`
 }
 
 func (s *Server) dashboardData() DashboardData {
@@ -326,15 +1288,66 @@ func (s *Server) dashboardData() DashboardData {
 		status = StatusRunning
 	}
 
+	var eta string
+	if current != nil {
+		eta = formatETA(current.Progress, s.executor.clock.Now())
+		if !s.executor.progress2Supported() {
+			eta = "unavailable (rsync < " + minProgress2Version + ")"
+		}
+	}
+
+	// Outcome of the last finished run, independent of any run in progress
+	lastStatus := StatusIdle
+	if last != nil {
+		lastStatus = last.Status
+	}
+
+	usage, err := s.executor.LogUsage()
+	if err != nil {
+		log.Warn().Err(err).Msg("could not compute log dir usage")
+	}
+
+	var localFree *int64
+	if s.cfg.LocalDestination() && s.cfg.RemotePath != "" {
+		if free, err := s.executor.LocalFreeSpace(); err == nil {
+			n := int64(free)
+			localFree = &n
+		}
+	}
+
+	var lastSuccess *time.Time
+	lastSuccessAgo := "never"
+	if t := s.executor.LastSuccessAt(s.cfg.LastSuccessIncludesWarnings); !t.IsZero() {
+		lastSuccess = &t
+		lastSuccessAgo = formatDuration(max(s.executor.clock.Now().Sub(t), 0)) + " ago"
+	}
+
 	return DashboardData{
-		Status:     status,
-		LastRun:    last,
-		NextRun:    s.scheduler.NextRun(),
-		History:    history,
-		Schedule:   s.cfg.Schedule,
-		Source:     s.cfg.SourcePath,
-		Dest:       s.cfg.RemoteHost + ":" + s.cfg.RemotePath,
-		Configured: s.cfg.TransferConfigured(),
-		Settings:   s.cfg.GetTransferSettings(),
+		Status:               status,
+		Running:              current != nil,
+		LastStatus:           lastStatus,
+		LastRun:              last,
+		Current:              current,
+		ETA:                  eta,
+		LastSkip:             s.executor.LastSkip(),
+		NextRun:              s.scheduler.NextRun(),
+		History:              history,
+		Schedule:             s.cfg.Schedule,
+		Source:               s.cfg.SourceDisplay(),
+		Dest:                 s.cfg.Destination(),
+		Configured:           s.cfg.TransferConfigured(),
+		Locked:               s.cfg.Locked(),
+		AwaitingConfirmation: s.executor.AwaitingConfirmation(),
+		InstanceName:         s.cfg.InstanceName,
+		ReadOnly:             s.cfg.ReadOnly,
+		RsyncVersion:         s.executor.RsyncVersion(),
+		CheckHostKeys:        s.cfg.KnownHostsFile != "",
+		LastSuccess:          lastSuccess,
+		LastSuccessAgo:       lastSuccessAgo,
+		LocalFreeSpace:       localFree,
+		Settings:             s.cfg.GetTransferSettings(),
+		Totals:               s.executor.Totals(),
+		SuccessRate:          s.executor.SuccessRate(successRateWindow),
+		LogUsage:             usage,
 	}
 }
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -46,11 +55,12 @@ func testServer(t *testing.T) (*Server, *BackupExecutor) {
 
 	const tmplText = `
 {{define "index.html"}}
-<html><body>
+<html><head><base href="{{.BasePath}}/"></head><body>
 <div id="status">{{.Status}}</div>
 <div id="source">{{.Source}}</div>
 <div id="dest">{{.Dest}}</div>
 <div id="configured">{{.Configured}}</div>
+<div id="csrf">{{.CSRFToken}}</div>
 </body></html>
 {{end}}
 
@@ -79,6 +89,16 @@ func testServer(t *testing.T) (*Server, *BackupExecutor) {
 	return srv, executor
 }
 
+// testCSRFToken is sent as both the CSRF cookie and header by withCSRF.
+const testCSRFToken = "test-csrf-token"
+
+// withCSRF attaches a matching CSRF cookie and header to a state-changing request.
+func withCSRF(req *http.Request) *http.Request {
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+	req.Header.Set(csrfHeaderName, testCSRFToken)
+	return req
+}
+
 func TestHandler_Dashboard(t *testing.T) {
 	srv, _ := testServer(t)
 
@@ -146,6 +166,80 @@ func TestHandler_APIStatus(t *testing.T) {
 	}
 }
 
+func TestHandler_APIStatus_RunningWithLastStatus(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusSuccess, LogFile: "backup-20260101-030000.log"}}
+	executor.status = StatusSuccess
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	decode := func() DashboardData {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		var data DashboardData
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Fatalf("failed to decode JSON: %v", err)
+		}
+		return data
+	}
+
+	data := decode()
+	if data.Running || data.LastStatus != StatusSuccess {
+		t.Errorf("idle: running = %v, last_status = %q, want false/success", data.Running, data.LastStatus)
+	}
+
+	// A new run has started: the last result is still reported separately
+	executor.mu.Lock()
+	executor.current = &BackupRun{ID: "20260102-030000", Status: StatusRunning, StartTime: time.Now()}
+	executor.status = StatusRunning
+	executor.mu.Unlock()
+
+	if !executor.IsRunning() {
+		t.Error("IsRunning() = false while a run is in progress")
+	}
+	data = decode()
+	if !data.Running || data.Status != StatusRunning || data.LastStatus != StatusSuccess {
+		t.Errorf("running: running = %v, status = %q, last_status = %q, want true/running/success", data.Running, data.Status, data.LastStatus)
+	}
+	if data.ETA != "calculating" {
+		t.Errorf("eta = %q before any progress, want calculating", data.ETA)
+	}
+}
+
+func TestStatusFragment_ShowsLastStatusWhileRunning(t *testing.T) {
+	cfg := testConfig(t)
+	executor := NewBackupExecutor(cfg)
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusFailed, LogFile: "backup-20260101-030000.log"}}
+	executor.current = &BackupRun{ID: "20260102-030000", Status: StatusRunning, StartTime: time.Now()}
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chdir(t, t.TempDir()) // render the real, embedded templates
+	srv, err := NewServer(cfg, executor, sched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/fragment/status", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "(last: failed)") {
+		t.Errorf("status fragment should show the last result while running, got: %s", body)
+	}
+	if !strings.Contains(body, "Backup Running") {
+		t.Errorf("status fragment should disable the trigger button while running, got: %s", body)
+	}
+}
+
 func TestHandler_TriggerBackup(t *testing.T) {
 	srv, executor := testServer(t)
 
@@ -153,7 +247,7 @@ func TestHandler_TriggerBackup(t *testing.T) {
 	srv.RegisterRoutes(mux)
 
 	// POST should trigger a backup
-	req := httptest.NewRequest("POST", "/api/backup", nil)
+	req := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
@@ -167,461 +261,2509 @@ func TestHandler_TriggerBackup(t *testing.T) {
 	}
 }
 
-func TestHandler_TriggerBackup_MethodNotAllowed(t *testing.T) {
-	srv, _ := testServer(t)
+func TestHandler_TriggerBackup_Verbose(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	for _, tt := range []struct {
+		query    string
+		wantFlag string
+	}{
+		{"?verbose=1", "rsync -avvvz "},
+		{"", "rsync -avz "},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", "/api/backup"+tt.query, nil)))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST /api/backup%s status = %d, want 303", tt.query, w.Code)
+		}
+		if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		last := executor.LastRun()
+		if !strings.HasPrefix(last.Command, tt.wantFlag) || last.Verbose != (tt.query != "") {
+			t.Errorf("POST /api/backup%s ran %q (verbose %v), want %s...", tt.query, last.Command, last.Verbose, tt.wantFlag)
+		}
+	}
+}
 
+func TestHandler_TriggerBackup_ConfirmFirstRun(t *testing.T) {
+	srv, executor := testServer(t)
+	srv.cfg.FirstRunDryRun = true
+	var calls [][]string
+	executor.cmdFactory = firstRunCmd("movies", &calls)
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/backup", nil)
+	trigger := func(target string) BackupRun {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", target, nil)))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST %s status = %d, want 303: %s", target, w.Code, w.Body.String())
+		}
+		executor.Wait(context.Background())
+		return *executor.LastRun()
+	}
+
+	if last := trigger("/api/backup"); !last.DryRun {
+		t.Fatal("first backup into a non-empty destination should be a dry run")
+	}
 	w := httptest.NewRecorder()
-	mux.ServeHTTP(w, req)
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/status", nil))
+	if !strings.Contains(w.Body.String(), `"awaiting_confirmation":true`) {
+		t.Errorf("status should be awaiting confirmation: %s", w.Body.String())
+	}
 
-	if w.Code != http.StatusMethodNotAllowed {
-		t.Errorf("GET /api/backup status = %d, want 405", w.Code)
+	if last := trigger("/api/backup?confirm=1"); last.DryRun || hasArg(calls[len(calls)-1], "--dry-run") {
+		t.Errorf("confirmed backup ran with --dry-run: %v", calls[len(calls)-1])
 	}
 }
 
-func TestHandler_TriggerBackup_Conflict(t *testing.T) {
+func TestHandler_TriggerBackup_Subpath(t *testing.T) {
 	srv, executor := testServer(t)
-	// Make the backup slow so it's still running
+	var rsyncArgs []string
 	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
-		return exec.Command("sleep", "5")
+		rsyncArgs = args
+		return fakeRsyncCmd(0, "")(name, args...)
 	}
-
+	source := t.TempDir()
+	executor.cfg.SourcePath = source
+	os.MkdirAll(filepath.Join(source, "movies", "2024"), 0755)
+	os.MkdirAll(filepath.Join(source, "tv"), 0755)
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	// Start first backup
-	req1 := httptest.NewRequest("POST", "/api/backup", nil)
-	w1 := httptest.NewRecorder()
-	mux.ServeHTTP(w1, req1)
-
-	// Wait until running
-	if err := waitForStatus(executor, StatusRunning, 5*time.Second); err != nil {
-		t.Fatal(err)
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"movies/2024", "movies/2024"},
+		{source + "/tv/", "tv"},
+	} {
+		req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader("path="+url.QueryEscape(tt.path))))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST /api/backup path=%s status = %d, want 303: %s", tt.path, w.Code, w.Body.String())
+		}
+		executor.Wait(context.Background())
+
+		if got := executor.LastRun().Path; got != tt.want {
+			t.Errorf("path = %q, want %q", got, tt.want)
+		}
+		// Only the source narrows; --relative recreates it under the destination
+		want := source + "/./" + tt.want + "/"
+		if !hasArg(rsyncArgs, "--relative") || rsyncArgs[len(rsyncArgs)-2] != want ||
+			rsyncArgs[len(rsyncArgs)-1] != "user@backup-host:/backups/plex/" {
+			t.Errorf("rsync args = %v, want --relative and source %s", rsyncArgs, want)
+		}
 	}
 
-	// Try second backup — should return 409
-	req2 := httptest.NewRequest("POST", "/api/backup", nil)
-	w2 := httptest.NewRecorder()
-	mux.ServeHTTP(w2, req2)
-
-	if w2.Code != http.StatusConflict {
-		t.Errorf("second POST /api/backup status = %d, want 409", w2.Code)
+	for _, path := range []string{"../etc", "movies/../../etc", "/etc/passwd", source + "-other", ".", source, "music"} {
+		req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader(`{"path": "`+path+`"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("POST /api/backup path=%s status = %d, want 400", path, w.Code)
+		}
 	}
 }
 
-func TestHandler_TriggerBackup_Htmx(t *testing.T) {
+func TestHandler_TriggerBackup_BandwidthLimit(t *testing.T) {
 	srv, executor := testServer(t)
-
+	executor.cmdFactory = fakeRsyncCmd(0, "")
+	executor.cfg.BandwidthLimit = 5000
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	// htmx POST
-	req := httptest.NewRequest("POST", "/api/backup", nil)
-	req.Header.Set("HX-Request", "true")
+	for _, tt := range []struct {
+		contentType string
+		body        string
+		wantArg     string
+	}{
+		{"application/x-www-form-urlencoded", "bwlimit=800", "--bwlimit=800"},
+		{"application/json", `{"bwlimit": "2M"}`, "--bwlimit=2048"},
+		{"application/json", `{"bwlimit": 0}`, ""},
+		{"", "", "--bwlimit=5000"},
+	} {
+		req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader(tt.body)))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST /api/backup %q status = %d, want 303: %s", tt.body, w.Code, w.Body.String())
+		}
+		executor.Wait(context.Background())
+
+		command := executor.LastRun().Command
+		if tt.wantArg == "" {
+			if strings.Contains(command, "--bwlimit") {
+				t.Errorf("bwlimit=0: command = %q, want no --bwlimit", command)
+			}
+		} else if !strings.Contains(command, tt.wantArg) || strings.Count(command, "--bwlimit") != 1 {
+			t.Errorf("body %q: command = %q, want a single %s", tt.body, command, tt.wantArg)
+		}
+	}
+
+	// The override is not persisted
+	if executor.cfg.BandwidthLimit != 5000 {
+		t.Errorf("bandwidth_limit = %d after override, want 5000", executor.cfg.BandwidthLimit)
+	}
+
+	req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader("bwlimit=fast")))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /api/backup bwlimit=fast status = %d, want 400", w.Code)
+	}
+}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("htmx POST /api/backup status = %d, want 200", w.Code)
+func TestHandler_BasePath(t *testing.T) {
+	srv, executor := testServer(t)
+	srv.cfg.BasePath = "/backups"
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	for _, tt := range []struct {
+		path string
+		want int
+	}{
+		{"/backups/", http.StatusOK},
+		{"/backups/api/status", http.StatusOK},
+		{"/backups/static/style.css", http.StatusOK},
+		{"/backups", http.StatusMovedPermanently},
+		{"/api/status", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, w.Code, tt.want)
+		}
 	}
 
-	if w.Header().Get("HX-Trigger") != "backup-started" {
-		t.Errorf("expected HX-Trigger header, got: %q", w.Header().Get("HX-Trigger"))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/backups/", nil))
+	if !strings.Contains(w.Body.String(), `<base href="/backups/">`) {
+		t.Errorf("dashboard does not set the base href: %s", w.Body.String())
 	}
 
-	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
-		t.Fatal(err)
+	for _, tt := range []struct {
+		forwardedPrefix string
+		wantLocation    string
+	}{
+		{"", "/backups/"},
+		{"/proxy", "/proxy/backups/"},
+		{"//evil.example", "/backups/"},
+	} {
+		req := withCSRF(httptest.NewRequest("POST", "/backups/api/backup", nil))
+		if tt.forwardedPrefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", tt.forwardedPrefix)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		executor.Wait(context.Background())
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("X-Forwarded-Prefix %q: status = %d, Location = %q; want 303 to %s",
+				tt.forwardedPrefix, w.Code, w.Header().Get("Location"), tt.wantLocation)
+		}
 	}
 }
 
-func TestHandler_APIHistory(t *testing.T) {
+func TestHandler_RemoteTrust(t *testing.T) {
 	srv, executor := testServer(t)
-
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
+	trust := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", "/api/remote/trust", nil)))
+		return w
+	}
 
-	// Run a backup so there's history
-	executor.Run()
-	waitForStatus(executor, StatusSuccess, 10*time.Second)
+	// Host keys are not checked without known_hosts_file
+	if w := trust(); w.Code != http.StatusConflict {
+		t.Errorf("without known_hosts_file: status = %d, want 409", w.Code)
+	}
 
-	req := httptest.NewRequest("GET", "/api/history", nil)
-	w := httptest.NewRecorder()
-	mux.ServeHTTP(w, req)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(knownHosts, []byte("other-host ssh-ed25519 AAAAOTHER\nbackup-host,10.0.0.5 ssh-rsa AAAAOLD\n"), 0600)
+	srv.cfg.KnownHostsFile = knownHosts
+	const newKey = "AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	var scanned []string
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		if name != "ssh-keyscan" {
+			t.Errorf("ran %s, want ssh-keyscan", name)
+		}
+		scanned = args
+		return fakeRsyncCmd(0, "# backup-host:22 SSH-2.0-OpenSSH_9.6\nbackup-host ssh-ed25519 "+newKey+"\n")(name, args...)
+	}
 
+	w := trust()
 	if w.Code != http.StatusOK {
-		t.Errorf("GET /api/history status = %d, want 200", w.Code)
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if strings.Join(scanned, " ") != "-T 10 backup-host" {
+		t.Errorf("ssh-keyscan args = %v, want -T 10 backup-host", scanned)
+	}
+	var resp struct {
+		Keys []HostKey `json:"keys"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Keys) != 1 || resp.Keys[0].Fingerprint != "SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU" {
+		t.Errorf("keys = %+v, want the scanned ed25519 key", resp.Keys)
 	}
 
-	var history []BackupRun
-	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
-		t.Fatalf("failed to decode history: %v", err)
+	// The stale key is replaced and other hosts are kept
+	content, _ := os.ReadFile(knownHosts)
+	want := "other-host ssh-ed25519 AAAAOTHER\nbackup-host ssh-ed25519 " + newKey + "\n"
+	if string(content) != want {
+		t.Errorf("known_hosts = %q, want %q", content, want)
 	}
-	if len(history) < 1 {
-		t.Error("expected at least 1 history entry")
+
+	// A failed scan leaves the file alone
+	executor.cmdFactory = fakeRsyncCmd(1, "")
+	if w := trust(); w.Code != http.StatusBadGateway {
+		t.Errorf("failed scan: status = %d, want 502", w.Code)
+	}
+	if after, _ := os.ReadFile(knownHosts); string(after) != want {
+		t.Errorf("known_hosts changed after a failed scan: %q", after)
 	}
 }
 
-func TestHandler_APILogs(t *testing.T) {
+func TestDashboardData_LastSuccess(t *testing.T) {
 	srv, executor := testServer(t)
+	clock := newFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	executor.clock = clock
+
+	data := srv.dashboardData()
+	if data.LastSuccess != nil || data.LastSuccessAgo != "never" {
+		t.Errorf("empty history: last_success = %v, %q; want nil, never", data.LastSuccess, data.LastSuccessAgo)
+	}
+
+	success := time.Date(2024, 3, 1, 5, 57, 30, 0, time.UTC)
+	warning := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	executor.history = []BackupRun{
+		{ID: "4", Status: StatusFailed, EndTime: time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)},
+		{ID: "3", Status: StatusSuccess, DryRun: true, EndTime: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{ID: "2", Status: StatusWarning, EndTime: warning},
+		{ID: "1", Status: StatusSuccess, EndTime: success},
+	}
 
+	data = srv.dashboardData()
+	if data.LastSuccess == nil || !data.LastSuccess.Equal(success) || data.LastSuccessAgo != "6h 2m 30s ago" {
+		t.Errorf("last_success = %v, %q; want %s, 6h 2m 30s ago", data.LastSuccess, data.LastSuccessAgo, success)
+	}
+
+	srv.cfg.LastSuccessIncludesWarnings = true
+	data = srv.dashboardData()
+	if data.LastSuccess == nil || !data.LastSuccess.Equal(warning) || data.LastSuccessAgo != "3h 0m 0s ago" {
+		t.Errorf("with warnings: last_success = %v, %q; want %s, 3h 0m 0s ago", data.LastSuccess, data.LastSuccessAgo, warning)
+	}
+}
+
+func TestHandler_TriggerBackup_Note(t *testing.T) {
+	srv, executor := testServer(t)
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	// Run a backup to create a log file
-	executor.Run()
-	waitForStatus(executor, StatusSuccess, 10*time.Second)
-
-	last := executor.LastRun()
-	if last == nil {
-		t.Fatal("expected a history entry")
+	for _, tt := range []struct {
+		contentType string
+		body        string
+		wantNote    string
+	}{
+		{"application/x-www-form-urlencoded", "note=pre-upgrade+snapshot", "pre-upgrade snapshot"},
+		{"application/json", `{"note": "  before moving disks "}`, "before moving disks"},
+		{"", "", ""},
+	} {
+		req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader(tt.body)))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST /api/backup (%s) status = %d, want 303: %s", tt.body, w.Code, w.Body.String())
+		}
+		if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if got := executor.LastRun().Note; got != tt.wantNote {
+			t.Errorf("note = %q, want %q", got, tt.wantNote)
+		}
 	}
 
-	req := httptest.NewRequest("GET", "/api/logs/"+last.LogFile, nil)
+	// The note is part of the run in the API
 	w := httptest.NewRecorder()
-	mux.ServeHTTP(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("GET /api/logs/%s status = %d, want 200", last.LogFile, w.Code)
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/history", nil))
+	if !strings.Contains(w.Body.String(), `"note":"before moving disks"`) {
+		t.Errorf("GET /api/history should include the note: %s", w.Body.String())
 	}
 
-	body := w.Body.String()
-	if !strings.Contains(body, "Backup started at") {
-		t.Errorf("log should contain 'Backup started at', got: %s", body)
+	req := withCSRF(httptest.NewRequest("POST", "/api/backup", strings.NewReader("note="+strings.Repeat("x", maxNoteLength+1))))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /api/backup with an overlong note = %d, want 400", w.Code)
 	}
 }
 
-func TestHandler_APILogs_NotFound(t *testing.T) {
+func TestHandler_TriggerBackup_MethodNotAllowed(t *testing.T) {
 	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/logs/nonexistent.log", nil)
+	req := httptest.NewRequest("GET", "/api/backup", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Errorf("GET /api/logs/nonexistent.log status = %d, want 404", w.Code)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/backup status = %d, want 405", w.Code)
 	}
 }
 
-func TestHandler_APILogs_Htmx(t *testing.T) {
+func TestHandler_LockAndUnlock(t *testing.T) {
 	srv, executor := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	// Create a log file
-	os.WriteFile(filepath.Join(executor.cfg.LogDir, "test.log"), []byte("rsync log data"), 0644)
+	post := func(path string) *httptest.ResponseRecorder {
+		req := withCSRF(httptest.NewRequest("POST", path, nil))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
 
-	req := httptest.NewRequest("GET", "/api/logs/test.log", nil)
-	req.Header.Set("HX-Request", "true")
-	w := httptest.NewRecorder()
-	mux.ServeHTTP(w, req)
+	if w := post("/api/lock"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"locked":true`) {
+		t.Fatalf("POST /api/lock = %d %s, want 200 locked", w.Code, w.Body.String())
+	}
+	if w := post("/api/backup"); w.Code != http.StatusLocked {
+		t.Errorf("POST /api/backup while locked status = %d, want 423", w.Code)
+	}
+	if executor.IsRunning() {
+		t.Error("no backup should start while locked")
+	}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("status = %d, want 200", w.Code)
+	// The lock is persisted in settings.json and survives a restart
+	reloaded := &Config{LogDir: srv.cfg.LogDir, Schedule: srv.cfg.Schedule}
+	if err := reloaded.LoadTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Locked() {
+		t.Error("lock should be restored from settings.json")
 	}
 
-	ct := w.Header().Get("Content-Type")
-	if !strings.Contains(ct, "text/html") {
-		t.Errorf("htmx response Content-Type = %q, want text/html", ct)
+	// The status payload reports it for the dashboard banner
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var data DashboardData
+	json.NewDecoder(w.Body).Decode(&data)
+	if !data.Locked {
+		t.Error("status should report locked")
 	}
 
-	body := w.Body.String()
-	if !strings.Contains(body, "<pre") {
-		t.Errorf("htmx response should wrap in <pre>, got: %s", body)
+	if w := post("/api/unlock"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"locked":false`) {
+		t.Fatalf("POST /api/unlock = %d %s, want 200 unlocked", w.Code, w.Body.String())
 	}
-	if !strings.Contains(body, "rsync log data") {
-		t.Errorf("htmx response should contain log data, got: %s", body)
+	if w := post("/api/backup"); w.Code != http.StatusSeeOther {
+		t.Errorf("POST /api/backup after unlock status = %d, want 303", w.Code)
+	}
+	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
 	}
 }
 
-func TestHandler_StatusFragment(t *testing.T) {
+func TestHandler_Lock_RejectsGetAndMissingCSRF(t *testing.T) {
 	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/fragment/status", nil)
+	req := httptest.NewRequest("GET", "/api/lock", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("GET /fragment/status = %d, want 200", w.Code)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/lock status = %d, want 405", w.Code)
 	}
 
-	body := w.Body.String()
-	if !strings.Contains(body, "status-card") {
-		t.Errorf("fragment should contain status-card class, got: %s", body)
+	req = httptest.NewRequest("POST", "/api/lock", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || srv.cfg.Locked() {
+		t.Errorf("POST /api/lock without CSRF status = %d, locked = %v, want 403 and unlocked", w.Code, srv.cfg.Locked())
 	}
 }
 
-func TestHandler_HistoryFragment(t *testing.T) {
-	srv, _ := testServer(t)
+func TestStatusFragment_LockedBanner(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.locked.Store(true)
+	executor := NewBackupExecutor(cfg)
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
 
+	chdir(t, t.TempDir()) // render the real, embedded templates
+	srv, err := NewServer(cfg, executor, sched)
+	if err != nil {
+		t.Fatal(err)
+	}
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/fragment/history", nil)
+	req := httptest.NewRequest("GET", "/fragment/status", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("GET /fragment/history = %d, want 200", w.Code)
-	}
-
 	body := w.Body.String()
-	if !strings.Contains(body, "history") {
-		t.Errorf("fragment should contain history div, got: %s", body)
+	if !strings.Contains(body, "Backups are locked.") || !strings.Contains(body, `hx-post="api/unlock"`) {
+		t.Errorf("status fragment should show the locked banner, got: %s", body)
+	}
+	if strings.Contains(body, `hx-post="api/backup"`) {
+		t.Error("Run Backup Now should be disabled while locked")
 	}
 }
 
-func TestHandler_RemoteCheck_NonEmpty(t *testing.T) {
-	srv, executor := testServer(t)
-	// Fake SSH that returns file listing
-	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestHelperProcess", "--"}
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = append(os.Environ(),
-			"GO_TEST_PROCESS=1",
-			"GO_TEST_EXIT_CODE=0",
-			"GO_TEST_OUTPUT=movies\ntv-shows",
-		)
-		return cmd
+func TestHandler_ReadOnly(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ReadOnly = true
+	os.MkdirAll(cfg.LogDir, 0755)
+	executor := NewBackupExecutor(cfg)
+	executor.cmdFactory = fakeRsyncCmd(0, "ok")
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusFailed, LogFile: "backup-20260101-030000.log"}}
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	chdir(t, t.TempDir()) // render the real, embedded templates
+	srv, err := NewServer(cfg, executor, sched)
+	if err != nil {
+		t.Fatal(err)
+	}
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/remote-check", nil)
-	w := httptest.NewRecorder()
-	mux.ServeHTTP(w, req)
+	for _, path := range []string{"/api/backup", "/api/settings", "/api/lock", "/api/history/20260101-030000/retry"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", path, nil)))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("POST %s status = %d, want 403", path, w.Code)
+		}
+	}
+	if executor.Current() != nil || cfg.Locked() {
+		t.Error("a refused request should not start a backup or lock backups")
+	}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("GET /api/remote-check status = %d, want 200", w.Code)
+	for _, path := range []string{"/", "/api/status", "/api/history", "/api/settings", "/fragment/status"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", path, w.Code)
+		}
 	}
 
-	var result struct {
-		NonEmpty bool     `json:"non_empty"`
-		Files    []string `json:"files"`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "hx-post=") || strings.Contains(body, "<form") {
+		t.Errorf("read-only dashboard should hide every control, got: %s", body)
 	}
-	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
-		t.Fatalf("failed to decode JSON: %v", err)
+	if !strings.Contains(body, "Read-only dashboard") {
+		t.Errorf("dashboard should say it is read-only, got: %s", body)
 	}
-	if !result.NonEmpty {
+}
+
+func TestHandler_TriggerBackup_Conflict(t *testing.T) {
+	srv, executor := testServer(t)
+	// Make the backup slow so it's still running
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", "5")
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Start first backup
+	req1 := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
+	w1 := httptest.NewRecorder()
+	mux.ServeHTTP(w1, req1)
+
+	// Wait until running
+	if err := waitForStatus(executor, StatusRunning, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, executor)
+
+	// Try second backup — should return 409
+	req2 := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
+	w2 := httptest.NewRecorder()
+	mux.ServeHTTP(w2, req2)
+
+	if w2.Code != http.StatusConflict {
+		t.Errorf("second POST /api/backup status = %d, want 409", w2.Code)
+	}
+}
+
+func TestHandler_TriggerBackup_RateLimited(t *testing.T) {
+	srv, executor := testServer(t)
+	srv.cfg.MinTriggerInterval = time.Minute
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req1 := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
+	w1 := httptest.NewRecorder()
+	mux.ServeHTTP(w1, req1)
+	if w1.Code != http.StatusSeeOther {
+		t.Fatalf("first POST /api/backup status = %d, want 303", w1.Code)
+	}
+	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Even though the first run finished, the trigger is still within the interval
+	req2 := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
+	w2 := httptest.NewRecorder()
+	mux.ServeHTTP(w2, req2)
+
+	if w2.Code != http.StatusTooManyRequests {
+		t.Errorf("second POST /api/backup status = %d, want 429", w2.Code)
+	}
+	if ra := w2.Header().Get("Retry-After"); ra == "" || ra == "0" {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", ra)
+	}
+	if n := len(executor.History()); n != 1 {
+		t.Errorf("history length = %d, want 1 (second trigger should not run)", n)
+	}
+}
+
+func TestHandler_TriggerBackup_ShuttingDown(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	srv.BeginShutdown()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", "/api/backup", nil)))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /api/backup during shutdown status = %d, want 503", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "30" {
+		t.Errorf("Retry-After = %q, want 30", ra)
+	}
+	if executor.Current() != nil || len(executor.History()) != 0 {
+		t.Error("no backup should start once shutdown has begun")
+	}
+
+	// Retries start a backup too
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusFailed, ExitCode: 255}}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withCSRF(httptest.NewRequest("POST", "/api/history/20260101-030000/retry", nil)))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("POST retry during shutdown status = %d, Retry-After = %q, want 503 and 30", w.Code, w.Header().Get("Retry-After"))
+	}
+	if executor.Current() != nil || len(executor.History()) != 1 {
+		t.Error("no retry should start once shutdown has begun")
+	}
+}
+
+func TestHandler_TriggerBackup_Htmx(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// htmx POST
+	req := withCSRF(httptest.NewRequest("POST", "/api/backup", nil))
+	req.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("htmx POST /api/backup status = %d, want 200", w.Code)
+	}
+
+	if w.Header().Get("HX-Trigger") != "backup-started" {
+		t.Errorf("expected HX-Trigger header, got: %q", w.Header().Get("HX-Trigger"))
+	}
+
+	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler_APIHistory(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Run a backup so there's history
+	executor.Run()
+	waitForStatus(executor, StatusSuccess, 10*time.Second)
+
+	req := httptest.NewRequest("GET", "/api/history", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/history status = %d, want 200", w.Code)
+	}
+
+	var history []BackupRun
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	if len(history) < 1 {
+		t.Error("expected at least 1 history entry")
+	}
+}
+
+// sampleHistory returns a history of n runs cycling through success, warning, and failed.
+func sampleHistory(n int) []BackupRun {
+	statuses := []BackupStatus{StatusSuccess, StatusWarning, StatusFailed}
+	runs := make([]BackupRun, n)
+	for i := range runs {
+		runs[i] = BackupRun{ID: fmt.Sprintf("run-%02d", i), Status: statuses[i%3]}
+	}
+	return runs
+}
+
+func TestFilterHistory(t *testing.T) {
+	runs := sampleHistory(10)
+
+	tests := []struct {
+		name      string
+		status    BackupStatus
+		offset    int
+		limit     int
+		wantIDs   []string
+		wantTotal int
+	}{
+		{"no filter", "", 0, 0, nil, 10},
+		{"limit", "", 0, 3, []string{"run-00", "run-01", "run-02"}, 10},
+		{"offset and limit", "", 8, 5, []string{"run-08", "run-09"}, 10},
+		{"offset past end", "", 20, 5, []string{}, 10},
+		{"status filter", StatusFailed, 0, 0, []string{"run-02", "run-05", "run-08"}, 3},
+		{"status filter with paging", StatusSuccess, 1, 2, []string{"run-03", "run-06"}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := filterHistory(runs, tt.status, tt.offset, tt.limit)
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			if tt.wantIDs == nil {
+				if len(page) != len(runs) {
+					t.Errorf("got %d runs, want all %d", len(page), len(runs))
+				}
+				return
+			}
+			var ids []string
+			for _, r := range page {
+				ids = append(ids, r.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestHandler_APIHistory_Paginated(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = sampleHistory(10)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/history?status=warning&limit=2&offset=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/history status = %d, want 200", w.Code)
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("X-Total-Count = %q, want 3", total)
+	}
+
+	var history []BackupRun
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != "run-04" || history[1].ID != "run-07" {
+		t.Errorf("history = %+v, want run-04 and run-07", history)
+	}
+}
+
+func TestHandler_APIHistory_InvalidParams(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	for _, query := range []string{"?status=bogus", "?limit=abc", "?offset=-1"} {
+		req := httptest.NewRequest("GET", "/api/history"+query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/history%s status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_GetRun(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = sampleHistory(3)
+	executor.history[1].Summary = "some files vanished"
+	executor.history[1].Stats = &TransferStats{FilesTransferred: 12, TransferredSize: 4096}
+	executor.current = &BackupRun{ID: "run-live", Status: StatusRunning, RetryOf: "run-01"}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/history/run-01", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/history/run-01 status = %d, want 200", w.Code)
+	}
+	var run BackupRun
+	if err := json.NewDecoder(w.Body).Decode(&run); err != nil {
+		t.Fatalf("failed to decode run: %v", err)
+	}
+	if run.ID != "run-01" || run.Status != StatusWarning || run.Summary != "some files vanished" {
+		t.Errorf("run = %+v, want run-01 with its summary", run)
+	}
+	if run.Stats == nil || run.Stats.FilesTransferred != 12 {
+		t.Errorf("run stats = %+v, want the parsed stats", run.Stats)
+	}
+
+	// The run in progress (e.g. a retry being polled) is found too
+	req = httptest.NewRequest("GET", "/api/history/run-live", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"status":"running"`) {
+		t.Errorf("GET /api/history/run-live = %s, want the running run", w.Body.String())
+	}
+}
+
+func TestHandler_GetRun_NotFound(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = sampleHistory(3)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/history/no-such-run", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+
+	req = withCSRF(httptest.NewRequest("POST", "/api/history/run-00", nil))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/history/{id} status = %d, want 405", w.Code)
+	}
+}
+
+func TestHandler_RetryRun(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusFailed, ExitCode: 255}}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := withCSRF(httptest.NewRequest("POST", "/api/history/20260101-030000/retry", nil))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("POST retry status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+	if err := waitForStatus(executor, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	last := executor.LastRun()
+	if last.ID == "20260101-030000" {
+		t.Fatal("retry should create a new history entry")
+	}
+	if last.RetryOf != "20260101-030000" {
+		t.Errorf("RetryOf = %q, want 20260101-030000", last.RetryOf)
+	}
+}
+
+func TestHandler_RetryRun_Rejected(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = []BackupRun{
+		{ID: "ok-run", Status: StatusSuccess},
+		{ID: "bad-run", Status: StatusFailed},
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"unknown run", "POST", "/api/history/nope/retry", http.StatusNotFound},
+		{"successful run", "POST", "/api/history/ok-run/retry", http.StatusConflict},
+		{"wrong method", "GET", "/api/history/bad-run/retry", http.StatusMethodNotAllowed},
+		{"unknown action", "POST", "/api/history/bad-run/explode", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withCSRF(httptest.NewRequest(tt.method, tt.path, nil))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_RetryRun_AlreadyRunning(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = []BackupRun{{ID: "bad-run", Status: StatusFailed}}
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", "5")
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, executor)
+
+	req := withCSRF(httptest.NewRequest("POST", "/api/history/bad-run/retry", nil))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("POST retry while running status = %d, want 409", w.Code)
+	}
+}
+
+func TestHandler_APILogs(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Run a backup to create a log file
+	executor.Run()
+	waitForStatus(executor, StatusSuccess, 10*time.Second)
+
+	last := executor.LastRun()
+	if last == nil {
+		t.Fatal("expected a history entry")
+	}
+
+	req := httptest.NewRequest("GET", "/api/logs/"+last.LogFile, nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/logs/%s status = %d, want 200", last.LogFile, w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Backup started at") {
+		t.Errorf("log should contain 'Backup started at', got: %s", body)
+	}
+}
+
+func TestHandler_APILogs_NotFound(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/logs/nonexistent.log", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/logs/nonexistent.log status = %d, want 404", w.Code)
+	}
+}
+
+func TestHandler_APILogs_Htmx(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Create a log file
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-test.log"), []byte("rsync log data"), 0644)
+
+	req := httptest.NewRequest("GET", "/api/logs/backup-test.log", nil)
+	req.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+
+	ct := w.Header().Get("Content-Type")
+	if !strings.Contains(ct, "text/html") {
+		t.Errorf("htmx response Content-Type = %q, want text/html", ct)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<pre") {
+		t.Errorf("htmx response should wrap in <pre>, got: %s", body)
+	}
+	if !strings.Contains(body, "rsync log data") {
+		t.Errorf("htmx response should contain log data, got: %s", body)
+	}
+}
+
+func TestHandler_APILogs_HtmxHighlights(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	content := strings.Join([]string{
+		"movies/a.mkv",
+		`rsync: send_files failed to open "/src/<b>.mkv": Permission denied (13)`,
+		"file has vanished: \"/src/tmp.part\"",
+		"rsync error: some files/attrs were not transferred (code 23)",
+	}, "\n")
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-test.log"), []byte(content), 0644)
+
+	req := httptest.NewRequest("GET", "/api/logs/backup-test.log", nil)
+	req.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"movies/a.mkv\n",
+		`<span class="log-error">rsync: send_files failed to open &#34;/src/&lt;b&gt;.mkv&#34;: Permission denied (13)</span>`,
+		`<span class="log-warning">file has vanished: &#34;/src/tmp.part&#34;</span>`,
+		`<span class="log-error">rsync error: some files/attrs were not transferred (code 23)</span>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("log fragment should contain %s, got: %s", want, body)
+		}
+	}
+	if strings.Contains(body, "<b>") {
+		t.Errorf("log content must stay escaped: %s", body)
+	}
+
+	// Plain-text responses are unchanged
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs/backup-test.log", nil))
+	if w.Body.String() != content {
+		t.Errorf("plain log = %q, want it verbatim", w.Body.String())
+	}
+}
+
+func TestHandler_APILogs_HtmxShowsCommand(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = []BackupRun{{
+		ID:      "20260101-030000",
+		LogFile: "backup-20260101-030000.log",
+		Status:  StatusSuccess,
+		Command: "rsync -avz --delete /mnt/plex-media/ user@backup-host:/backups/plex/",
+	}}
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-20260101-030000.log"), []byte("rsync log data"), 0644)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/logs/backup-20260101-030000.log", nil)
+	req.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `class="log-command"`) || !strings.Contains(body, "rsync -avz --delete /mnt/plex-media/") {
+		t.Errorf("log fragment should show the rsync command, got: %s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/api/history", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"command":"rsync -avz`) {
+		t.Errorf("/api/history should include the command, got: %s", w.Body.String())
+	}
+}
+
+func TestHandler_APILogs_Tail(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-test.log"), []byte("first\nsecond\nthird\n"), 0644)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "first\nsecond\nthird\n"},
+		{"?tail=6", "third\n"},
+		{"?tail=1000", "first\nsecond\nthird\n"},
+		{"?lines=2", "second\nthird\n"},
+		{"?lines=50", "first\nsecond\nthird\n"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/logs/backup-test.log"+tt.query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", tt.query, w.Code)
+			continue
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("GET %s body = %q, want %q", tt.query, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestHandler_APILogs_InvalidTail(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-test.log"), []byte("data"), 0644)
+
+	for _, query := range []string{"?tail=abc", "?tail=0", "?lines=-1", "?tail=10&lines=2"} {
+		req := httptest.NewRequest("GET", "/api/logs/backup-test.log"+query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_CurrentLog(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Idle
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/current/log", nil))
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("idle: status = %d, body = %q, want 204 with no body", w.Code, w.Body.String())
+	}
+
+	// Running
+	executor.cmdFactory = sleepCmd(10 * time.Second)
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Shutdown(ShutdownCancel, time.Minute)
+	waitForLogFile(t, executor)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/current/log?lines=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("running: status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "=== Backup started at") {
+		t.Errorf("running: body = %q, want the live log", w.Body.String())
+	}
+	if id := w.Header().Get("X-Run-ID"); id != executor.Current().ID {
+		t.Errorf("X-Run-ID = %q, want the running backup's ID", id)
+	}
+}
+
+func TestHandler_CurrentLog_SingleLogFile(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.cfg.SingleLogFile = true
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// An earlier run already in the shared rsync.log
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	executor.Wait(context.Background())
+
+	executor.cmdFactory = sleepCmd(10 * time.Second)
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Shutdown(ShutdownCancel, time.Minute)
+
+	// Only the running backup's section, even before it has written it
+	var body string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/current/log?lines=200", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		if body = w.Body.String(); strings.Contains(body, "=== Backup started") {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := strings.Count(body, "=== Backup started"); n != 1 || strings.Contains(body, "exit code: 0") {
+		t.Errorf("body = %q, want only the running backup's output", body)
+	}
+}
+
+func TestHandler_LogUsage(t *testing.T) {
+	srv, executor := testServer(t)
+	dir := executor.cfg.LogDir
+	os.WriteFile(filepath.Join(dir, "backup-20260101-030000.log.gz"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(dir, "backup-20260102-030000.log"), make([]byte, 250), 0644)
+	os.WriteFile(filepath.Join(dir, "history.json"), make([]byte, 50), 0644)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/logs/usage", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/logs/usage status = %d, want 200", w.Code)
+	}
+	var usage LogUsage
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil {
+		t.Fatalf("failed to decode usage: %v", err)
+	}
+	if usage.TotalBytes != 400 {
+		t.Errorf("total_bytes = %d, want 400", usage.TotalBytes)
+	}
+	if usage.LogFiles != 2 || usage.LogBytes != 350 {
+		t.Errorf("log_files/log_bytes = %d/%d, want 2/350", usage.LogFiles, usage.LogBytes)
+	}
+	if usage.MaxLogFiles != executor.cfg.MaxLogFiles {
+		t.Errorf("max_log_files = %d, want %d", usage.MaxLogFiles, executor.cfg.MaxLogFiles)
+	}
+}
+
+func TestHandler_LogList(t *testing.T) {
+	srv, executor := testServer(t)
+	dir := executor.cfg.LogDir
+	executor.history = []BackupRun{{ID: "20260101-030000", Status: StatusSuccess, LogFile: "backup-20260101-030000.log"}}
+	os.WriteFile(filepath.Join(dir, "backup-20260101-030000.log.gz"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(dir, "backup-20260102-030000.log"), make([]byte, 250), 0644)
+	os.WriteFile(filepath.Join(dir, "history.json"), make([]byte, 50), 0644)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/logs", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/logs status = %d, want 200", w.Code)
+	}
+	var logs []LogFile
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	want := []struct {
+		name   string
+		size   int64
+		orphan bool
+	}{
+		{"backup-20260101-030000.log.gz", 100, false},
+		{"backup-20260102-030000.log", 250, true},
+	}
+	if len(logs) != len(want) {
+		t.Fatalf("logs = %+v, want %d entries", logs, len(want))
+	}
+	for i, lf := range logs {
+		if lf.Name != want[i].name || lf.Size != want[i].size || lf.Orphan != want[i].orphan || lf.ModTime.IsZero() {
+			t.Errorf("logs[%d] = %+v, want %s with size %d, orphan %v", i, lf, want[i].name, want[i].size, want[i].orphan)
+		}
+	}
+}
+
+func TestHandler_LogList_RunningBackup(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	executor.cmdFactory = sleepCmd(10 * time.Second)
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer executor.Shutdown(ShutdownCancel, time.Minute)
+	waitForLogFile(t, executor)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs", nil))
+	var logs []LogFile
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Name != executor.Current().LogFile || logs[0].Orphan {
+		t.Errorf("logs = %+v, want the running backup's log, not an orphan", logs)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 40, "3.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_LogsArchive(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Run a backup so both history.json and a log exist
+	executor.Run()
+	waitForStatus(executor, StatusSuccess, 10*time.Second)
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "backup-20260101-030000.log"), []byte("older run"), 0644)
+	os.WriteFile(filepath.Join(executor.cfg.LogDir, "unrelated.txt"), []byte("not a log"), 0644)
+
+	req := httptest.NewRequest("GET", "/api/logs.zip", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/logs.zip status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("Content-Disposition = %q, want an attachment", cd)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a valid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	if _, ok := files["history.json"]; !ok {
+		t.Error("archive should contain history.json")
+	}
+	if _, ok := files[executor.LastRun().LogFile]; !ok {
+		t.Errorf("archive should contain %s", executor.LastRun().LogFile)
+	}
+	if files["backup-20260101-030000.log"] != "older run" {
+		t.Errorf("archive should contain the older log with its content, got %q", files["backup-20260101-030000.log"])
+	}
+	if _, ok := files["unrelated.txt"]; ok {
+		t.Error("archive should only contain backup logs and history")
+	}
+}
+
+func TestHandler_LogsArchive_NoHistory(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/logs.zip", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	// Missing history.json is skipped rather than failing the download
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a valid zip: %v", err)
+	}
+	if len(zr.File) != 0 {
+		t.Errorf("expected an empty archive, got %d files", len(zr.File))
+	}
+}
+
+func TestHandler_StatusFragment(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/fragment/status", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /fragment/status = %d, want 200", w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "status-card") {
+		t.Errorf("fragment should contain status-card class, got: %s", body)
+	}
+}
+
+func TestHandler_StatusFragment_BackupFinishedTrigger(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.cmdFactory = fakeRsyncCmd(11, "error in file IO")
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(executor, StatusFailed, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	id := executor.LastRun().ID
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/fragment/status?running="+id, nil))
+
+	var trigger map[string]struct {
+		ID     string       `json:"id"`
+		Status BackupStatus `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(w.Header().Get("HX-Trigger")), &trigger); err != nil {
+		t.Fatalf("HX-Trigger = %q, want a JSON event: %v", w.Header().Get("HX-Trigger"), err)
+	}
+	if got, ok := trigger["backup-finished"]; !ok || got.ID != id || got.Status != StatusFailed {
+		t.Errorf("HX-Trigger = %+v, want backup-finished for %s with status failed", trigger, id)
+	}
+
+	// Polls that did not see the run in progress get no event
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/fragment/status", nil))
+	if got := w.Header().Get("HX-Trigger"); got != "" {
+		t.Errorf("HX-Trigger without ?running = %q, want none", got)
+	}
+}
+
+func TestHandler_HistoryFragment(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/fragment/history", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /fragment/history = %d, want 200", w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "history") {
+		t.Errorf("fragment should contain history div, got: %s", body)
+	}
+}
+
+func TestHandler_RemoteCheck_NonEmpty(t *testing.T) {
+	srv, executor := testServer(t)
+	// Fake SSH that returns file listing
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--"}
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = append(os.Environ(),
+			"GO_TEST_PROCESS=1",
+			"GO_TEST_EXIT_CODE=0",
+			"GO_TEST_OUTPUT=movies\ntv-shows",
+		)
+		return cmd
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/remote-check", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/remote-check status = %d, want 200", w.Code)
+	}
+
+	var result struct {
+		NonEmpty bool     `json:"non_empty"`
+		Files    []string `json:"files"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if !result.NonEmpty {
 		t.Error("expected non_empty to be true")
 	}
-	if len(result.Files) != 2 {
-		t.Errorf("expected 2 files, got %d", len(result.Files))
+	if len(result.Files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(result.Files))
+	}
+}
+
+func TestHandler_RemoteCheck_Empty(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--"}
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = append(os.Environ(),
+			"GO_TEST_PROCESS=1",
+			"GO_TEST_EXIT_CODE=0",
+			"GO_TEST_OUTPUT=",
+		)
+		return cmd
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/remote-check", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var result struct {
+		NonEmpty bool `json:"non_empty"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.NonEmpty {
+		t.Error("expected non_empty to be false for empty remote")
+	}
+}
+
+func TestHandler_RemoteCheck_SharesSSHCall(t *testing.T) {
+	srv, executor := testServer(t)
+	var sshCalls atomic.Int32
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		if name != "ssh" {
+			return fakeRsyncCmd(0, "")(name, args...)
+		}
+		sshCalls.Add(1)
+		return exec.Command("sh", "-c", "sleep 0.2; printf 'movies\ntv-shows'")
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+	check := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/remote-check", nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := check(); !strings.Contains(w.Body.String(), `"non_empty":true`) {
+				t.Errorf("remote check = %s, want non_empty", w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if n := sshCalls.Load(); n != 1 {
+		t.Fatalf("ssh ran %d times for two concurrent checks, want 1", n)
+	}
+
+	check()
+	if n := sshCalls.Load(); n != 1 {
+		t.Errorf("ssh ran %d times, want the cached result reused", n)
+	}
+
+	// A finished backup invalidates the cached result.
+	executor.Run()
+	waitForStatus(executor, StatusSuccess, 10*time.Second)
+	check()
+	if n := sshCalls.Load(); n != 2 {
+		t.Errorf("ssh ran %d times after a backup, want a fresh check", n)
+	}
+}
+
+func TestHandler_RemoteWarningFragment_NoHistory(t *testing.T) {
+	srv, executor := testServer(t)
+	// Fake SSH returning files — simulates non-empty remote
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--"}
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = append(os.Environ(),
+			"GO_TEST_PROCESS=1",
+			"GO_TEST_EXIT_CODE=0",
+			"GO_TEST_OUTPUT=movies\ntv-shows",
+		)
+		return cmd
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/fragment/remote-warning", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "already contains files") {
+		t.Errorf("expected warning about existing files, got: %s", body)
+	}
+	if !strings.Contains(body, "--delete") {
+		t.Errorf("expected --delete warning, got: %s", body)
+	}
+}
+
+func TestHandler_RemoteWarningFragment_WithHistory(t *testing.T) {
+	srv, executor := testServer(t)
+
+	// Run a backup so there's history
+	executor.Run()
+	waitForStatus(executor, StatusSuccess, 10*time.Second)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/fragment/remote-warning", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+
+	// Should return empty body — no warning when history exists
+	body := w.Body.String()
+	if strings.Contains(body, "already contains files") {
+		t.Error("should not show warning when backup history exists")
+	}
+}
+
+func TestHandler_APIStatus_Configured(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var data DashboardData
+	json.NewDecoder(w.Body).Decode(&data)
+
+	if !data.Configured {
+		t.Error("expected Configured=true when testConfig has all transfer fields")
+	}
+}
+
+func TestHandler_TestConnection(t *testing.T) {
+	srv, executor := testServer(t)
+	var gotArgs []string
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeRsyncCmd(0, "")(name, args...)
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	// Unsaved values from the form take precedence over the saved settings
+	form := url.Values{"remote_host": {"other@new-host"}, "ssh_key_path": {"~/.ssh/new_key"}}
+	req := withCSRF(httptest.NewRequest("POST", "/api/test-connection", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var res struct {
+		OK bool `json:"ok"`
+	}
+	json.NewDecoder(w.Body).Decode(&res)
+	if !res.OK {
+		t.Error("expected ok:true")
+	}
+	if joined := strings.Join(gotArgs, " "); !strings.Contains(joined, "~/.ssh/new_key") || !strings.Contains(joined, "other@new-host") {
+		t.Errorf("ssh should use the submitted host and key, got: %s", joined)
+	}
+}
+
+func TestHandler_TestConnection_AuthFailure(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.cmdFactory = fakeRsyncCmd(255, "user@backup-host: Permission denied (publickey).")
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := withCSRF(httptest.NewRequest("POST", "/api/test-connection", nil))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var res struct {
+		OK     bool   `json:"ok"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+		Output string `json:"output"`
+	}
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.OK || res.Reason != "auth" {
+		t.Errorf("result = %+v, want an auth failure", res)
+	}
+	if !strings.Contains(res.Output, "Permission denied") {
+		t.Errorf("output = %q, want ssh's stderr", res.Output)
+	}
+
+	// htmx gets a fragment
+	req = withCSRF(httptest.NewRequest("POST", "/api/test-connection", nil))
+	req.Header.Set("HX-Request", "true")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "failed-hint") || !strings.Contains(body, "authentication failed") {
+		t.Errorf("htmx response = %s, want a failure hint", body)
+	}
+}
+
+func TestHandler_TestConnection_RejectsGetAndMissingCSRF(t *testing.T) {
+	srv, _ := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/test-connection", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/test-connection", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("POST without CSRF token status = %d, want 403", w.Code)
+	}
+}
+
+func TestHandler_Settings_GET(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/settings", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/settings status = %d, want 200", w.Code)
+	}
+
+	var settings TransferSettings
+	if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+		t.Fatalf("failed to decode settings: %v", err)
+	}
+	if settings.SourcePath != "/mnt/plex-media" {
+		t.Errorf("source_path = %q, want /mnt/plex-media", settings.SourcePath)
+	}
+}
+
+func TestHandler_Settings_POST(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	body := strings.NewReader("source_path=/data&remote_host=user@host&remote_path=/backup&ssh_key_path=~/.ssh/key")
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("POST /api/settings status = %d, want 303", w.Code)
+	}
+
+	// Verify config was updated
+	if srv.cfg.SourcePath != "/data" {
+		t.Errorf("cfg.SourcePath = %q, want /data", srv.cfg.SourcePath)
+	}
+	if srv.cfg.RemoteHost != "user@host" {
+		t.Errorf("cfg.RemoteHost = %q, want user@host", srv.cfg.RemoteHost)
+	}
+}
+
+func TestHandler_Settings_POST_SourceIsFile(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	post := func(form string) {
+		t.Helper()
+		req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("POST /api/settings status = %d, want 303, body: %s", w.Code, w.Body.String())
+		}
+	}
+
+	const base = "source_path=/data/plex.db&remote_host=user@host&remote_path=/backup&ssh_key_path=~/.ssh/key"
+	post(base + "&source_is_file=on")
+	if !srv.cfg.SourceIsFile {
+		t.Fatal("checked source_is_file was not applied")
+	}
+	args := executor.buildRsyncArgs()
+	if src := args[len(args)-2]; src != "/data/plex.db" {
+		t.Errorf("source = %q, want the file path without a trailing slash", src)
+	}
+
+	// Persisted to settings.json
+	reloaded := &Config{LogDir: srv.cfg.LogDir}
+	if err := reloaded.LoadTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.SourceIsFile {
+		t.Error("source_is_file was not saved")
+	}
+
+	// An unchecked box is not sent at all
+	post(base)
+	if srv.cfg.SourceIsFile {
+		t.Error("source_is_file should be cleared when the box is unchecked")
+	}
+
+	post(base + "&source_is_file=true")
+	if !srv.cfg.SourceIsFile {
+		t.Error("source_is_file=true was not applied")
+	}
+}
+
+func TestHandler_Settings_POST_RemotePathMustBeAbsolute(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	post := func(remotePath string) *httptest.ResponseRecorder {
+		form := "source_path=/data&remote_host=user@host&ssh_key_path=~/.ssh/key&remote_path=" + remotePath
+		req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("/backups/plex"); w.Code != http.StatusSeeOther {
+		t.Errorf("absolute path: status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+
+	w := post("backups/plex")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "must be absolute") {
+		t.Errorf("relative path: status = %d, body = %q, want 400 explaining the path must be absolute", w.Code, w.Body.String())
+	}
+	if srv.cfg.RemotePath != "/backups/plex" {
+		t.Errorf("rejected path was applied: %q", srv.cfg.RemotePath)
+	}
+
+	// Windows drive paths are absolute too
+	if w := post("C:/backups"); w.Code != http.StatusSeeOther {
+		t.Errorf("drive path: status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+
+	srv.cfg.AllowRelativeRemotePath = true
+	if w := post("backups/plex"); w.Code != http.StatusSeeOther {
+		t.Errorf("relative path with the opt-out: status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_Settings_POST_WindowsBackslashPath(t *testing.T) {
+	srv, executor := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	form := url.Values{
+		"source_path":  {"/data"},
+		"remote_host":  {"user@host"},
+		"remote_path":  {`C:\Backups\Plex`},
+		"ssh_key_path": {"~/.ssh/key"},
+	}
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+
+	// Saved as entered, and loads back after a restart
+	if err := srv.cfg.LoadTransferSettings(); err != nil || srv.cfg.RemotePath != `C:\Backups\Plex` {
+		t.Fatalf("reloaded remote_path = %q, err = %v", srv.cfg.RemotePath, err)
+	}
+	args := executor.buildRsyncArgs()
+	if dest := args[len(args)-1]; dest != "user@host:C:/Backups/Plex/" {
+		t.Errorf("dest = %q, want user@host:C:/Backups/Plex/", dest)
+	}
+
+	// Still rejected for a unix remote
+	srv.cfg.RemoteOS = "unix"
+	form.Set("remote_path", `/backups\plex`)
+	req = withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("backslash on a unix remote: status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandler_Settings_POST_LocalDestination(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	body := strings.NewReader("source_path=/data&remote_host=&remote_path=/media/external&ssh_key_path=")
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("POST /api/settings status = %d, want 303, body: %s", w.Code, w.Body.String())
+	}
+	if !srv.cfg.LocalDestination() || !srv.cfg.TransferConfigured() {
+		t.Errorf("settings = %+v, want a configured local destination", srv.cfg.GetTransferSettings())
+	}
+}
+
+func TestHandler_Settings_POST_MissingFields(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	body := strings.NewReader("source_path=/data")
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /api/settings with missing fields status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandler_Settings_POST_MaliciousInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"host command separator", "remote_host", "host; rm -rf /"},
+		{"host command substitution", "remote_host", "user@$(reboot)"},
+		{"host ssh option", "remote_host", "-oProxyCommand=sh"},
+		{"path quote breakout", "remote_path", "/backup'; rm -rf / #"},
+		{"path backticks", "remote_path", "/backup`id`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := testServer(t)
+			mux := http.NewServeMux()
+			srv.RegisterRoutes(mux)
+
+			form := url.Values{
+				"source_path":  {"/data"},
+				"remote_host":  {"user@host"},
+				"remote_path":  {"/backup"},
+				"ssh_key_path": {"~/.ssh/key"},
+			}
+			form.Set(tt.field, tt.value)
+			req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if srv.cfg.RemoteHost == tt.value || srv.cfg.RemotePath == tt.value {
+				t.Errorf("malicious %s was applied to the config", tt.field)
+			}
+		})
+	}
+}
+
+func TestHandler_Settings_POST_Schedule(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	form := url.Values{
+		"source_path":  {"/data"},
+		"remote_host":  {"user@host"},
+		"remote_path":  {"/backup"},
+		"ssh_key_path": {"~/.ssh/key"},
+		"schedule":     {"15 2 * * 1-5"},
+	}
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("POST /api/settings status = %d, want 303", w.Code)
+	}
+	if srv.cfg.Schedule != "15 2 * * 1-5" {
+		t.Errorf("cfg.Schedule = %q, want 15 2 * * 1-5", srv.cfg.Schedule)
+	}
+	if got := srv.scheduler.Schedule(); got != "15 2 * * 1-5" {
+		t.Errorf("scheduler schedule = %q, want the live scheduler updated", got)
+	}
+	if next := srv.scheduler.NextRun(); next.Hour() != 2 || next.Minute() != 15 {
+		t.Errorf("NextRun() = %v, want 02:15", next)
+	}
+
+	// Persisted alongside the transfer settings
+	loaded := &Config{LogDir: srv.cfg.LogDir}
+	if err := loaded.LoadTransferSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Schedule != "15 2 * * 1-5" {
+		t.Errorf("saved schedule = %q, want 15 2 * * 1-5", loaded.Schedule)
+	}
+}
+
+func TestHandler_Settings_POST_ScheduleMatchingConfigClearsOverride(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.cfg.ApplyTransferSettings(TransferSettings{
+		SourcePath: "/data", RemoteHost: "user@host", RemotePath: "/backup", SSHKeyPath: "~/.ssh/key",
+		Schedule: "15 2 * * *",
+	})
+	srv.scheduler.Reschedule("15 2 * * *")
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	form := url.Values{
+		"source_path":  {"/data"},
+		"remote_host":  {"user@host"},
+		"remote_path":  {"/backup"},
+		"ssh_key_path": {"~/.ssh/key"},
+		"schedule":     {""},
+	}
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303", w.Code)
+	}
+	if srv.cfg.ScheduleOverridden() || srv.cfg.Schedule != "0 3 * * *" {
+		t.Errorf("Schedule = %q (overridden %v), want config.yaml's 0 3 * * *", srv.cfg.Schedule, srv.cfg.ScheduleOverridden())
+	}
+	if got := srv.scheduler.Schedule(); got != "0 3 * * *" {
+		t.Errorf("scheduler schedule = %q, want 0 3 * * *", got)
 	}
 }
 
-func TestHandler_RemoteCheck_Empty(t *testing.T) {
-	srv, executor := testServer(t)
-	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestHelperProcess", "--"}
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = append(os.Environ(),
-			"GO_TEST_PROCESS=1",
-			"GO_TEST_EXIT_CODE=0",
-			"GO_TEST_OUTPUT=",
-		)
-		return cmd
-	}
+func TestHandler_Settings_POST_InvalidSchedule(t *testing.T) {
+	srv, _ := testServer(t)
+	before := srv.cfg.Schedule
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/remote-check", nil)
+	form := url.Values{
+		"source_path":  {"/data"},
+		"remote_host":  {"user@host"},
+		"remote_path":  {"/backup"},
+		"ssh_key_path": {"~/.ssh/key"},
+		"schedule":     {"0 25 * * *"},
+	}
+	req := withCSRF(httptest.NewRequest("POST", "/api/settings", strings.NewReader(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	var result struct {
-		NonEmpty bool `json:"non_empty"`
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
 	}
-	json.NewDecoder(w.Body).Decode(&result)
-	if result.NonEmpty {
-		t.Error("expected non_empty to be false for empty remote")
+	if !strings.Contains(w.Body.String(), "invalid schedule") {
+		t.Errorf("body = %q, want the cron parse error", w.Body.String())
+	}
+	if srv.cfg.Schedule != before || srv.scheduler.Schedule() != before {
+		t.Errorf("schedule changed to %q / %q, want %q kept", srv.cfg.Schedule, srv.scheduler.Schedule(), before)
 	}
 }
 
-func TestHandler_RemoteWarningFragment_NoHistory(t *testing.T) {
-	srv, executor := testServer(t)
-	// Fake SSH returning files — simulates non-empty remote
-	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestHelperProcess", "--"}
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = append(os.Environ(),
-			"GO_TEST_PROCESS=1",
-			"GO_TEST_EXIT_CODE=0",
-			"GO_TEST_OUTPUT=movies\ntv-shows",
-		)
-		return cmd
+func TestHandler_Settings_MethodNotAllowed(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("DELETE", "/api/settings", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /api/settings status = %d, want 405", w.Code)
 	}
+}
+
+func TestHandler_SettingsFragment(t *testing.T) {
+	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/fragment/remote-warning", nil)
+	req := httptest.NewRequest("GET", "/fragment/settings", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("status = %d, want 200", w.Code)
+		t.Errorf("GET /fragment/settings = %d, want 200", w.Code)
 	}
 
 	body := w.Body.String()
-	if !strings.Contains(body, "already contains files") {
-		t.Errorf("expected warning about existing files, got: %s", body)
-	}
-	if !strings.Contains(body, "--delete") {
-		t.Errorf("expected --delete warning, got: %s", body)
+	if !strings.Contains(body, "settings-form") {
+		t.Errorf("fragment should contain settings-form, got: %s", body)
 	}
 }
 
-func TestHandler_RemoteWarningFragment_WithHistory(t *testing.T) {
-	srv, executor := testServer(t)
+func TestHandler_Version(t *testing.T) {
+	oldVersion, oldCommit, oldDate := version, commit, buildDate
+	version, commit, buildDate = "v1.4.0", "abc1234", "2026-03-14T03:00:00Z"
+	defer func() { version, commit, buildDate = oldVersion, oldCommit, oldDate }()
 
-	// Run a backup so there's history
-	executor.Run()
-	waitForStatus(executor, StatusSuccess, 10*time.Second)
+	srv, _ := testServer(t)
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/version status = %d, want 200", w.Code)
+	}
+	var res map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := map[string]string{
+		"version":    "v1.4.0",
+		"commit":     "abc1234",
+		"build_date": "2026-03-14T03:00:00Z",
+		"go_version": runtime.Version(),
+	}
+	for k, v := range want {
+		if res[k] != v {
+			t.Errorf("%s = %q, want %q", k, res[k], v)
+		}
+	}
+}
+
+func TestHandler_Healthz(t *testing.T) {
+	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/fragment/remote-warning", nil)
+	req := httptest.NewRequest("GET", "/healthz", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("status = %d, want 200", w.Code)
+		t.Errorf("GET /healthz status = %d, want 200", w.Code)
 	}
 
-	// Should return empty body — no warning when history exists
-	body := w.Body.String()
-	if strings.Contains(body, "already contains files") {
-		t.Error("should not show warning when backup history exists")
+	var res map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if res["status"] != "ok" {
+		t.Errorf("status = %q, want ok", res["status"])
 	}
 }
 
-func TestHandler_APIStatus_Configured(t *testing.T) {
+func TestHandler_Readyz(t *testing.T) {
 	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/status", nil)
+	req := httptest.NewRequest("GET", "/readyz", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	var data DashboardData
-	json.NewDecoder(w.Body).Decode(&data)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /readyz status = %d, want 200, body: %s", w.Code, w.Body.String())
+	}
+}
 
-	if !data.Configured {
-		t.Error("expected Configured=true when testConfig has all transfer fields")
+func TestHandler_Readyz_Deep(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		exitCode   int
+		output     string
+		wantCode   int
+		wantReason string
+	}{
+		{"reachable", 0, "", http.StatusOK, ""},
+		{"unreachable", 255, "ssh: connect to host backup-host port 22: Connection refused", http.StatusServiceUnavailable, "remote not reachable: remote host unreachable"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, executor := testServer(t)
+			var sshCalls int
+			executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+				sshCalls++
+				if !hasArg(args, "user@backup-host") {
+					t.Errorf("ssh args = %v, want the saved remote host", args)
+				}
+				return fakeRsyncCmd(tt.exitCode, tt.output)(name, args...)
+			}
+			mux := http.NewServeMux()
+			srv.RegisterRoutes(mux)
+
+			for i := 0; i < 3; i++ {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz?deep=1", nil))
+				if w.Code != tt.wantCode {
+					t.Fatalf("GET /readyz?deep=1 status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+				}
+				if tt.wantReason != "" && !strings.Contains(w.Body.String(), tt.wantReason) {
+					t.Errorf("reason = %s, want %q", w.Body.String(), tt.wantReason)
+				}
+			}
+			if sshCalls != 1 {
+				t.Errorf("ssh ran %d times for 3 probes, want 1 (cached)", sshCalls)
+			}
+
+			// The plain probe never connects
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+			if sshCalls != 1 {
+				t.Errorf("plain /readyz ran ssh")
+			}
+		})
 	}
 }
 
-func TestHandler_Settings_GET(t *testing.T) {
+func TestHandler_Readyz_NotConfigured(t *testing.T) {
 	srv, _ := testServer(t)
+	srv.cfg.RemotePath = "" // an empty host alone is a valid local destination
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/api/settings", nil)
+	req := httptest.NewRequest("GET", "/readyz", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("GET /api/settings status = %d, want 200", w.Code)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz status = %d, want 503", w.Code)
 	}
+	if !strings.Contains(w.Body.String(), "not configured") {
+		t.Errorf("expected reason to mention configuration, got: %s", w.Body.String())
+	}
+}
 
-	var settings TransferSettings
-	if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
-		t.Fatalf("failed to decode settings: %v", err)
+func TestHandler_Readyz_LogDirNotWritable(t *testing.T) {
+	srv, _ := testServer(t)
+	// A regular file where the log directory should be cannot be written into
+	blocker := filepath.Join(t.TempDir(), "not-a-dir")
+	os.WriteFile(blocker, []byte("x"), 0644)
+	srv.cfg.LogDir = blocker
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz status = %d, want 503", w.Code)
 	}
-	if settings.SourcePath != "/mnt/plex-media" {
-		t.Errorf("source_path = %q, want /mnt/plex-media", settings.SourcePath)
+	if !strings.Contains(w.Body.String(), "not writable") {
+		t.Errorf("expected reason to mention log directory, got: %s", w.Body.String())
 	}
 }
 
-func TestHandler_Settings_POST(t *testing.T) {
+func TestHandler_CSRF_MissingToken(t *testing.T) {
 	srv, _ := testServer(t)
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	body := strings.NewReader("source_path=/data&remote_host=user@host&remote_path=/backup&ssh_key_path=~/.ssh/key")
+	for _, path := range []string{"/api/backup", "/api/settings"} {
+		req := httptest.NewRequest("POST", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("POST %s without CSRF token status = %d, want 403", path, w.Code)
+		}
+	}
+}
+
+func TestHandler_CSRF_MismatchedToken(t *testing.T) {
+	srv, executor := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("POST", "/api/backup", nil)
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "cookie-token"})
+	req.Header.Set(csrfHeaderName, "attacker-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("POST /api/backup with mismatched token status = %d, want 403", w.Code)
+	}
+	if executor.Current() != nil || executor.LastRun() != nil {
+		t.Error("backup should not start when the CSRF check fails")
+	}
+}
+
+func TestHandler_CSRF_FormField(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	body := strings.NewReader("csrf_token=" + testCSRFToken + "&source_path=/data&remote_host=user@host&remote_path=/backup&ssh_key_path=~/.ssh/key")
 	req := httptest.NewRequest("POST", "/api/settings", body)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
 	if w.Code != http.StatusSeeOther {
-		t.Errorf("POST /api/settings status = %d, want 303", w.Code)
+		t.Errorf("POST /api/settings with CSRF form field status = %d, want 303", w.Code)
 	}
+}
 
-	// Verify config was updated
-	if srv.cfg.SourcePath != "/data" {
-		t.Errorf("cfg.SourcePath = %q, want /data", srv.cfg.SourcePath)
+func TestHandler_Dashboard_IssuesCSRFCookie(t *testing.T) {
+	srv, _ := testServer(t)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookieName {
+			token = c.Value
+		}
 	}
-	if srv.cfg.RemoteHost != "user@host" {
-		t.Errorf("cfg.RemoteHost = %q, want user@host", srv.cfg.RemoteHost)
+	if token == "" {
+		t.Fatal("dashboard should set a CSRF cookie")
+	}
+	if !strings.Contains(w.Body.String(), token) {
+		t.Error("dashboard should embed the CSRF token in the page")
+	}
+
+	// An existing cookie is reused rather than replaced
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "existing-token"})
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("dashboard should not reissue a CSRF cookie that is already present")
+	}
+	if !strings.Contains(w.Body.String(), "existing-token") {
+		t.Error("dashboard should embed the existing CSRF token")
 	}
 }
 
-func TestHandler_Settings_POST_MissingFields(t *testing.T) {
-	srv, _ := testServer(t)
+// chdir switches the working directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	orig, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(orig) })
+}
+
+func TestNewServer_EmbeddedTemplates(t *testing.T) {
+	cfg := testConfig(t)
+	executor := NewBackupExecutor(cfg)
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No templates/ directory in the working directory
+	chdir(t, t.TempDir())
+
+	srv, err := NewServer(cfg, executor, sched)
+	if err != nil {
+		t.Fatalf("NewServer() without a templates directory: %v", err)
+	}
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	body := strings.NewReader("source_path=/data")
-	req := httptest.NewRequest("POST", "/api/settings", body)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req := httptest.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("POST /api/settings with missing fields status = %d, want 400", w.Code)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET / status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Plex Backup") {
+		t.Errorf("dashboard should render from embedded templates, got: %s", w.Body.String())
 	}
 }
 
-func TestHandler_Settings_MethodNotAllowed(t *testing.T) {
-	srv, _ := testServer(t)
+func TestNewServer_DiskTemplatesOverride(t *testing.T) {
+	cfg := testConfig(t)
+	executor := NewBackupExecutor(cfg)
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0755)
+	os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(`custom dashboard {{.Status}}`), 0644)
+	chdir(t, dir)
+
+	srv, err := NewServer(cfg, executor, sched)
+	if err != nil {
+		t.Fatalf("NewServer() with custom templates: %v", err)
+	}
 
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("DELETE", "/api/settings", nil)
+	req := httptest.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
-	if w.Code != http.StatusMethodNotAllowed {
-		t.Errorf("DELETE /api/settings status = %d, want 405", w.Code)
+	if !strings.Contains(w.Body.String(), "custom dashboard idle") {
+		t.Errorf("dashboard should render from the on-disk template, got: %s", w.Body.String())
 	}
 }
 
-func TestHandler_SettingsFragment(t *testing.T) {
+func TestNewServer_InvalidDiskTemplates(t *testing.T) {
+	cfg := testConfig(t)
+	executor := NewBackupExecutor(cfg)
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0755)
+	os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(`{{if}}`), 0644)
+	chdir(t, dir)
+
+	if _, err := NewServer(cfg, executor, sched); err == nil {
+		t.Error("NewServer() should return an error for a broken template instead of panicking")
+	}
+}
+
+func TestHandler_StaticEmbedded(t *testing.T) {
 	srv, _ := testServer(t)
 
+	// Embedded assets must not depend on the working directory
+	chdir(t, t.TempDir())
+
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
-	req := httptest.NewRequest("GET", "/fragment/settings", nil)
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("GET /fragment/settings = %d, want 200", w.Code)
+		t.Fatalf("GET /static/style.css status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("Content-Type = %q, want text/css", ct)
 	}
 
-	body := w.Body.String()
-	if !strings.Contains(body, "settings-form") {
-		t.Errorf("fragment should contain settings-form, got: %s", body)
+	req = httptest.NewRequest("GET", "/static/missing.js", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /static/missing.js status = %d, want 404", w.Code)
+	}
+}
+
+func TestHandler_StaticDirOverride(t *testing.T) {
+	srv, _ := testServer(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte("body { color: red; }"), 0644)
+	srv.cfg.StaticDir = dir
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Body.String() != "body { color: red; }" {
+		t.Errorf("expected the on-disk stylesheet, got: %s", w.Body.String())
 	}
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HostKey is one public key of the remote host, as pinned in
+// known_hosts_file.
+type HostKey struct {
+	// Host is the known_hosts name: the host, or [host]:port off port 22.
+	Host string `json:"host"`
+	Type string `json:"type"`
+	Key  string `json:"-"`
+	// Fingerprint is the SHA256 fingerprint ssh prints, e.g. "SHA256:...".
+	Fingerprint string `json:"fingerprint"`
+}
+
+// parseKeyscan parses ssh-keyscan output, one "host type base64-key" line
+// per key. ssh-keyscan writes its "# host:22 SSH-2.0-..." banners to
+// stderr, but comment lines are skipped here too.
+func parseKeyscan(out string) []HostKey {
+	var keys []HostKey
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(raw)
+		keys = append(keys, HostKey{
+			Host:        fields[0],
+			Type:        fields[1],
+			Key:         fields[2],
+			Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+		})
+	}
+	return keys
+}
+
+// replaceKnownHosts returns known_hosts content with every entry for the
+// scanned hosts replaced by keys. Other hosts, comments and @cert-authority
+// or @revoked lines are kept; hashed entries cannot be matched and are
+// left as they are.
+func replaceKnownHosts(content string, keys []HostKey) string {
+	names := make(map[string]bool)
+	for _, k := range keys {
+		names[k.Host] = true
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && !strings.HasPrefix(fields[0], "@") {
+			stale := false
+			for _, name := range strings.Split(fields[0], ",") {
+				stale = stale || names[name]
+			}
+			if stale {
+				continue
+			}
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s %s %s\n", k.Host, k.Type, k.Key)
+	}
+	return b.String()
+}
+
+// CanTrustRemoteHost reports why TrustRemoteHost cannot be used with the
+// current settings, or nil if it can.
+func (ex *BackupExecutor) CanTrustRemoteHost() error {
+	if ex.cfg.KnownHostsFile == "" {
+		return errors.New("known_hosts_file is not set, host keys are not checked")
+	}
+	if ex.cfg.LocalDestination() {
+		return errors.New("the destination is local, there is no remote host")
+	}
+	if err := validateRemoteHost(ex.cfg.RemoteHost); err != nil {
+		return err
+	}
+	if ex.cfg.SSHProxyJump != "" {
+		return errors.New("ssh-keyscan cannot reach a host behind ssh_proxy_jump")
+	}
+	return nil
+}
+
+// TrustRemoteHost scans the saved remote host's public keys with
+// ssh-keyscan and pins them in known_hosts_file, replacing the keys it had
+// for the host, e.g. after the host was rebuilt. The keys are accepted as
+// scanned, so compare the returned fingerprints with the host's.
+func (ex *BackupExecutor) TrustRemoteHost() ([]HostKey, error) {
+	if err := ex.CanTrustRemoteHost(); err != nil {
+		return nil, err
+	}
+
+	host, port := ex.cfg.SSHHostPort()
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	args := []string{"-T", strconv.Itoa(ex.cfg.ConnectTimeout())}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, host)
+	out, err := ex.cmdFactory("ssh-keyscan", args...).Output()
+	keys := parseKeyscan(string(out))
+	if len(keys) == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("ssh-keyscan %s: %w", host, err)
+		}
+		return nil, fmt.Errorf("ssh-keyscan returned no keys for %s", host)
+	}
+
+	content, err := os.ReadFile(ex.cfg.KnownHostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(ex.cfg.KnownHostsFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(ex.cfg.KnownHostsFile, []byte(replaceKnownHosts(string(content), keys)), 0600); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", ex.cfg.KnownHostsFile, err)
+	}
+
+	// Checks that failed on the old key can succeed now
+	ex.remoteCheck.invalidate()
+	ex.reachability.invalidate()
+	return keys, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultLogNameTemplate is the log filename scheme used when
+// log_name_template is unset.
+const defaultLogNameTemplate = "backup-{id}.log"
+
+// logNamer renders log filenames from log_name_template: a Go time layout
+// applied to the run's start time, with {id} replaced by the run ID and
+// {status} by the run's status ("running" until it finishes).
+type logNamer struct {
+	template string
+	// prefix and suffix are the parts every rendered name shares; they
+	// identify backup logs among the other files in the log dir.
+	prefix, suffix string
+}
+
+func newLogNamer(template string) (logNamer, error) {
+	if template == "" {
+		template = defaultLogNameTemplate
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return logNamer{}, fmt.Errorf("must be a filename, not a path")
+	}
+	if !strings.HasSuffix(template, ".log") {
+		return logNamer{}, fmt.Errorf("must end in .log")
+	}
+
+	n := logNamer{template: template}
+	if !strings.Contains(template, "{id}") && !n.hasFullTimestamp() {
+		return logNamer{}, fmt.Errorf("must include {id}, or the start time down to milliseconds (e.g. 20060102_150405.000) before any {status}, so each run gets its own file")
+	}
+	// Two runs that differ in every time field, ID and status: whatever the
+	// names still share is fixed text
+	a := n.render(time.Date(1001, 2, 3, 4, 5, 6, 7e6, time.UTC), "10010203-040506.007", StatusSuccess)
+	b := n.render(time.Date(2098, 11, 28, 17, 48, 59, 998e6, time.UTC), "20981128-174859.998", StatusFailed)
+	n.prefix = commonPrefix(a, b)
+	n.suffix = commonSuffix(a, b)
+	if n.prefix == "" {
+		return logNamer{}, fmt.Errorf("must start with fixed text such as \"backup-\"")
+	}
+	return n, nil
+}
+
+// hasFullTimestamp reports whether the template's time layout tells apart
+// any two start times a millisecond or more apart, ahead of {status}: each
+// variant of a base time, from a year to a millisecond later, must change
+// the name before the status does.
+func (n logNamer) hasFullTimestamp() bool {
+	base := time.Date(2001, 2, 3, 4, 5, 6, 7e6, time.UTC)
+	name := n.render(base, "", "\x00")
+	statusAt := strings.IndexByte(name, 0)
+	if statusAt < 0 {
+		statusAt = len(name)
+	}
+	for _, t := range []time.Time{
+		base.AddDate(1, 0, 0), base.AddDate(0, 1, 0), base.AddDate(0, 0, 1),
+		base.Add(time.Hour), base.Add(12 * time.Hour), base.Add(time.Minute),
+		base.Add(time.Second), base.Add(time.Millisecond),
+	} {
+		other := n.render(t, "", "\x00")
+		if len(commonPrefix(name, other)) >= statusAt {
+			return false
+		}
+	}
+	return true
+}
+
+// render returns the filename for a run.
+func (n logNamer) render(start time.Time, id string, status BackupStatus) string {
+	name := start.Format(n.template)
+	name = strings.ReplaceAll(name, "{id}", id)
+	return strings.ReplaceAll(name, "{status}", string(status))
+}
+
+// hasStatus reports whether names include the status, so the log has to be
+// renamed when the run finishes.
+func (n logNamer) hasStatus() bool {
+	return strings.Contains(n.template, "{status}")
+}
+
+// matches reports whether name is a backup log, plain or gzip-compressed.
+func (n logNamer) matches(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	return len(name) > len(n.prefix)+len(n.suffix) &&
+		strings.HasPrefix(name, n.prefix) && strings.HasSuffix(name, n.suffix)
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+func commonSuffix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+	return a[len(a)-i:]
+}
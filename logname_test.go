@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogNamer_Render(t *testing.T) {
+	start := time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", "backup-20260314-030000.000.log"},
+		{"plex_20060102_150405.000_{status}.log", "plex_20260314_030000.000_running.log"},
+		{"nightly-2006-01-02-{id}.log", "nightly-2026-03-14-20260314-030000.000.log"},
+	}
+	for _, tt := range tests {
+		n, err := newLogNamer(tt.template)
+		if err != nil {
+			t.Fatalf("newLogNamer(%q): %v", tt.template, err)
+		}
+		got := n.render(start, "20260314-030000.000", StatusRunning)
+		if got != tt.want {
+			t.Errorf("%q renders %q, want %q", tt.template, got, tt.want)
+		}
+		if !n.matches(got) || !n.matches(got+".gz") {
+			t.Errorf("%q does not match its own name %q", tt.template, got)
+		}
+		for _, other := range []string{"history.json", "settings.json", "other.log"} {
+			if n.matches(other) {
+				t.Errorf("%q matches %q", tt.template, other)
+			}
+		}
+	}
+}
+
+func TestLogNamer_Invalid(t *testing.T) {
+	for _, template := range []string{
+		"logs/backup-{id}.log",
+		"backup-{id}.txt",
+		"backup.log",
+		"{id}.log",
+		"backup-{status}.log",
+		"backup-2006.log",
+		"plex_20060102_150405_{status}.log",
+		"plex_{status}_20060102_150405.000.log",
+		"backup-20060102-030405.000.log",
+	} {
+		if _, err := newLogNamer(template); err == nil {
+			t.Errorf("newLogNamer(%q) should fail", template)
+		}
+	}
+}
+
+func TestBackup_CustomLogNameTemplate(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LogNameTemplate = "plex_20060102_150405.000_{status}.log"
+	cfg.MaxLogFiles = 2
+	ex := NewBackupExecutor(cfg)
+	clock := newFakeClock(time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC))
+	ex.clock = clock
+
+	codes := []int{0, 23, 0}
+	for i, code := range codes {
+		ex.cmdFactory = fakeRsyncCmd(code, "ok")
+		if err := ex.Run(); err != nil {
+			t.Fatal(err)
+		}
+		want := StatusSuccess
+		if code != 0 {
+			want = StatusWarning
+		}
+		if err := waitForStatus(ex, want, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if name := ex.LastRun().LogFile; name != "plex_20260314_030000.000_success.log" {
+				t.Errorf("log file = %q, want it renamed with the final status", name)
+			}
+		}
+		clock.Advance(time.Hour)
+	}
+
+	last := ex.LastRun()
+	if last.LogFile != "plex_20260314_050000.000_success.log" {
+		t.Errorf("log file = %q", last.LogFile)
+	}
+	if content, err := ex.ReadLog(last.LogFile); err != nil || !strings.Contains(content, "Backup finished") {
+		t.Errorf("ReadLog(%q) = %q, %v", last.LogFile, content, err)
+	}
+
+	// The first log is pruned and the warning log compressed
+	entries, _ := os.ReadDir(cfg.LogDir)
+	var logs []string
+	for _, e := range entries {
+		if ex.isLogFile(e.Name()) {
+			logs = append(logs, e.Name())
+		}
+	}
+	want := []string{"plex_20260314_040000.000_warning.log.gz", "plex_20260314_050000.000_success.log"}
+	if strings.Join(logs, " ") != strings.Join(want, " ") {
+		t.Errorf("logs = %v, want %v", logs, want)
+	}
+}
+
+func TestBackup_StatusFirstLogNameTemplate(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LogNameTemplate = "plex_{status}_{id}.log"
+	cfg.MaxLogFiles = 2
+	ex := NewBackupExecutor(cfg)
+	clock := newFakeClock(time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC))
+	ex.clock = clock
+
+	for _, code := range []int{0, 23, 0} {
+		ex.cmdFactory = fakeRsyncCmd(code, "ok")
+		if err := ex.Run(); err != nil {
+			t.Fatal(err)
+		}
+		ex.Wait(context.Background())
+		clock.Advance(time.Hour)
+	}
+
+	// Names sort by status, but the oldest run's log is the one pruned and
+	// only the newest is left uncompressed
+	entries, _ := os.ReadDir(cfg.LogDir)
+	var logs []string
+	for _, e := range entries {
+		if ex.isLogFile(e.Name()) {
+			logs = append(logs, e.Name())
+		}
+	}
+	want := []string{"plex_success_20260314-050000.000.log", "plex_warning_20260314-040000.000.log.gz"}
+	if strings.Join(logs, " ") != strings.Join(want, " ") {
+		t.Errorf("logs = %v, want %v", logs, want)
+	}
+}
+
+func TestLoadConfig_InvalidLogNameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+log_name_template: "{id}.txt"
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "log_name_template") {
+		t.Errorf("LoadConfig() error = %v, want a log_name_template error", err)
+	}
+}
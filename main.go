@@ -2,36 +2,90 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Build information, set at build time with e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// version also goes into the User-Agent of notifications.
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// BuildInfo describes the running binary, for GET /api/version.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func buildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+}
+
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
 	configPath := flag.String("config", "config.yaml", "path to configuration file")
+	printConfig := flag.Bool("print-config", false, "print a commented example config.yaml with every field and exit")
+	check := flag.Bool("check", false, "validate the config and exit without starting the server")
 	flag.Parse()
 
+	if *printConfig {
+		if err := writeExampleConfig(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if *check {
+		os.Exit(checkConfig(*configPath, os.Stdout))
+	}
+
 	cfg, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to load config")
 	}
+	log.Logger = newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	for _, w := range cfg.Warnings() {
+		log.Warn().Msg(w)
+	}
+
+	info := buildInfo()
+	log.Info().Str("version", info.Version).Str("commit", info.Commit).Str("build_date", info.BuildDate).
+		Str("go_version", info.GoVersion).Msg("starting rsync-web")
 
 	// Load saved transfer settings (source, destination, SSH key) from settings.json
 	if err := cfg.LoadTransferSettings(); err != nil {
 		log.Warn().Err(err).Msg("could not load saved settings")
 	}
+	if cfg.ScheduleOverridden() {
+		log.Info().Str("schedule", cfg.Schedule).Str("config_schedule", cfg.ConfigSchedule()).Msg("using schedule saved from the web UI instead of config.yaml")
+	}
 
 	if cfg.TransferConfigured() {
-		log.Info().Str("source", cfg.SourcePath).Msg("source configured")
-		log.Info().Str("dest", cfg.RemoteHost+":"+cfg.RemotePath).Msg("destination configured")
+		log.Info().Str("source", cfg.SourceDisplay()).Msg("source configured")
+		log.Info().Str("dest", cfg.Destination()).Msg("destination configured")
 	} else {
 		log.Info().Msg("transfer settings not yet configured — use the web UI to set them")
 	}
@@ -39,6 +93,14 @@ func main() {
 	log.Info().Str("addr", cfg.ListenAddr).Msg("listen address configured")
 
 	executor := NewBackupExecutor(cfg)
+	if version, err := executor.DetectRsyncVersion(); err != nil {
+		log.Warn().Err(err).Msg("could not detect rsync version — backups will fail until rsync is installed and on PATH")
+	} else {
+		log.Info().Str("version", version).Msg("rsync detected")
+		if !versionAtLeast(version, minProgress2Version) {
+			log.Warn().Str("version", version).Msg("rsync is older than " + minProgress2Version + " — progress and ETA are not available")
+		}
+	}
 
 	scheduler, err := NewScheduler(executor, cfg.Schedule)
 	if err != nil {
@@ -46,36 +108,215 @@ func main() {
 	}
 	scheduler.Start()
 
-	srv := NewServer(cfg, executor, scheduler)
+	var watchdog *StaleWatchdog
+	if cfg.StaleAfter > 0 {
+		watchdog = NewStaleWatchdog(executor, cfg.StaleAfter)
+		watchdog.Start()
+	}
+
+	srv, err := NewServer(cfg, executor, scheduler)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load templates")
+	}
 	mux := http.NewServeMux()
 	srv.RegisterRoutes(mux)
 
+	var handler http.Handler = mux
+	if cfg.AccessLog {
+		handler = accessLogMiddleware(log.Logger, handler)
+	}
+
 	httpServer := &http.Server{
 		Addr:    cfg.ListenAddr,
-		Handler: mux,
+		Handler: handler,
 	}
 
 	// Graceful shutdown
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
 
+	network, address := parseListenAddr(cfg.ListenAddr)
+	listener, err := listen(network, address)
+	if err != nil {
+		log.Fatal().Err(err).Str("addr", cfg.ListenAddr).Msg(listenFailure(network, address, err))
+	}
+
 	go func() {
-		log.Info().Str("url", "http://localhost"+cfg.ListenAddr).Msg("dashboard available")
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if network == "unix" {
+			log.Info().Str("socket", address).Msg("dashboard available")
+		} else {
+			log.Info().Str("url", dashboardURL(address)).Msg("dashboard available")
+		}
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("http server error")
 		}
 	}()
 
 	<-done
 	log.Info().Msg("shutting down...")
+	srv.BeginShutdown()
 
 	scheduler.Stop()
+	if watchdog != nil {
+		watchdog.Stop()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("http shutdown error")
 	}
+	if network == "unix" {
+		// Closing the listener normally unlinks the socket already
+		os.Remove(address)
+	}
+
+	// No new backups can be triggered now; deal with one still running
+	executor.Shutdown(cfg.ShutdownBehavior, cfg.ShutdownGrace)
+	if !executor.FlushNotifications(cfg.NotifyTimeout) {
+		log.Warn().Msg("gave up waiting for notifications to be sent")
+	}
 
 	log.Info().Msg("stopped")
 }
+
+// checkConfig validates the config at path as startup would — including
+// the saved transfer settings and the cron schedule — and checks that the
+// source paths and SSH keys exist, without binding the listen address or
+// starting the scheduler. Problems are written to w, and the result is the
+// process exit code: 0 if the config is usable, 1 otherwise.
+func checkConfig(path string, w io.Writer) int {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return 1
+	}
+
+	var problems []string
+	if err := cfg.LoadTransferSettings(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := cron.ParseStandard(cfg.Schedule); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid schedule %q: %v", cfg.Schedule, err))
+	}
+	problems = append(problems, preflightProblems(cfg)...)
+
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	if !cfg.TransferConfigured() {
+		fmt.Fprintln(w, "warning: transfer settings are not configured yet; set them in the web UI")
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "error: %s\n", p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Fprintf(w, "%s: ok\n", path)
+	return 0
+}
+
+// preflightProblems reports configured source paths and SSH keys that do
+// not exist, which would otherwise only surface when a backup runs.
+func preflightProblems(cfg *Config) []string {
+	var problems []string
+	for _, src := range cfg.Sources() {
+		if _, err := os.Stat(src); err != nil {
+			problems = append(problems, fmt.Sprintf("source path: %v", err))
+		}
+	}
+	if cfg.LocalDestination() {
+		return problems
+	}
+	for _, key := range cfg.SSHKeyPaths() {
+		if rest, ok := strings.CutPrefix(key, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				key = filepath.Join(home, rest) // ssh expands ~ itself
+			}
+		}
+		if _, err := os.Stat(key); err != nil {
+			problems = append(problems, fmt.Sprintf("ssh key: %v", err))
+		}
+	}
+	return problems
+}
+
+// parseListenAddr splits listen_addr into a network and address for
+// net.Listen: "unix:/path/to.sock" listens on a Unix domain socket, anything
+// else is a TCP address.
+func parseListenAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// listen opens the HTTP listener. For a Unix socket, a stale socket file
+// left by an unclean exit is removed first, and the new socket is made
+// accessible to the owner and group only (e.g. a reverse proxy sharing the
+// group).
+func listen(network, address string) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if info, err := os.Lstat(address); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", address)
+		}
+		os.Remove(address)
+	}
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// listenFailure explains why listen failed for the common causes, with what
+// to do about it, falling back to a generic message.
+func listenFailure(network, address string, err error) string {
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Sprintf("%s is already in use, probably by another instance; stop it or change listen_addr", address)
+	case errors.Is(err, syscall.EACCES) && network == "unix":
+		return fmt.Sprintf("permission denied creating %s; check that the socket's directory is writable by this user", address)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Sprintf("permission denied listening on %s; ports below 1024 need root or CAP_NET_BIND_SERVICE, so use a higher port or a reverse proxy", address)
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		return fmt.Sprintf("%s is not an address of this host; check listen_addr against the interface's IP", address)
+	}
+	return "failed to listen on " + address
+}
+
+// dashboardURL is the URL logged for a TCP listen address, with localhost
+// standing in for every interface.
+func dashboardURL(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "http://" + address
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// newLogger builds the application logger. The "json" format emits structured
+// JSON lines; anything else uses the human-readable console writer. Events
+// below the given level are dropped.
+func newLogger(w io.Writer, format, level string) zerolog.Logger {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil || level == "" {
+		lvl = zerolog.InfoLevel
+	}
+	if format != "json" {
+		w = zerolog.ConsoleWriter{Out: w}
+	}
+	return zerolog.New(w).Level(lvl).With().Timestamp().Logger()
+}
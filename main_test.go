@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "json", "info")
+
+	logger.Info().Str("source", "/mnt/plex-media").Msg("source configured")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "info" {
+		t.Errorf("level = %v, want info", entry["level"])
+	}
+	if entry["message"] != "source configured" {
+		t.Errorf("message = %v, want 'source configured'", entry["message"])
+	}
+	if entry["source"] != "/mnt/plex-media" {
+		t.Errorf("source = %v, want /mnt/plex-media", entry["source"])
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("expected a time field in JSON output")
+	}
+}
+
+func TestNewLogger_ConsoleFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "console", "info")
+
+	logger.Info().Msg("scheduler started")
+
+	out := buf.String()
+	if !strings.Contains(out, "scheduler started") {
+		t.Errorf("console output should contain the message, got %q", out)
+	}
+	if json.Valid(bytes.TrimSpace(buf.Bytes())) {
+		t.Errorf("console output should not be JSON, got %q", out)
+	}
+}
+
+func TestNewLogger_LevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "json", "warn")
+
+	logger.Debug().Msg("debug message")
+	logger.Info().Msg("info message")
+	logger.Warn().Msg("warn message")
+	logger.Error().Msg("error message")
+
+	out := buf.String()
+	if strings.Contains(out, "debug message") || strings.Contains(out, "info message") {
+		t.Errorf("messages below warn should be filtered, got:\n%s", out)
+	}
+	if !strings.Contains(out, "warn message") || !strings.Contains(out, "error message") {
+		t.Errorf("warn and error messages should be logged, got:\n%s", out)
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantAddress string
+	}{
+		{":8090", "tcp", ":8090"},
+		{"127.0.0.1:8090", "tcp", "127.0.0.1:8090"},
+		{"[::1]:8090", "tcp", "[::1]:8090"},
+		{"unix:/run/rsyncweb.sock", "unix", "/run/rsyncweb.sock"},
+	}
+	for _, tt := range tests {
+		network, address := parseListenAddr(tt.addr)
+		if network != tt.wantNetwork || address != tt.wantAddress {
+			t.Errorf("parseListenAddr(%q) = %q, %q, want %q, %q", tt.addr, network, address, tt.wantNetwork, tt.wantAddress)
+		}
+	}
+}
+
+func TestListenFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	addr := taken.Addr().String()
+	_, err = listen("tcp", addr)
+	if err == nil {
+		t.Fatal("expected an error listening on a port in use")
+	}
+	if msg := listenFailure("tcp", addr, err); !strings.Contains(msg, "already in use") || !strings.Contains(msg, addr) {
+		t.Errorf("listenFailure() = %q, want it to say %s is already in use", msg, addr)
+	}
+}
+
+func TestDashboardURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8090":          "http://localhost:8090",
+		"0.0.0.0:8090":   "http://localhost:8090",
+		"10.0.0.5:8090":  "http://10.0.0.5:8090",
+		"[fe80::1]:8090": "http://[fe80::1]:8090",
+	} {
+		if got := dashboardURL(addr); got != want {
+			t.Errorf("dashboardURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	// Socket paths are length-limited, so avoid the long t.TempDir() path
+	dir, err := os.MkdirTemp("", "rw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "web.sock")
+
+	// A stale socket from an unclean exit is replaced
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %v, want 0660", info.Mode().Perm())
+	}
+	l.Close()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket should be removed on close, stat err = %v", err)
+	}
+
+	// A regular file is never removed
+	os.WriteFile(sock, []byte("data"), 0644)
+	if _, err := listen("unix", sock); err == nil {
+		t.Error("expected an error when the socket path is a regular file")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "media")
+	os.Mkdir(src, 0755)
+
+	valid := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+log_dir: `+filepath.Join(dir, "logs")+`
+source_path: `+src+`
+remote_path: `+filepath.Join(dir, "backup")+`
+`)
+	var out bytes.Buffer
+	if code := checkConfig(valid, &out); code != 0 {
+		t.Errorf("checkConfig(valid) = %d, want 0; output:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "ok") {
+		t.Errorf("output = %q, want ok", out.String())
+	}
+
+	for name, content := range map[string]string{
+		"invalid yaml":     "schedule: [",
+		"invalid schedule": `schedule: "every night"`,
+		"missing source":   "schedule: \"0 3 * * *\"\nsource_path: " + filepath.Join(dir, "missing") + "\nremote_path: /backups",
+	} {
+		out.Reset()
+		path := writeTestConfig(t, t.TempDir(), "log_dir: "+filepath.Join(dir, "logs")+"\n"+content)
+		if code := checkConfig(path, &out); code == 0 {
+			t.Errorf("%s: checkConfig() = 0, want non-zero", name)
+		}
+		if !strings.Contains(out.String(), "error:") {
+			t.Errorf("%s: output = %q, want the problem reported", name, out.String())
+		}
+	}
+}
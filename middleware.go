@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// statusRecorder wraps an http.ResponseWriter to capture the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. for flushing).
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLogSkip lists paths that are polled frequently and would only add noise.
+var accessLogSkip = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// accessLogMiddleware logs the method, path, status code, and duration of each request.
+func accessLogMiddleware(logger zerolog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessLogSkip[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger.Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", rec.status).
+			Dur("duration", time.Since(start)).
+			Str("remote", r.RemoteAddr).
+			Msg("request")
+	})
+}
+
+// readOnlyMiddleware refuses every request that could change something,
+// i.e. anything but GET, HEAD and OPTIONS, with 403 Forbidden. It serves
+// read_only, so the dashboard can be shared without letting viewers
+// trigger backups or change settings.
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			http.Error(w, "the dashboard is read-only", http.StatusForbidden)
+		}
+	})
+}
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// newCSRFToken returns a random hex-encoded token.
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ensureCSRFToken returns the CSRF token from the request cookie, issuing a
+// new cookie if the request does not carry one yet.
+func ensureCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	token := newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// requireCSRF enforces a double-submit cookie check for state-changing
+// handlers: the token from the csrf_token cookie must also be sent in the
+// X-CSRF-Token header or the csrf_token form field. On mismatch it writes a
+// 403 response and returns false.
+func requireCSRF(w http.ResponseWriter, r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookieName)
+	token := r.Header.Get(csrfHeaderName)
+	if token == "" {
+		token = r.PostFormValue(csrfFormField)
+	}
+	if err != nil || cookie.Value == "" || token == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// minIntervalLimiter allows an action at most once per interval. The zero
+// value is ready to use; it is safe for concurrent use.
+type minIntervalLimiter struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// allow reports whether the action may proceed at now given the minimum
+// interval. When it may not, it also returns how long until it will be allowed.
+// An interval of zero or less disables limiting.
+func (l *minIntervalLimiter) allow(interval time.Duration, now time.Time) (bool, time.Duration) {
+	if interval <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		if wait := l.last.Add(interval).Sub(now); wait > 0 {
+			return false, wait
+		}
+	}
+	l.last = now
+	return true, 0
+}
+
+// retryAfterSeconds formats a wait duration for the Retry-After header,
+// rounding up to whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(secs)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestAccessLogMiddleware_LogsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	handler := accessLogMiddleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/api/settings", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["method"] != "DELETE" {
+		t.Errorf("method = %v, want DELETE", entry["method"])
+	}
+	if entry["path"] != "/api/settings" {
+		t.Errorf("path = %v, want /api/settings", entry["path"])
+	}
+	if entry["status"] != float64(http.StatusMethodNotAllowed) {
+		t.Errorf("status = %v, want 405", entry["status"])
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Error("expected a duration field")
+	}
+
+	// The wrapped writer must still pass the response through
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("response status = %d, want 405", w.Code)
+	}
+}
+
+func TestAccessLogMiddleware_ImplicitOK(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	handler := accessLogMiddleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), `"status":200`) {
+		t.Errorf("expected status 200 in log, got: %s", buf.String())
+	}
+}
+
+func TestAccessLogMiddleware_SkipsHealthPaths(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	handler := accessLogMiddleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, path := range []string{"/healthz", "/metrics"} {
+		req := httptest.NewRequest("GET", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("health and metrics requests should not be logged, got: %s", buf.String())
+	}
+}
+
+func TestMinIntervalLimiter(t *testing.T) {
+	var l minIntervalLimiter
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+
+	if ok, _ := l.allow(10*time.Second, start); !ok {
+		t.Fatal("first call should be allowed")
+	}
+	ok, wait := l.allow(10*time.Second, start.Add(4*time.Second))
+	if ok {
+		t.Fatal("call within the interval should be refused")
+	}
+	if wait != 6*time.Second {
+		t.Errorf("wait = %v, want 6s", wait)
+	}
+	if ok, _ := l.allow(10*time.Second, start.Add(10*time.Second)); !ok {
+		t.Error("call after the interval should be allowed")
+	}
+	if ok, _ := l.allow(0, start.Add(10*time.Second)); !ok {
+		t.Error("zero interval should disable limiting")
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Notifier delivers a message about a finished backup run to one channel.
+type Notifier interface {
+	Notify(run BackupRun) error
+}
+
+// NotifierConfig is one entry of the notifiers list in config.yaml. Type
+// selects the channel; only the fields for that type are used.
+type NotifierConfig struct {
+	Type string `yaml:"type"`
+	// On lists the run statuses that trigger a notification. Defaults to
+	// warning and failed, or every status for healthcheck, which needs the
+	// success pings.
+	On []BackupStatus `yaml:"on"`
+	// OnSlow also sends runs flagged slow (see expected_duration), even if
+	// their status is not in On.
+	OnSlow bool `yaml:"on_slow"`
+
+	// URL is the endpoint for webhook, slack, discord and healthcheck.
+	URL string `yaml:"url"`
+
+	// ntfy settings. NtfyServer defaults to https://ntfy.sh.
+	NtfyServer string `yaml:"ntfy_server"`
+	NtfyTopic  string `yaml:"ntfy_topic"`
+	NtfyToken  string `yaml:"ntfy_token"`
+
+	// Email settings
+	SMTPHost     string   `yaml:"smtp_host"`
+	SMTPPort     int      `yaml:"smtp_port"`
+	SMTPUsername string   `yaml:"smtp_username"`
+	SMTPPassword string   `yaml:"smtp_password"`
+	EmailFrom    string   `yaml:"email_from"`
+	EmailTo      []string `yaml:"email_to"`
+
+	// Secrets read from files (e.g. Docker or systemd credentials) instead
+	// of being written inline; see loadSecretFiles.
+	URLFile          string `yaml:"url_file"`
+	NtfyTokenFile    string `yaml:"ntfy_token_file"`
+	SMTPPasswordFile string `yaml:"smtp_password_file"`
+
+	// client sends HTTP notifications; set by buildNotifiers from
+	// notify_timeout, notifyClient otherwise.
+	client *http.Client
+	// timeout is notify_timeout, set by buildNotifiers, which bounds the
+	// SMTP session of an email notifier; defaultNotifyTimeout otherwise.
+	timeout time.Duration
+	// instance is instance_name, set by buildNotifiers, which prefixes
+	// notification titles.
+	instance string
+}
+
+// notifierTypes maps each supported notifier type to its constructor. The
+// constructor validates the type-specific fields.
+var notifierTypes = map[string]func(NotifierConfig) (Notifier, error){
+	"webhook":     newWebhookNotifier,
+	"slack":       newSlackNotifier,
+	"discord":     newDiscordNotifier,
+	"healthcheck": newHealthcheckNotifier,
+	"email":       newEmailNotifier,
+	"ntfy":        newNtfyNotifier,
+}
+
+// loadSecretFiles reads each *_file field into its inline counterpart.
+// Setting both forms of the same field is an error.
+func (nc *NotifierConfig) loadSecretFiles() error {
+	secrets := []struct {
+		name  string
+		path  string
+		value *string
+	}{
+		{"url", nc.URLFile, &nc.URL},
+		{"ntfy_token", nc.NtfyTokenFile, &nc.NtfyToken},
+		{"smtp_password", nc.SMTPPasswordFile, &nc.SMTPPassword},
+	}
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		if *secret.value != "" {
+			return fmt.Errorf("%s and %s_file are mutually exclusive", secret.name, secret.name)
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("reading %s_file: %w", secret.name, err)
+		}
+		// Secret files usually end in a newline that is not part of the value
+		*secret.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// newNotifier builds the notifier described by nc.
+func newNotifier(nc NotifierConfig) (Notifier, error) {
+	factory, ok := notifierTypes[nc.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported notifier type %q", nc.Type)
+	}
+	for _, s := range nc.On {
+		switch s {
+		case StatusSuccess, StatusWarning, StatusFailed:
+		default:
+			return nil, fmt.Errorf("on: status must be success, warning or failed, got %q", s)
+		}
+	}
+	return factory(nc)
+}
+
+// wants reports whether a run that ended with status should be sent.
+// Stale alerts go to every notifier.
+func (nc NotifierConfig) wants(status BackupStatus) bool {
+	if status == StatusStale {
+		return true
+	}
+	on := nc.On
+	if len(on) == 0 {
+		if nc.Type == "healthcheck" {
+			return true
+		}
+		on = []BackupStatus{StatusWarning, StatusFailed}
+	}
+	for _, s := range on {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredNotifier pairs a notifier with the config entry it was built
+// from, for the status policy and log context.
+type configuredNotifier struct {
+	cfg NotifierConfig
+	Notifier
+}
+
+// buildNotifiers constructs the configured notifiers, with HTTP requests
+// bounded by timeout. Invalid entries are rejected by Config.validate, so
+// any error here is only logged.
+func buildNotifiers(configs []NotifierConfig, timeout time.Duration, instance string) []configuredNotifier {
+	var out []configuredNotifier
+	client := newNotifyClient(timeout)
+	for i, nc := range configs {
+		nc.client = client
+		nc.timeout = timeout
+		nc.instance = instance
+		n, err := newNotifier(nc)
+		if err != nil {
+			log.Error().Err(err).Int("index", i).Msg("skipping notifier")
+			continue
+		}
+		out = append(out, configuredNotifier{cfg: nc, Notifier: n})
+	}
+	return out
+}
+
+// notify sends a finished run to every notifier whose policy matches its
+// status. Notifications are sent in the background, so a slow endpoint
+// never holds up the run; failures are logged and never affect it.
+func (ex *BackupExecutor) notify(run BackupRun) {
+	for _, n := range ex.notifiers {
+		if !n.cfg.wants(run.Status) && !(run.SlowWarning && n.cfg.OnSlow) {
+			continue
+		}
+		ex.notifications.Add(1)
+		go func(n configuredNotifier) {
+			defer ex.notifications.Done()
+			if err := n.Notify(run); err != nil {
+				log.Error().Err(err).Str("notifier", n.cfg.Type).Str("run", run.ID).Msg("notification failed")
+			}
+		}(n)
+	}
+}
+
+// FlushNotifications waits up to timeout for notifications still being
+// sent, so a run that finished during shutdown is still reported. It
+// reports whether all of them completed.
+func (ex *BackupExecutor) FlushNotifications(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		ex.notifications.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// notificationTitle is the one-line subject used by every channel,
+// prefixed with the instance name when there is one, e.g.
+// "[nas] Backup failed".
+func notificationTitle(instance string, run BackupRun) string {
+	if instance != "" {
+		return fmt.Sprintf("[%s] Backup %s", instance, run.Status)
+	}
+	return fmt.Sprintf("Backup %s", run.Status)
+}
+
+// notificationMessage summarises a finished run in plain text.
+func notificationMessage(run BackupRun) string {
+	if run.Status == StatusStale {
+		return "Backup is stale: " + run.Summary + "."
+	}
+	msg := fmt.Sprintf("Backup %s %s after %s: %s (exit code %d).",
+		run.ID, run.Status, run.Duration, run.Summary, run.ExitCode)
+	if run.Stats != nil {
+		msg += fmt.Sprintf(" Transferred %s in %d files.",
+			formatBytes(run.Stats.TransferredSize), run.Stats.FilesTransferred)
+	}
+	if run.SlowWarning {
+		msg += fmt.Sprintf(" It took more than %dx the expected duration.", slowRunFactor)
+	}
+	return msg
+}
+
+// defaultNotifyTimeout bounds each notification request when
+// notify_timeout is unset.
+const defaultNotifyTimeout = 10 * time.Second
+
+// notifyClient sends notifications for notifiers built outside
+// buildNotifiers.
+var notifyClient = newNotifyClient(defaultNotifyTimeout)
+
+// newNotifyClient returns the HTTP client for notifications: requests time
+// out after timeout and identify themselves as rsync-web/<version>.
+func newNotifyClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: userAgentTransport{base: http.DefaultTransport},
+	}
+}
+
+// userAgentTransport sets the User-Agent header on every request.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", "rsync-web/"+version)
+	return t.base.RoundTrip(req)
+}
+
+// httpClient returns the client the notifier should send requests with.
+func (nc NotifierConfig) httpClient() *http.Client {
+	if nc.client != nil {
+		return nc.client
+	}
+	return notifyClient
+}
+
+// postJSON POSTs v as JSON to url and treats any non-2xx response as an error.
+func postJSON(client *http.Client, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+func requireURL(nc NotifierConfig) error {
+	if nc.URL == "" {
+		return fmt.Errorf("%s notifier requires url", nc.Type)
+	}
+	if !strings.HasPrefix(nc.URL, "http://") && !strings.HasPrefix(nc.URL, "https://") {
+		return fmt.Errorf("%s notifier url must start with http:// or https://", nc.Type)
+	}
+	return nil
+}
+
+// webhookNotifier POSTs the title, message, instance name and full run as
+// JSON.
+type webhookNotifier struct {
+	url      string
+	client   *http.Client
+	instance string
+}
+
+func newWebhookNotifier(nc NotifierConfig) (Notifier, error) {
+	if err := requireURL(nc); err != nil {
+		return nil, err
+	}
+	return &webhookNotifier{url: nc.URL, client: nc.httpClient(), instance: nc.instance}, nil
+}
+
+func (n *webhookNotifier) Notify(run BackupRun) error {
+	return postJSON(n.client, n.url, struct {
+		Title    string    `json:"title"`
+		Message  string    `json:"message"`
+		Instance string    `json:"instance,omitempty"`
+		Run      BackupRun `json:"run"`
+	}{notificationTitle(n.instance, run), notificationMessage(run), n.instance, run})
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url      string
+	client   *http.Client
+	instance string
+}
+
+func newSlackNotifier(nc NotifierConfig) (Notifier, error) {
+	if err := requireURL(nc); err != nil {
+		return nil, err
+	}
+	return &slackNotifier{url: nc.URL, client: nc.httpClient(), instance: nc.instance}, nil
+}
+
+func (n *slackNotifier) Notify(run BackupRun) error {
+	text := fmt.Sprintf("*%s*\n%s", notificationTitle(n.instance, run), notificationMessage(run))
+	return postJSON(n.client, n.url, map[string]string{"text": text})
+}
+
+// discordNotifier posts to a Discord channel webhook.
+type discordNotifier struct {
+	url      string
+	client   *http.Client
+	instance string
+}
+
+func newDiscordNotifier(nc NotifierConfig) (Notifier, error) {
+	if err := requireURL(nc); err != nil {
+		return nil, err
+	}
+	return &discordNotifier{url: nc.URL, client: nc.httpClient(), instance: nc.instance}, nil
+}
+
+func (n *discordNotifier) Notify(run BackupRun) error {
+	content := fmt.Sprintf("**%s**\n%s", notificationTitle(n.instance, run), notificationMessage(run))
+	return postJSON(n.client, n.url, map[string]string{"content": content})
+}
+
+// healthcheckNotifier pings a dead man's switch such as healthchecks.io:
+// the URL itself after a successful run, URL + "/fail" otherwise.
+type healthcheckNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func newHealthcheckNotifier(nc NotifierConfig) (Notifier, error) {
+	if err := requireURL(nc); err != nil {
+		return nil, err
+	}
+	return &healthcheckNotifier{url: strings.TrimRight(nc.URL, "/"), client: nc.httpClient()}, nil
+}
+
+func (n *healthcheckNotifier) Notify(run BackupRun) error {
+	url := n.url
+	if run.Status != StatusSuccess {
+		url += "/fail"
+	}
+	resp, err := n.client.Post(url, "text/plain", strings.NewReader(notificationMessage(run)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// ntfyNotifier publishes to an ntfy topic, on ntfy.sh or a self-hosted
+// server.
+type ntfyNotifier struct {
+	url      string
+	token    string
+	client   *http.Client
+	instance string
+}
+
+func newNtfyNotifier(nc NotifierConfig) (Notifier, error) {
+	if nc.NtfyTopic == "" || strings.ContainsAny(nc.NtfyTopic, "/?# ") {
+		return nil, fmt.Errorf("ntfy notifier requires ntfy_topic without '/', '?', '#' or spaces")
+	}
+	server := nc.NtfyServer
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		return nil, fmt.Errorf("ntfy_server must start with http:// or https://")
+	}
+	return &ntfyNotifier{
+		url:      strings.TrimRight(server, "/") + "/" + nc.NtfyTopic,
+		token:    nc.NtfyToken,
+		client:   nc.httpClient(),
+		instance: nc.instance,
+	}, nil
+}
+
+// ntfyPriority returns the ntfy priority and tags for a run status. Tags
+// that match an emoji short code are shown as that emoji.
+func ntfyPriority(status BackupStatus) (priority, tags string) {
+	switch status {
+	case StatusFailed:
+		return "urgent", "warning,rotating_light"
+	case StatusWarning:
+		return "default", "warning"
+	case StatusStale:
+		return "high", "hourglass"
+	default:
+		return "low", "white_check_mark"
+	}
+}
+
+func (n *ntfyNotifier) Notify(run BackupRun) error {
+	req, err := http.NewRequest(http.MethodPost, n.url, strings.NewReader(notificationMessage(run)))
+	if err != nil {
+		return err
+	}
+	priority, tags := ntfyPriority(run.Status)
+	req.Header.Set("Title", notificationTitle(n.instance, run))
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", tags)
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", n.url, resp.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends a plain-text mail through an SMTP server, using
+// STARTTLS when offered and PLAIN auth when a username is set.
+type emailNotifier struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	to       []string
+	timeout  time.Duration
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	instance string
+}
+
+func newEmailNotifier(nc NotifierConfig) (Notifier, error) {
+	if nc.SMTPHost == "" || nc.EmailFrom == "" || len(nc.EmailTo) == 0 {
+		return nil, fmt.Errorf("email notifier requires smtp_host, email_from and email_to")
+	}
+	port := nc.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("smtp_port %d out of range", port)
+	}
+	timeout := nc.timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	n := &emailNotifier{
+		addr:     nc.SMTPHost + ":" + strconv.Itoa(port),
+		from:     nc.EmailFrom,
+		to:       nc.EmailTo,
+		timeout:  timeout,
+		instance: nc.instance,
+	}
+	n.sendMail = n.send
+	if nc.SMTPUsername != "" {
+		n.auth = smtp.PlainAuth("", nc.SMTPUsername, nc.SMTPPassword, nc.SMTPHost)
+	}
+	return n, nil
+}
+
+func (n *emailNotifier) Notify(run BackupRun) error {
+	return n.sendMail(n.addr, n.auth, n.from, n.to, n.message(run))
+}
+
+// send delivers msg like smtp.SendMail, but with the whole SMTP session,
+// from dialing to QUIT, bounded by the notifier's timeout so a server that
+// stops responding cannot hold up the notification forever.
+func (n *emailNotifier) send(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, n.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(n.timeout)); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (n *emailNotifier) message(run BackupRun) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", notificationTitle(n.instance, run))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(notificationMessage(run))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records every run it is asked to send.
+type fakeNotifier struct {
+	name string
+	sent chan<- string
+}
+
+func (f *fakeNotifier) Notify(run BackupRun) error {
+	f.sent <- f.name + ":" + string(run.Status)
+	return nil
+}
+
+func TestNotify_FansOutToMatchingNotifiers(t *testing.T) {
+	sent := make(chan string, 10)
+	notifierTypes["fake"] = func(nc NotifierConfig) (Notifier, error) {
+		return &fakeNotifier{name: nc.URL, sent: sent}, nil
+	}
+	defer delete(notifierTypes, "fake")
+
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	cfg.Notifiers = []NotifierConfig{
+		{Type: "fake", URL: "slack"},
+		{Type: "fake", URL: "email", On: []BackupStatus{StatusFailed}},
+		{Type: "fake", URL: "success-only", On: []BackupStatus{StatusSuccess}},
+	}
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(12, "protocol error")
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	timeout := time.After(10 * time.Second)
+	for len(got) < 2 {
+		select {
+		case s := <-sent:
+			got = append(got, s)
+		case <-timeout:
+			t.Fatalf("got notifications %v, want 2", got)
+		}
+	}
+	// Sent concurrently, so in no particular order
+	sort.Strings(got)
+	if got[0] != "email:failed" || got[1] != "slack:failed" {
+		t.Errorf("notifications = %v, want slack and email for the failed run", got)
+	}
+	select {
+	case s := <-sent:
+		t.Errorf("unexpected notification %q for a notifier limited to success", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFinishRun_DoesNotWaitForSlowNotifier(t *testing.T) {
+	release := make(chan struct{})
+	userAgents := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.Header.Get("User-Agent")
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	cfg.Notifiers = []NotifierConfig{{Type: "webhook", URL: ts.URL}}
+	cfg.NotifyTimeout = time.Minute
+	ex := NewBackupExecutor(cfg)
+
+	run := &BackupRun{ID: "20260101-030000.000", StartTime: time.Now(), Status: StatusRunning}
+	ex.current = run
+	start := time.Now()
+	ex.finishRun(run, StatusFailed, 12, "protocol error", nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("finishRun took %v with a hung webhook, want it to return promptly", elapsed)
+	}
+
+	select {
+	case ua := <-userAgents:
+		if ua != "rsync-web/"+version {
+			t.Errorf("User-Agent = %q, want rsync-web/%s", ua, version)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was never called")
+	}
+	if ex.FlushNotifications(100 * time.Millisecond) {
+		t.Error("FlushNotifications() = true while the webhook is still hanging")
+	}
+}
+
+func TestNotifyClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	n, err := newNotifier(NotifierConfig{Type: "webhook", URL: ts.URL, client: newNotifyClient(100 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := n.Notify(BackupRun{Status: StatusFailed}); err == nil {
+		t.Error("expected a timeout error from a hung webhook")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify() took %v, want it bounded by the 100ms timeout", elapsed)
+	}
+}
+
+func TestNotifierConfig_Wants(t *testing.T) {
+	tests := []struct {
+		nc     NotifierConfig
+		status BackupStatus
+		want   bool
+	}{
+		{NotifierConfig{Type: "slack"}, StatusFailed, true},
+		{NotifierConfig{Type: "slack"}, StatusWarning, true},
+		{NotifierConfig{Type: "slack"}, StatusSuccess, false},
+		{NotifierConfig{Type: "healthcheck"}, StatusSuccess, true},
+		{NotifierConfig{Type: "webhook", On: []BackupStatus{StatusSuccess}}, StatusSuccess, true},
+		{NotifierConfig{Type: "webhook", On: []BackupStatus{StatusSuccess}}, StatusFailed, false},
+	}
+	for _, tt := range tests {
+		if got := tt.nc.wants(tt.status); got != tt.want {
+			t.Errorf("%s on %v wants(%s) = %v, want %v", tt.nc.Type, tt.nc.On, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestNewNotifier_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		nc   NotifierConfig
+	}{
+		{"unknown type", NotifierConfig{Type: "pager"}},
+		{"missing url", NotifierConfig{Type: "slack"}},
+		{"non-http url", NotifierConfig{Type: "webhook", URL: "file:///etc/passwd"}},
+		{"bad status", NotifierConfig{Type: "discord", URL: "https://discord.test/hook", On: []BackupStatus{StatusRunning}}},
+		{"email without recipients", NotifierConfig{Type: "email", SMTPHost: "mail.test", EmailFrom: "backup@test"}},
+	}
+	for _, tt := range tests {
+		if _, err := newNotifier(tt.nc); err == nil {
+			t.Errorf("%s: newNotifier() should fail", tt.name)
+		}
+	}
+}
+
+func TestLoadConfig_Notifiers(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+notifiers:
+  - type: slack
+    url: https://hooks.slack.test/T000
+  - type: healthcheck
+    url: https://hc-ping.test/abc
+    on: [success, failed]
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Notifiers) != 2 || cfg.Notifiers[1].On[1] != StatusFailed {
+		t.Errorf("notifiers = %+v", cfg.Notifiers)
+	}
+
+	path = writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+notifiers:
+  - type: carrier-pigeon
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "notifiers[0]") {
+		t.Errorf("LoadConfig() error = %v, want a notifiers[0] error", err)
+	}
+}
+
+func TestLoadConfig_NotifierSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := func(name, value string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := writeTestConfig(t, dir, `
+schedule: "0 3 * * *"
+notifiers:
+  - type: email
+    smtp_host: smtp.example.test
+    smtp_password_file: `+secret("smtp", "s3cret\n")+`
+    email_from: backup@example.test
+    email_to: [me@example.test]
+  - type: slack
+    url_file: `+secret("slack", "https://hooks.slack.test/T000\n")+`
+  - type: ntfy
+    ntfy_topic: backups
+    ntfy_token_file: `+secret("ntfy", "tk_abc")+`
+  - type: webhook
+    url: https://inline.test/hook
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if got := cfg.Notifiers[0].SMTPPassword; got != "s3cret" {
+		t.Errorf("smtp_password from file = %q, want s3cret", got)
+	}
+	if got := cfg.Notifiers[1].URL; got != "https://hooks.slack.test/T000" {
+		t.Errorf("url from file = %q", got)
+	}
+	if got := cfg.Notifiers[2].NtfyToken; got != "tk_abc" {
+		t.Errorf("ntfy_token from file = %q, want tk_abc", got)
+	}
+	if got := cfg.Notifiers[3].URL; got != "https://inline.test/hook" {
+		t.Errorf("inline url = %q", got)
+	}
+
+	for name, entry := range map[string]string{
+		"both forms":   "url: https://inline.test/hook\n    url_file: " + secret("hook", "https://file.test/hook"),
+		"missing file": "url_file: " + filepath.Join(dir, "missing"),
+	} {
+		path := writeTestConfig(t, dir, "schedule: \"0 3 * * *\"\nnotifiers:\n  - type: webhook\n    "+entry+"\n")
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "url_file") {
+			t.Errorf("%s: LoadConfig() error = %v, want a url_file error", name, err)
+		}
+	}
+}
+
+func TestHTTPNotifiers_Payloads(t *testing.T) {
+	type request struct {
+		path string
+		body string
+	}
+	requests := make(chan request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.URL.Path, string(body)}
+	}))
+	defer ts.Close()
+
+	run := BackupRun{ID: "20260101-030000", Status: StatusFailed, Duration: "5s", Summary: "protocol error", ExitCode: 12}
+
+	tests := []struct {
+		typ      string
+		wantPath string
+		wantBody string
+	}{
+		{"webhook", "/hook", `"run":{"id":"20260101-030000"`},
+		{"slack", "/hook", `"text":"*Backup failed*`},
+		{"discord", "/hook", `"content":"**Backup failed**`},
+		{"healthcheck", "/hook/fail", "protocol error (exit code 12)"},
+	}
+	for _, tt := range tests {
+		n, err := newNotifier(NotifierConfig{Type: tt.typ, URL: ts.URL + "/hook"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Notify(run); err != nil {
+			t.Fatalf("%s: Notify() error = %v", tt.typ, err)
+		}
+		got := <-requests
+		if got.path != tt.wantPath {
+			t.Errorf("%s: path = %q, want %q", tt.typ, got.path, tt.wantPath)
+		}
+		if !strings.Contains(got.body, tt.wantBody) {
+			t.Errorf("%s: body = %s, want it to contain %s", tt.typ, got.body, tt.wantBody)
+		}
+	}
+}
+
+func TestBuildNotifiers_InstanceName(t *testing.T) {
+	bodies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer ts.Close()
+
+	notifiers := buildNotifiers([]NotifierConfig{
+		{Type: "webhook", URL: ts.URL},
+		{Type: "slack", URL: ts.URL},
+	}, time.Second, "nas-01")
+	run := BackupRun{ID: "20260101-030000", Status: StatusFailed}
+
+	wants := [][]string{
+		{`"title":"[nas-01] Backup failed"`, `"instance":"nas-01"`},
+		{`"text":"*[nas-01] Backup failed*`},
+	}
+	for i, n := range notifiers {
+		if err := n.Notify(run); err != nil {
+			t.Fatalf("%s: Notify() error = %v", n.cfg.Type, err)
+		}
+		body := <-bodies
+		for _, want := range wants[i] {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: body = %s, want it to contain %s", n.cfg.Type, body, want)
+			}
+		}
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	n, _ := newNotifier(NotifierConfig{Type: "webhook", URL: ts.URL})
+	if err := n.Notify(BackupRun{Status: StatusFailed}); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	n, err := newNotifier(NotifierConfig{
+		Type:         "email",
+		SMTPHost:     "mail.test",
+		SMTPUsername: "backup",
+		SMTPPassword: "secret",
+		EmailFrom:    "backup@test",
+		EmailTo:      []string{"me@test", "you@test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotAddr string
+	var gotTo []string
+	var gotMsg []byte
+	n.(*emailNotifier).sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMsg = addr, to, msg
+		return nil
+	}
+
+	run := BackupRun{ID: "20260101-030000", Status: StatusWarning, Summary: "partial transfer", ExitCode: 23,
+		Stats: &TransferStats{TransferredSize: 2048, FilesTransferred: 3}}
+	if err := n.Notify(run); err != nil {
+		t.Fatal(err)
+	}
+	if gotAddr != "mail.test:587" || len(gotTo) != 2 {
+		t.Errorf("sent to %s %v, want mail.test:587 and both recipients", gotAddr, gotTo)
+	}
+	msg := string(gotMsg)
+	for _, want := range []string{"Subject: Backup warning\r\n", "To: me@test, you@test\r\n", "Transferred 2.0 KiB in 3 files."} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message = %q, want it to contain %q", msg, want)
+		}
+	}
+}
+
+func TestEmailNotifier_Timeout(t *testing.T) {
+	// An SMTP server that accepts the connection but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	smtpPort, _ := strconv.Atoi(port)
+	notifiers := buildNotifiers([]NotifierConfig{{
+		Type: "email", SMTPHost: host, SMTPPort: smtpPort, EmailFrom: "backup@test", EmailTo: []string{"me@test"},
+	}}, 200*time.Millisecond, "")
+
+	start := time.Now()
+	if err := notifiers[0].Notify(BackupRun{ID: "20260101-030000", Status: StatusFailed}); err == nil {
+		t.Error("expected an error from an SMTP server that never responds")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Notify() took %s, want it bounded by notify_timeout", elapsed)
+	}
+}
+
+func TestNotificationMessage(t *testing.T) {
+	run := BackupRun{ID: "20260101-030000", Status: StatusSuccess, Duration: "1m0s", Summary: "completed successfully"}
+	want := "Backup 20260101-030000 success after 1m0s: completed successfully (exit code 0)."
+	if got := notificationMessage(run); got != want {
+		t.Errorf("notificationMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	var got *http.Request
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, body = r, string(b)
+	}))
+	defer ts.Close()
+
+	n, err := newNotifier(NotifierConfig{Type: "ntfy", NtfyServer: ts.URL + "/", NtfyTopic: "backups", NtfyToken: "tk_secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.(*ntfyNotifier).client = ts.Client()
+
+	run := BackupRun{ID: "20260101-030000", Status: StatusFailed, Duration: "5s", Summary: "protocol error", ExitCode: 12}
+	if err := n.Notify(run); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/backups" {
+		t.Errorf("request = %s %s, want POST /backups", got.Method, got.URL.Path)
+	}
+	wantHeaders := map[string]string{
+		"Title":         "Backup failed",
+		"Priority":      "urgent",
+		"Tags":          "warning,rotating_light",
+		"Authorization": "Bearer tk_secret",
+	}
+	for k, v := range wantHeaders {
+		if got.Header.Get(k) != v {
+			t.Errorf("%s header = %q, want %q", k, got.Header.Get(k), v)
+		}
+	}
+	if !strings.Contains(body, "protocol error (exit code 12)") {
+		t.Errorf("body = %q, want the run summary", body)
+	}
+}
+
+func TestNtfyNotifier_DefaultServer(t *testing.T) {
+	n, err := newNotifier(NotifierConfig{Type: "ntfy", NtfyTopic: "backups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nn := n.(*ntfyNotifier)
+	if nn.url != "https://ntfy.sh/backups" || nn.token != "" {
+		t.Errorf("ntfy notifier = %+v, want https://ntfy.sh/backups without a token", nn)
+	}
+	if p, tags := ntfyPriority(StatusWarning); p != "default" || tags != "warning" {
+		t.Errorf("warning priority = %s %s, want default warning", p, tags)
+	}
+
+	if _, err := newNotifier(NotifierConfig{Type: "ntfy", NtfyTopic: "a/b"}); err == nil {
+		t.Error("expected an error for a topic containing '/'")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never observe a partially written file.
+// The previous contents are kept as path + ".bak" for readJSONFile to fall
+// back on.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Hard-link the current file to .bak: the rename below replaces the
+	// directory entry, not the inode, so the backup keeps the old contents
+	// and path itself is never missing. Best effort only.
+	bak := path + ".bak"
+	os.Remove(bak)
+	if err := os.Link(path, bak); err != nil && !os.IsNotExist(err) {
+		log.Debug().Err(err).Str("file", path).Msg("could not keep backup copy")
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// readJSONFile decodes the JSON file at path into v. If the file exists but
+// cannot be read or parsed (e.g. truncated by a crash mid-write), the .bak
+// copy left by writeFileAtomic is tried instead. The original error is
+// returned when neither copy is usable; os.IsNotExist reports a missing file.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err == nil || os.IsNotExist(err) {
+		return err
+	}
+
+	bak := path + ".bak"
+	data, bakErr := os.ReadFile(bak)
+	if bakErr == nil {
+		bakErr = json.Unmarshal(data, v)
+	}
+	if bakErr != nil {
+		return err
+	}
+	log.Warn().Err(err).Str("file", path).Str("backup", bak).Msg("file is corrupt, recovered from backup copy")
+	return nil
+}
+
+// quarantineFile renames an unusable file to path + ".corrupt-<timestamp>",
+// so that starting afresh does not overwrite data the user may still be
+// able to recover by hand. It returns the new path.
+func quarantineFile(path string, now time.Time) (string, error) {
+	dest := path + ".corrupt-" + now.Format("20060102-150405")
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
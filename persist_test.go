@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic_KeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	if err := writeFileAtomic(path, []byte(`["first"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("no .bak expected after the first write, stat err = %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte(`["second"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `["second"]` {
+		t.Errorf("file = %s, want the new contents", data)
+	}
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != `["first"]` {
+		t.Errorf(".bak = %s, want the previous contents", data)
+	}
+
+	// No temp files left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("leftover temp file %s", e.Name())
+		}
+	}
+}
+
+func TestReadJSONFile_FallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	writeFileAtomic(path, []byte(`{"total_runs": 4}`), 0644)
+	writeFileAtomic(path, []byte(`{"total_runs": 5}`), 0644)
+
+	// Simulate a crash that left the main file truncated
+	os.WriteFile(path, []byte(`{"total_ru`), 0644)
+
+	var totals CumulativeStats
+	if err := readJSONFile(path, &totals); err != nil {
+		t.Fatalf("readJSONFile() error = %v, want recovery from .bak", err)
+	}
+	if totals.TotalRuns != 4 {
+		t.Errorf("TotalRuns = %d, want 4 from the backup copy", totals.TotalRuns)
+	}
+}
+
+func TestReadJSONFile_Missing(t *testing.T) {
+	var v map[string]any
+	if err := readJSONFile(filepath.Join(t.TempDir(), "nope.json"), &v); !os.IsNotExist(err) {
+		t.Errorf("readJSONFile() error = %v, want not-exist", err)
+	}
+}
+
+func TestReadJSONFile_CorruptWithoutBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	os.WriteFile(path, []byte(`[{"id": `), 0644)
+
+	var runs []BackupRun
+	if err := readJSONFile(path, &runs); err == nil {
+		t.Error("expected an error for a corrupt file with no backup copy")
+	}
+}
+
+func TestHistory_RecoversFromPartialWrite(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "ok")
+
+	for i := 0; i < 2; i++ {
+		if err := ex.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Truncate history.json as if the process died mid-write
+	historyPath := filepath.Join(cfg.LogDir, "history.json")
+	data, _ := os.ReadFile(historyPath)
+	os.WriteFile(historyPath, data[:len(data)/2], 0644)
+
+	ex2 := NewBackupExecutor(cfg)
+	history := ex2.History()
+	if len(history) != 1 {
+		t.Fatalf("history length = %d, want 1 run recovered from history.json.bak", len(history))
+	}
+	if history[0].Status != StatusSuccess {
+		t.Errorf("recovered run status = %q, want success", history[0].Status)
+	}
+}
+
+func TestHistory_QuarantinesUnreadableFile(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	historyPath := filepath.Join(cfg.LogDir, "history.json")
+	corrupt := []byte(`[{"id": "20260101-030000", "status": `)
+	os.WriteFile(historyPath, corrupt, 0644)
+
+	ex := NewBackupExecutor(cfg)
+	if n := len(ex.History()); n != 0 {
+		t.Errorf("history length = %d, want a fresh, empty history", n)
+	}
+
+	matches, _ := filepath.Glob(historyPath + ".corrupt-*")
+	if len(matches) != 1 {
+		t.Fatalf("found %v, want one history.json.corrupt-<timestamp>", matches)
+	}
+	if data, _ := os.ReadFile(matches[0]); string(data) != string(corrupt) {
+		t.Errorf("quarantined copy = %q, want the original contents", data)
+	}
+	if _, err := os.Stat(historyPath); !os.IsNotExist(err) {
+		t.Errorf("history.json should have been moved aside, stat err = %v", err)
+	}
+
+	// The next save starts a new file and leaves the quarantined one alone
+	ex.cmdFactory = fakeRsyncCmd(0, "ok")
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(matches[0]); string(data) != string(corrupt) {
+		t.Error("quarantined copy changed after a save")
+	}
+}
+
+func TestQuarantineFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	os.WriteFile(path, []byte("{"), 0644)
+
+	moved, err := quarantineFile(path, time.Date(2026, 3, 14, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(moved, "history.json.corrupt-20260314-030405") {
+		t.Errorf("moved to %s, want history.json.corrupt-20260314-030405", moved)
+	}
+}
+
+func TestLoadTransferSettings_RecoversFromBackup(t *testing.T) {
+	cfg := &Config{LogDir: t.TempDir()}
+	cfg.ApplyTransferSettings(TransferSettings{SourcePath: "/data", RemoteHost: "user@host", RemotePath: "/backup", SSHKeyPath: "~/.ssh/key"})
+	cfg.SaveTransferSettings()
+	cfg.SourcePath = "/data2"
+	cfg.SaveTransferSettings()
+
+	os.WriteFile(cfg.SettingsFilePath(), []byte(`{"source_path": "/da`), 0644)
+
+	loaded := &Config{LogDir: cfg.LogDir}
+	if err := loaded.LoadTransferSettings(); err != nil {
+		t.Fatalf("LoadTransferSettings() error = %v, want recovery from .bak", err)
+	}
+	if loaded.SourcePath != "/data" || loaded.RemoteHost != "user@host" {
+		t.Errorf("loaded settings = %+v, want the previous saved settings", loaded.GetTransferSettings())
+	}
+}
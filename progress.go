@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunProgress is the latest overall progress reported by rsync
+// --info=progress2 for the running backup.
+type RunProgress struct {
+	BytesTransferred int64     `json:"bytes_transferred"`
+	Percent          int       `json:"percent"`
+	Rate             string    `json:"rate"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// ETA is the estimated completion time, zero until rsync reports a
+	// non-zero percentage.
+	ETA time.Time `json:"eta,omitempty"`
+}
+
+// progress2Line matches an rsync --info=progress2 update, e.g.
+// "  1,234,567  12%   10.50MB/s    0:01:23 (xfr#5, to-chk=100/200)".
+var progress2Line = regexp.MustCompile(`^\s*([\d,]+)\s+(\d{1,3})%\s+(\S+/s)\s+\d+:\d{2}:\d{2}`)
+
+// parseProgress2 parses a single progress2 update line.
+func parseProgress2(line string) (RunProgress, bool) {
+	m := progress2Line.FindStringSubmatch(line)
+	if m == nil {
+		return RunProgress{}, false
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+	if err != nil {
+		return RunProgress{}, false
+	}
+	pct, _ := strconv.Atoi(m[2])
+	return RunProgress{BytesTransferred: n, Percent: pct, Rate: m[3]}, true
+}
+
+// estimateETA extrapolates the completion time from the elapsed time and
+// the percentage done. It returns the zero time while the percentage is 0.
+func estimateETA(start, now time.Time, percent int) time.Time {
+	if percent <= 0 {
+		return time.Time{}
+	}
+	if percent >= 100 {
+		return now
+	}
+	elapsed := now.Sub(start)
+	remaining := time.Duration(float64(elapsed) * float64(100-percent) / float64(percent))
+	return now.Add(remaining)
+}
+
+// formatETA renders the ETA shown on the dashboard for a running backup.
+func formatETA(p *RunProgress, now time.Time) string {
+	if p == nil || p.ETA.IsZero() {
+		return "calculating"
+	}
+	d := p.ETA.Sub(now).Round(time.Second)
+	if d <= 0 {
+		return "finishing"
+	}
+	return fmt.Sprintf("%s (%d%%)", d, p.Percent)
+}
+
+// maxProgressLine bounds the partial line kept between writes, so output
+// without line breaks cannot grow the buffer without limit.
+const maxProgressLine = 4096
+
+// progressWriter passes rsync's stdout through to w while scanning it for
+// progress2 updates, which rsync separates with carriage returns.
+type progressWriter struct {
+	w      io.Writer
+	buf    []byte
+	update func(RunProgress)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.buf = append(p.buf, b[:n]...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if prog, ok := parseProgress2(string(p.buf[:i])); ok {
+			p.update(prog)
+		}
+		p.buf = p.buf[i+1:]
+	}
+	if len(p.buf) > maxProgressLine {
+		p.buf = append([]byte(nil), p.buf[len(p.buf)-maxProgressLine:]...)
+	}
+	return n, err
+}
+
+// setProgress records a progress update on the running backup.
+func (ex *BackupExecutor) setProgress(run *BackupRun, prog RunProgress) {
+	now := ex.clock.Now()
+	prog.UpdatedAt = now
+	prog.ETA = estimateETA(run.StartTime, now, prog.Percent)
+
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.current == run {
+		run.Progress = &prog
+	}
+}
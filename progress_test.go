@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseProgress2(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantOK  bool
+		bytes   int64
+		percent int
+		rate    string
+	}{
+		{"      1,234,567  12%   10.50MB/s    0:01:23 (xfr#5, to-chk=100/200)", true, 1234567, 12, "10.50MB/s"},
+		{"  800,000,000,000 100%  120.00MB/s    1:50:00 (xfr#900, to-chk=0/1234)", true, 800000000000, 100, "120.00MB/s"},
+		{"              0   0%    0.00kB/s    0:00:00", true, 0, 0, "0.00kB/s"},
+		{"movies/Big Movie (2024).mkv", false, 0, 0, ""},
+		{"Number of files: 1,234 (reg: 1,000, dir: 234)", false, 0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseProgress2(tt.line)
+		if ok != tt.wantOK {
+			t.Errorf("parseProgress2(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.BytesTransferred != tt.bytes || got.Percent != tt.percent || got.Rate != tt.rate {
+			t.Errorf("parseProgress2(%q) = %+v, want %d bytes, %d%%, %s", tt.line, got, tt.bytes, tt.percent, tt.rate)
+		}
+	}
+}
+
+func TestEstimateETA(t *testing.T) {
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	now := start.Add(10 * time.Minute)
+
+	if eta := estimateETA(start, now, 0); !eta.IsZero() {
+		t.Errorf("ETA at 0%% = %v, want zero (still calculating)", eta)
+	}
+	if eta := estimateETA(start, now, 25); !eta.Equal(now.Add(30 * time.Minute)) {
+		t.Errorf("ETA at 25%% after 10m = %v, want 30m from now", eta)
+	}
+	if eta := estimateETA(start, now, 100); !eta.Equal(now) {
+		t.Errorf("ETA at 100%% = %v, want now", eta)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	now := time.Now()
+	if got := formatETA(nil, now); got != "calculating" {
+		t.Errorf("formatETA(nil) = %q, want calculating", got)
+	}
+	if got := formatETA(&RunProgress{Percent: 0}, now); got != "calculating" {
+		t.Errorf("formatETA(0%%) = %q, want calculating", got)
+	}
+	if got := formatETA(&RunProgress{Percent: 40, ETA: now.Add(90 * time.Second)}, now); got != "1m30s (40%)" {
+		t.Errorf("formatETA() = %q, want 1m30s (40%%)", got)
+	}
+}
+
+func TestProgressWriter_SplitWrites(t *testing.T) {
+	var out bytes.Buffer
+	var updates []RunProgress
+	pw := &progressWriter{w: &out, update: func(p RunProgress) { updates = append(updates, p) }}
+
+	// Updates separated by \r, split across arbitrary write boundaries
+	stream := "sending incremental file list\n" +
+		"      1,000  10%    1.00MB/s    0:00:09\r" +
+		"      5,000  50%    1.00MB/s    0:00:05\r" +
+		"     10,000 100%    1.00MB/s    0:00:10 (xfr#1, to-chk=0/1)\n"
+	for i := 0; i < len(stream); i += 7 {
+		end := i + 7
+		if end > len(stream) {
+			end = len(stream)
+		}
+		pw.Write([]byte(stream[i:end]))
+	}
+
+	if out.String() != stream {
+		t.Error("output should be passed through unchanged")
+	}
+	if len(updates) != 3 {
+		t.Fatalf("got %d progress updates, want 3", len(updates))
+	}
+	if updates[1].Percent != 50 || updates[2].BytesTransferred != 10000 {
+		t.Errorf("updates = %+v", updates)
+	}
+}
+
+func TestBackup_ProgressAndETA(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", `printf '      5,000  50%%    1.00MB/s    0:00:05\r'; sleep 0.5`)
+	}
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var progress *RunProgress
+	for time.Now().Before(deadline) {
+		if cur := ex.Current(); cur != nil && cur.Progress != nil {
+			progress = cur.Progress
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if progress == nil {
+		t.Fatal("no progress recorded on the running backup")
+	}
+	if progress.Percent != 50 || progress.ETA.IsZero() {
+		t.Errorf("progress = %+v, want 50%% with an ETA", progress)
+	}
+
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if last := ex.LastRun(); last.Progress != nil {
+		t.Errorf("finished run should not keep live progress, got %+v", last.Progress)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// remoteCheckTTL is how long a remote check result is reused. The dashboard
+// polls the remote-warning fragment and monitors poll /readyz?deep=1, and
+// each check is an SSH login.
+const remoteCheckTTL = 30 * time.Second
+
+// remoteCheckResult is the outcome of one SSH remote check. Reachability
+// checks only set err.
+type remoteCheckResult struct {
+	nonEmpty bool
+	files    []string
+	err      error
+}
+
+// remoteCheckCache shares SSH remote checks between callers: a result is
+// reused for remoteCheckTTL, and callers arriving while a check is running
+// wait for it instead of opening another connection. Results are keyed by
+// the transfer settings, so saving new ones starts a fresh check.
+type remoteCheckCache struct {
+	mu       sync.Mutex
+	settings TransferSettings
+	result   *remoteCheckResult
+	at       time.Time
+	// inflight is closed when the running check finishes, nil if none.
+	inflight chan struct{}
+	// gen is bumped by invalidate, so a check started before it is not
+	// cached.
+	gen int
+}
+
+// do returns the cached result for settings or runs check, at most one at
+// a time.
+func (c *remoteCheckCache) do(settings TransferSettings, now func() time.Time, check func() remoteCheckResult) remoteCheckResult {
+	c.mu.Lock()
+	for {
+		if c.result != nil && c.settings == settings && now().Sub(c.at) < remoteCheckTTL {
+			res := *c.result
+			c.mu.Unlock()
+			return res
+		}
+		if c.inflight == nil {
+			break
+		}
+		done := c.inflight
+		c.mu.Unlock()
+		<-done
+		c.mu.Lock()
+	}
+	done := make(chan struct{})
+	c.inflight = done
+	gen := c.gen
+	c.mu.Unlock()
+
+	res := check()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inflight = nil
+	close(done)
+	if gen == c.gen {
+		c.settings, c.result, c.at = settings, &res, now()
+	}
+	return res
+}
+
+// invalidate drops the cached result, e.g. after a backup has written to
+// the destination.
+func (c *remoteCheckCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result = nil
+	c.gen++
+}
+
+// CheckReachable tests the SSH login to the saved remote host, as
+// TestConnection does, for deep readiness probes. Results are shared like
+// CheckRemotePath's, so frequent probes do not each open a session. A local
+// destination needs no connection and is always reachable.
+func (ex *BackupExecutor) CheckReachable() error {
+	if ex.cfg.LocalDestination() {
+		return nil
+	}
+	settings := ex.cfg.GetTransferSettings()
+	res := ex.reachability.do(settings, ex.clock.Now, func() remoteCheckResult {
+		return remoteCheckResult{err: ex.TestConnection(settings.RemoteHost, settings.SSHKeyPath)}
+	})
+	return res.err
+}
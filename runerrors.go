@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RunError is a per-file error rsync reported during a run, e.g.
+// `rsync: send_files failed to open "/src/a.mkv": Permission denied (13)`.
+type RunError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Errno is the system error number rsync appended, 0 if none.
+	Errno int `json:"errno,omitempty"`
+}
+
+// maxRunErrors bounds the errors kept per run; the full list is in the log.
+const maxRunErrors = 100
+
+// errnoSuffix matches the " (13)" errno rsync appends to a message.
+var errnoSuffix = regexp.MustCompile(`\s*\((\d+)\)$`)
+
+// parseRunError parses one line of rsync output naming a file it could not
+// handle. rsync quotes the path and may tag the line with the process that
+// hit the error, e.g. "rsync: [sender] readlink_stat("/src/x") failed: No
+// such file or directory (2)". Lines without a quoted path, such as the
+// final "rsync error: ... (code 23)", are not per-file errors.
+func parseRunError(line string) (RunError, bool) {
+	line = strings.TrimSpace(line)
+	rest, ok := strings.CutPrefix(line, "rsync: ")
+	if ok {
+		if strings.HasPrefix(rest, "[") {
+			if i := strings.Index(rest, "] "); i >= 0 {
+				rest = rest[i+2:]
+			}
+		}
+	} else if strings.HasPrefix(line, "file has vanished: ") {
+		rest = line
+	} else {
+		return RunError{}, false
+	}
+
+	open, closing := strings.Index(rest, `"`), strings.LastIndex(rest, `"`)
+	if open < 0 || closing <= open+1 {
+		return RunError{}, false
+	}
+	e := RunError{Path: rest[open+1 : closing]}
+
+	before := strings.TrimRight(strings.TrimSpace(rest[:open]), ":(")
+	after := strings.TrimSpace(strings.TrimPrefix(rest[closing+1:], ")"))
+	if m := errnoSuffix.FindStringSubmatch(after); m != nil {
+		e.Errno, _ = strconv.Atoi(m[1])
+		after = strings.TrimSpace(after[:len(after)-len(m[0])])
+	}
+	switch {
+	case after == "":
+		e.Message = before
+	case strings.HasPrefix(after, ":"):
+		e.Message = before + ": " + strings.TrimSpace(after[1:])
+	default:
+		e.Message = before + " " + after
+	}
+	return e, true
+}
+
+// runErrors collects the per-file errors of a run from its output streams.
+type runErrors struct {
+	mu   sync.Mutex
+	list []RunError
+}
+
+func (r *runErrors) add(e RunError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.list) < maxRunErrors {
+		r.list = append(r.list, e)
+	}
+}
+
+// errors returns the errors collected so far, nil if there are none.
+func (r *runErrors) errors() []RunError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.list) == 0 {
+		return nil
+	}
+	return append([]RunError(nil), r.list...)
+}
+
+// errorWriter passes one of rsync's output streams through to w while
+// collecting the per-file errors in it.
+type errorWriter struct {
+	w    io.Writer
+	buf  []byte
+	errs *runErrors
+}
+
+func (e *errorWriter) Write(b []byte) (int, error) {
+	n, err := e.w.Write(b)
+	e.buf = append(e.buf, b[:n]...)
+	for {
+		i := bytes.IndexAny(e.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if re, ok := parseRunError(string(e.buf[:i])); ok {
+			e.errs.add(re)
+		}
+		e.buf = e.buf[i+1:]
+	}
+	if len(e.buf) > maxProgressLine {
+		e.buf = append([]byte(nil), e.buf[len(e.buf)-maxProgressLine:]...)
+	}
+	return n, err
+}
+
+// maxErrorOutput bounds the stderr tail kept on a run as ErrorOutput.
+const maxErrorOutput = 2048
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max     int
+	buf     []byte
+	dropped bool
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > t.max {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-t.max:]...)
+		t.dropped = true
+	}
+	return len(b), nil
+}
+
+// String returns the kept output, starting at a line boundary when the
+// beginning was dropped.
+func (t *tailBuffer) String() string {
+	out := t.buf
+	if t.dropped {
+		if i := bytes.IndexByte(out, '\n'); i >= 0 {
+			out = out[i+1:]
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
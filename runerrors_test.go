@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseRunError(t *testing.T) {
+	tests := []struct {
+		line string
+		want RunError
+		ok   bool
+	}{
+		{
+			line: `rsync: send_files failed to open "/mnt/plex-media/media/movies/restricted.mkv": Permission denied (13)`,
+			want: RunError{Path: "/mnt/plex-media/media/movies/restricted.mkv", Message: "send_files failed to open: Permission denied", Errno: 13},
+			ok:   true,
+		},
+		{
+			line: `rsync: [sender] readlink_stat("/src/gone.mkv") failed: No such file or directory (2)`,
+			want: RunError{Path: "/src/gone.mkv", Message: "readlink_stat failed: No such file or directory", Errno: 2},
+			ok:   true,
+		},
+		{
+			line: `file has vanished: "/src/tmp/partial.mkv"`,
+			want: RunError{Path: "/src/tmp/partial.mkv", Message: "file has vanished"},
+			ok:   true,
+		},
+		{line: `rsync error: some files/attrs were not transferred (code 23)`},
+		{line: `rsync: connection unexpectedly closed (0 bytes received so far) [sender]`},
+		{line: `media/movies/file1.mkv`},
+	}
+	for _, tt := range tests {
+		got, ok := parseRunError(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseRunError(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestErrorWriter_CollectsAcrossWrites(t *testing.T) {
+	out := "sending incremental file list\nmedia/movies/file1.mkv\n" +
+		`rsync: send_files failed to open "/mnt/plex-media/media/movies/restricted.mkv": Permission denied (13)` +
+		"\nmedia/movies/file2.mkv\n\nrsync error: some files/attrs were not transferred (code 23)\n"
+	errs := &runErrors{}
+	w := &errorWriter{w: io.Discard, errs: errs}
+	// Split mid-line to check lines are reassembled.
+	w.Write([]byte(out[:60]))
+	w.Write([]byte(out[60:]))
+
+	want := []RunError{{Path: "/mnt/plex-media/media/movies/restricted.mkv", Message: "send_files failed to open: Permission denied", Errno: 13}}
+	if got := errs.errors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %+v, want %+v", got, want)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tb := &tailBuffer{max: 16}
+	tb.Write([]byte("first line\nsecond\n"))
+	tb.Write([]byte("third\n"))
+	if got := tb.String(); got != "second\nthird" {
+		t.Errorf("tail = %q, want the partial first line dropped", got)
+	}
+}
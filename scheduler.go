@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -10,6 +12,9 @@ import (
 type Scheduler struct {
 	cron     *cron.Cron
 	executor *BackupExecutor
+	clock    Clock
+
+	mu       sync.Mutex // guards schedule and entryID
 	schedule string
 	entryID  cron.EntryID
 }
@@ -20,15 +25,11 @@ func NewScheduler(executor *BackupExecutor, schedule string) (*Scheduler, error)
 	s := &Scheduler{
 		cron:     c,
 		executor: executor,
+		clock:    realClock{},
 		schedule: schedule,
 	}
 
-	id, err := c.AddFunc(schedule, func() {
-		log.Info().Msg("scheduled backup triggered")
-		if err := executor.Run(); err != nil {
-			log.Warn().Err(err).Msg("scheduled backup skipped")
-		}
-	})
+	id, err := c.AddFunc(schedule, s.runScheduled)
 	if err != nil {
 		return nil, err
 	}
@@ -37,9 +38,49 @@ func NewScheduler(executor *BackupExecutor, schedule string) (*Scheduler, error)
 	return s, nil
 }
 
+func (s *Scheduler) runScheduled() {
+	log.Info().Msg("scheduled backup triggered")
+	if cur := s.executor.Current(); cur != nil && cur.Overrunning {
+		reason := fmt.Sprintf("previous backup still running after %s (over max_run_duration)",
+			s.clock.Now().Sub(cur.StartTime).Truncate(time.Second))
+		s.executor.RecordSkip(reason)
+		log.Warn().Str("run", cur.ID).Msg("scheduled backup skipped: " + reason)
+		return
+	}
+	if err := s.executor.Run(); err != nil {
+		s.executor.RecordSkip(err.Error())
+		log.Warn().Err(err).Msg("scheduled backup skipped")
+	}
+}
+
+// Reschedule replaces the backup schedule with a new cron expression. The
+// old schedule stays in place if the new one does not parse.
+func (s *Scheduler) Reschedule(schedule string) error {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.cron.Schedule(sched, cron.FuncJob(s.runScheduled))
+	s.cron.Remove(s.entryID)
+	s.entryID = id
+	s.schedule = schedule
+	log.Info().Str("schedule", schedule).Msg("backup schedule changed")
+	return nil
+}
+
+// Schedule returns the current cron expression.
+func (s *Scheduler) Schedule() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.schedule
+}
+
 func (s *Scheduler) Start() {
 	s.cron.Start()
-	log.Info().Str("schedule", s.schedule).Msg("scheduler started")
+	log.Info().Str("schedule", s.Schedule()).Msg("scheduler started")
 }
 
 func (s *Scheduler) Stop() {
@@ -50,6 +91,9 @@ func (s *Scheduler) Stop() {
 
 // NextRun returns the next scheduled backup time.
 func (s *Scheduler) NextRun() time.Time {
-	entry := s.cron.Entry(s.entryID)
+	s.mu.Lock()
+	id := s.entryID
+	s.mu.Unlock()
+	entry := s.cron.Entry(id)
 	return entry.Next
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -98,3 +99,118 @@ func TestNewScheduler_ValidCron(t *testing.T) {
 		})
 	}
 }
+
+func TestScheduler_Reschedule(t *testing.T) {
+	cfg := &Config{LogDir: t.TempDir()}
+	executor := NewBackupExecutor(cfg)
+
+	sched, err := NewScheduler(executor, "0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched.Start()
+	defer sched.Stop()
+
+	if err := sched.Reschedule("30 4 * * *"); err != nil {
+		t.Fatalf("Reschedule() error = %v", err)
+	}
+	if got := sched.Schedule(); got != "30 4 * * *" {
+		t.Errorf("Schedule() = %q, want 30 4 * * *", got)
+	}
+	next := sched.NextRun()
+	if next.Hour() != 4 || next.Minute() != 30 {
+		t.Errorf("NextRun() = %v, want 04:30", next)
+	}
+	if n := len(sched.cron.Entries()); n != 1 {
+		t.Errorf("cron has %d entries, want the old one replaced", n)
+	}
+
+	if err := sched.Reschedule("not a cron"); err == nil {
+		t.Error("expected error for invalid schedule")
+	}
+	if got := sched.Schedule(); got != "30 4 * * *" {
+		t.Errorf("Schedule() = %q, want the previous schedule kept after a bad update", got)
+	}
+}
+
+func TestScheduler_SkipsWhileOverrunning(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxRunDuration = 50 * time.Millisecond
+	executor := NewBackupExecutor(cfg)
+	executor.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sleep", "0.5")
+	}
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := executor.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitForLogFile(t, executor)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cur := executor.Current(); cur != nil && cur.Overrunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cur := executor.Current(); cur == nil || !cur.Overrunning {
+		t.Fatal("run should be flagged as overrunning after max_run_duration")
+	}
+
+	sched.runScheduled()
+	skip := executor.LastSkip()
+	if skip == nil || !strings.Contains(skip.Reason, "max_run_duration") {
+		t.Errorf("LastSkip() = %+v, want a max_run_duration skip reason", skip)
+	}
+
+	if err := waitForStatus(executor, StatusSuccess, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if last := executor.LastRun(); !last.Overrunning {
+		t.Error("finished run should keep the overrunning flag in history")
+	}
+}
+
+func TestScheduler_RecordsSkipWhenBusy(t *testing.T) {
+	cfg := testConfig(t)
+	executor := NewBackupExecutor(cfg)
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not yet overrunning (no max_run_duration): Run itself refuses
+	executor.mu.Lock()
+	executor.status = StatusRunning
+	executor.running = true
+	executor.current = &BackupRun{ID: "busy", StartTime: time.Now(), Status: StatusRunning}
+	executor.mu.Unlock()
+
+	sched.runScheduled()
+	if skip := executor.LastSkip(); skip == nil || !strings.Contains(skip.Reason, "already in progress") {
+		t.Errorf("LastSkip() = %+v, want 'already in progress'", skip)
+	}
+}
+
+func TestScheduler_SkipsWhileLocked(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.locked.Store(true)
+	executor := NewBackupExecutor(cfg)
+	executor.cmdFactory = fakeRsyncCmd(0, "ok")
+	sched, err := NewScheduler(executor, cfg.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sched.runScheduled()
+	if executor.IsRunning() {
+		t.Error("scheduled backup should not start while locked")
+	}
+	if skip := executor.LastSkip(); skip == nil || !strings.Contains(skip.Reason, "locked") {
+		t.Errorf("LastSkip() = %+v, want a locked skip reason", skip)
+	}
+}
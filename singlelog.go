@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// singleLogName is the log every run appends to with single_log_file.
+// Rotated copies are named rsync.log.1 (newest) to rsync.log.<n>.
+const singleLogName = "rsync.log"
+
+// defaultMaxLogSize is the rotation size for single_log_file when
+// max_log_size is unset.
+const defaultMaxLogSize = 10 << 20
+
+// runDelimiter starts each run's section of the single log; readRunSection
+// finds a run's output by it.
+func runDelimiter(id string) string {
+	return fmt.Sprintf("##### run %s #####\n", id)
+}
+
+// rotatedLogIndex returns n for rsync.log.<n>, 0 for rsync.log itself, and
+// false for any other name.
+func rotatedLogIndex(name string) (int, bool) {
+	if name == singleLogName {
+		return 0, true
+	}
+	suffix, ok := strings.CutPrefix(name, singleLogName+".")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 1 || strconv.Itoa(n) != suffix {
+		return 0, false
+	}
+	return n, true
+}
+
+// rotatedLogName is the inverse of rotatedLogIndex.
+func rotatedLogName(n int) string {
+	if n == 0 {
+		return singleLogName
+	}
+	return fmt.Sprintf("%s.%d", singleLogName, n)
+}
+
+// singleLogFiles is how many files the single log keeps, the live one
+// included.
+func (ex *BackupExecutor) singleLogFiles() int {
+	return max(ex.cfg.MaxLogFiles, 1)
+}
+
+// rotateSingleLog shifts rsync.log to rsync.log.1, rsync.log.1 to
+// rsync.log.2 and so on once it has reached max_log_size, dropping the
+// oldest so that max_log_files files remain. It runs before a run starts
+// writing, so a run's section never spans two files.
+func (ex *BackupExecutor) rotateSingleLog() error {
+	limit := int64(ex.cfg.MaxLogSize)
+	if limit <= 0 {
+		limit = defaultMaxLogSize
+	}
+	info, err := os.Stat(filepath.Join(ex.cfg.LogDir, singleLogName))
+	if err != nil || info.Size() < limit {
+		return nil
+	}
+
+	path := func(n int) string { return filepath.Join(ex.cfg.LogDir, rotatedLogName(n)) }
+	keep := ex.singleLogFiles()
+	if err := os.Remove(path(keep - 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(path(n-1), path(n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSingleLog is pruneOldLogs for single_log_file: rotated copies beyond
+// max_log_files (left behind when it was lowered) or older than max_log_age
+// are removed. The live log is always kept.
+func (ex *BackupExecutor) pruneSingleLog() {
+	entries, err := os.ReadDir(ex.cfg.LogDir)
+	if err != nil {
+		return
+	}
+	cutoff := ex.clock.Now().Add(-ex.cfg.MaxLogAge)
+	for _, e := range entries {
+		n, ok := rotatedLogIndex(e.Name())
+		if !ok || n == 0 || e.IsDir() {
+			continue
+		}
+		remove := n >= ex.singleLogFiles()
+		if !remove && ex.cfg.MaxLogAge > 0 {
+			if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(filepath.Join(ex.cfg.LogDir, e.Name()))
+		}
+	}
+}
+
+// ReadRunLog returns one run's output from the single log, searching the
+// live file first and then the rotated copies, newest first.
+func (ex *BackupExecutor) ReadRunLog(id string) (string, error) {
+	for n := 0; n < ex.singleLogFiles(); n++ {
+		content, err := ex.ReadLog(rotatedLogName(n))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		if section, ok := readRunSection(content, id); ok {
+			return section, nil
+		}
+	}
+	return "", fmt.Errorf("no log output for run %s: %w", id, os.ErrNotExist)
+}
+
+// readRunSection cuts a run's section out of the single log: from its
+// delimiter up to the next run's.
+func readRunSection(content, id string) (string, bool) {
+	start := strings.Index(content, runDelimiter(id))
+	if start < 0 {
+		return "", false
+	}
+	section := content[start+len(runDelimiter(id)):]
+	if end := strings.Index(section, "\n##### run "); end >= 0 {
+		section = section[:end+1]
+	}
+	return section, true
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func singleLogExecutor(t *testing.T, maxSize ByteSize, maxFiles int) *BackupExecutor {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.SingleLogFile = true
+	cfg.MaxLogSize = maxSize
+	cfg.MaxLogFiles = maxFiles
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, "sending incremental file list\nNumber of files: 3\nNumber of regular files transferred: 2\n")
+	return ex
+}
+
+// runToCompletion starts a backup and waits for it, log rotation included.
+func runToCompletion(t *testing.T, ex *BackupExecutor) BackupRun {
+	t.Helper()
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ex.Wait(context.Background())
+	return *ex.LastRun()
+}
+
+func TestSingleLogFile_Appends(t *testing.T) {
+	ex := singleLogExecutor(t, 0, 5)
+	first := runToCompletion(t, ex)
+	second := runToCompletion(t, ex)
+
+	if first.LogFile != singleLogName || second.LogFile != singleLogName {
+		t.Fatalf("log files = %q, %q, want both %q", first.LogFile, second.LogFile, singleLogName)
+	}
+	entries, _ := os.ReadDir(ex.cfg.LogDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "backup-") {
+			t.Errorf("unexpected per-run log %s", e.Name())
+		}
+	}
+
+	content, err := ex.ReadLog(singleLogName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(content, "=== Backup started") != 2 {
+		t.Errorf("rsync.log should hold both runs:\n%s", content)
+	}
+	for _, run := range []BackupRun{first, second} {
+		section, err := ex.ReadRunLog(run.ID)
+		if err != nil {
+			t.Fatalf("ReadRunLog(%s): %v", run.ID, err)
+		}
+		if strings.Count(section, "=== Backup started") != 1 || !strings.Contains(section, "exit code: 0") {
+			t.Errorf("section for %s should be exactly one run:\n%s", run.ID, section)
+		}
+		if run.Stats == nil || run.Stats.FilesTransferred != 2 {
+			t.Errorf("run %s stats = %+v, want 2 files transferred", run.ID, run.Stats)
+		}
+	}
+}
+
+func TestSingleLogFile_RotatesAtMaxSize(t *testing.T) {
+	// Every run is larger than 100 bytes, so each later run rotates
+	ex := singleLogExecutor(t, 100, 2)
+	var runs []BackupRun
+	for i := 0; i < 3; i++ {
+		runs = append(runs, runToCompletion(t, ex))
+	}
+
+	for name, want := range map[string]bool{"rsync.log": true, "rsync.log.1": true, "rsync.log.2": false} {
+		_, err := os.Stat(filepath.Join(ex.cfg.LogDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+	if _, err := ex.ReadRunLog(runs[0].ID); err == nil {
+		t.Error("the oldest run should have been rotated out")
+	}
+	if section, err := ex.ReadRunLog(runs[1].ID); err != nil || !strings.Contains(section, "Backup started") {
+		t.Errorf("run in rsync.log.1 = %q, %v", section, err)
+	}
+	if content, _ := ex.ReadLog("rsync.log"); strings.Count(content, "##### run ") != 1 {
+		t.Errorf("rsync.log should hold only the newest run:\n%s", content)
+	}
+}
+
+func TestSingleLogFile_BelowMaxSizeKeepsAppending(t *testing.T) {
+	ex := singleLogExecutor(t, 1<<20, 2)
+	for i := 0; i < 3; i++ {
+		runToCompletion(t, ex)
+	}
+	if _, err := os.Stat(filepath.Join(ex.cfg.LogDir, "rsync.log.1")); err == nil {
+		t.Error("rsync.log was rotated below max_log_size")
+	}
+}
+
+func TestSingleLogFile_KeepsPerRunLogs(t *testing.T) {
+	// Logs from before single_log_file was turned on
+	ex := singleLogExecutor(t, 0, 2)
+	os.MkdirAll(ex.cfg.LogDir, 0755)
+	for day := 1; day <= 3; day++ {
+		id := fmt.Sprintf("202601%02d-030000.000", day)
+		name := "backup-" + id + ".log"
+		os.WriteFile(filepath.Join(ex.cfg.LogDir, name), []byte("old run "+id+"\n"), 0644)
+		ex.history = append([]BackupRun{{ID: id, StartTime: time.Date(2026, 1, day, 3, 0, 0, 0, time.UTC), Status: StatusSuccess, LogFile: name}}, ex.history...)
+	}
+	runToCompletion(t, ex)
+
+	if content, err := ex.ReadLog("backup-20260103-030000.000.log"); err != nil || !strings.Contains(content, "old run") {
+		t.Errorf("ReadLog(per-run log) = %q, %v, want it still readable", content, err)
+	}
+	// Pruned to max_log_files, oldest first
+	if _, err := os.Stat(filepath.Join(ex.cfg.LogDir, "backup-20260101-030000.000.log")); !os.IsNotExist(err) {
+		t.Errorf("the oldest per-run log should have been pruned, stat error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ex.cfg.LogDir, "backup-20260102-030000.000.log")); err != nil {
+		t.Errorf("a per-run log within max_log_files was pruned: %v", err)
+	}
+	if usage, err := ex.LogUsage(); err != nil || usage.LogFiles != 3 {
+		t.Errorf("LogUsage() = %+v, %v, want rsync.log and both per-run logs counted", usage, err)
+	}
+}
+
+func TestRotatedLogIndex(t *testing.T) {
+	for name, want := range map[string]int{"rsync.log": 0, "rsync.log.1": 1, "rsync.log.12": 12} {
+		if n, ok := rotatedLogIndex(name); !ok || n != want {
+			t.Errorf("rotatedLogIndex(%q) = %d, %v, want %d", name, n, ok, want)
+		}
+	}
+	for _, name := range []string{"rsync.log.0", "rsync.log.01", "rsync.log.gz", "backup-1.log", "rsync.log.-1"} {
+		if _, ok := rotatedLogIndex(name); ok {
+			t.Errorf("rotatedLogIndex(%q) should not match", name)
+		}
+	}
+}
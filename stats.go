@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TransferStats holds the figures reported by rsync --stats for a single run.
+type TransferStats struct {
+	NumFiles         int64   `json:"num_files"`
+	FilesTransferred int64   `json:"files_transferred"`
+	TotalSize        int64   `json:"total_size"`
+	TransferredSize  int64   `json:"transferred_size"`
+	BytesSent        int64   `json:"bytes_sent"`
+	BytesReceived    int64   `json:"bytes_received"`
+	BytesPerSec      float64 `json:"bytes_per_sec"`
+}
+
+// statsTailBytes is how much of the end of a log is scanned for the --stats
+// block, which rsync prints last.
+const statsTailBytes = 64 * 1024
+
+var (
+	statsNumberRe = regexp.MustCompile(`^([\d,]+(?:\.\d+)?)`)
+	statsSpeedRe  = regexp.MustCompile(`^sent ([\d,]+) bytes\s+received ([\d,]+) bytes\s+([\d,.]+) bytes/sec`)
+)
+
+// parseStatsNumber parses the leading number of s, ignoring thousands separators.
+func parseStatsNumber(s string) (float64, bool) {
+	m := statsNumberRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	return v, err == nil
+}
+
+// parseRsyncStats extracts transfer statistics from rsync --stats output.
+// Returns nil if the output contains no stats block.
+func parseRsyncStats(output string) *TransferStats {
+	var st TransferStats
+	found := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := statsSpeedRe.FindStringSubmatch(line); m != nil {
+			if v, ok := parseStatsNumber(m[3]); ok {
+				st.BytesPerSec = v
+				found = true
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		n, ok := parseStatsNumber(value)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Number of files":
+			st.NumFiles = int64(n)
+		// rsync 3.1+ reports regular files; older versions report all files
+		case "Number of regular files transferred", "Number of files transferred":
+			st.FilesTransferred = int64(n)
+		case "Total file size":
+			st.TotalSize = int64(n)
+		case "Total transferred file size":
+			st.TransferredSize = int64(n)
+		case "Total bytes sent":
+			st.BytesSent = int64(n)
+		case "Total bytes received":
+			st.BytesReceived = int64(n)
+		default:
+			continue
+		}
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return &st
+}
+
+// CumulativeStats are lifetime totals across all runs. Unlike the history,
+// they are never truncated.
+type CumulativeStats struct {
+	TotalRuns             int64 `json:"total_runs"`
+	SuccessfulRuns        int64 `json:"successful_runs"`
+	TotalBytesTransferred int64 `json:"total_bytes_transferred"`
+	TotalFilesTransferred int64 `json:"total_files_transferred"`
+}
+
+// add accounts for a finished run. Dry runs copy nothing and are left out.
+func (c *CumulativeStats) add(run BackupRun) {
+	if run.DryRun {
+		return
+	}
+	c.TotalRuns++
+	if run.Status == StatusSuccess {
+		c.SuccessfulRuns++
+	}
+	if run.Stats != nil {
+		c.TotalBytesTransferred += run.Stats.TransferredSize
+		c.TotalFilesTransferred += run.Stats.FilesTransferred
+	}
+}
+
+// successRateWindow is how many recent runs the dashboard's success rate
+// covers.
+const successRateWindow = 30
+
+// SuccessRate summarises the outcome of recent runs. Only StatusSuccess
+// counts as a success: warnings (partial transfers) are reported separately
+// and lower the percentage, since some files were not backed up.
+type SuccessRate struct {
+	Runs      int     `json:"runs"`
+	Succeeded int     `json:"succeeded"`
+	Warnings  int     `json:"warnings"`
+	Failed    int     `json:"failed"`
+	Percent   float64 `json:"percent"`
+}
+
+// computeSuccessRate tallies the first n finished runs of history (newest
+// first), or all of them when n <= 0.
+func computeSuccessRate(history []BackupRun, n int) SuccessRate {
+	var r SuccessRate
+	for _, run := range history {
+		if n > 0 && r.Runs == n {
+			break
+		}
+		switch run.Status {
+		case StatusSuccess:
+			r.Succeeded++
+		case StatusWarning:
+			r.Warnings++
+		case StatusFailed:
+			r.Failed++
+		default:
+			continue // not a finished run
+		}
+		r.Runs++
+	}
+	if r.Runs > 0 {
+		r.Percent = math.Round(float64(r.Succeeded)/float64(r.Runs)*1000) / 10
+	}
+	return r
+}
+
+// SuccessRate returns the success rate over the last n runs in history, or
+// over the whole history when n <= 0.
+func (ex *BackupExecutor) SuccessRate(n int) SuccessRate {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return computeSuccessRate(ex.history, n)
+}
+
+// ThroughputPoint is one finished run in the throughput time series.
+type ThroughputPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Bytes is the data actually transferred (rsync's "Total transferred
+	// file size").
+	Bytes int64 `json:"bytes"`
+	// Duration is the run's wall-clock time in seconds.
+	Duration float64 `json:"duration"`
+	// Speed is rsync's reported average in bytes per second.
+	Speed float64 `json:"speed"`
+}
+
+// computeThroughput returns a point per run in history (newest first) that
+// has transfer stats, oldest first for charting. History is capped, so the
+// series is too.
+func computeThroughput(history []BackupRun) []ThroughputPoint {
+	points := []ThroughputPoint{}
+	for i := len(history) - 1; i >= 0; i-- {
+		run := history[i]
+		if run.Stats == nil || run.EndTime.IsZero() {
+			continue
+		}
+		points = append(points, ThroughputPoint{
+			Timestamp: run.StartTime,
+			Bytes:     run.Stats.TransferredSize,
+			Duration:  run.EndTime.Sub(run.StartTime).Seconds(),
+			Speed:     run.Stats.BytesPerSec,
+		})
+	}
+	return points
+}
+
+// Throughput returns the throughput series for the runs in history.
+func (ex *BackupExecutor) Throughput() []ThroughputPoint {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return computeThroughput(ex.history)
+}
+
+func (ex *BackupExecutor) statsPath() string {
+	return filepath.Join(ex.cfg.LogDir, "stats.json")
+}
+
+// Totals returns the lifetime transfer statistics.
+func (ex *BackupExecutor) Totals() CumulativeStats {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	return ex.totals
+}
+
+func (ex *BackupExecutor) loadTotals() {
+	if err := readJSONFile(ex.statsPath(), &ex.totals); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("failed to parse stats")
+	}
+}
+
+// saveTotals persists the lifetime statistics. Must be called with ex.mu held.
+func (ex *BackupExecutor) saveTotals() error {
+	data, err := json.MarshalIndent(ex.totals, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling stats: %w", err)
+	}
+	return writeFileAtomic(ex.statsPath(), data, 0644)
+}
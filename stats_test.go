@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleStatsOutput = `sending incremental file list
+
+Number of files: 1,234 (reg: 1,000, dir: 234)
+Number of created files: 3
+Number of deleted files: 0
+Number of regular files transferred: 12
+Total file size: 800,000,000,000 bytes
+Total transferred file size: 5,000,000 bytes
+Literal data: 5,000,000 bytes
+Matched data: 0 bytes
+File list size: 65,536
+Total bytes sent: 5,100,000
+Total bytes received: 300
+
+sent 5,100,000 bytes  received 300 bytes  1,020,060.00 bytes/sec
+total size is 800,000,000,000  speedup is 156,862.75`
+
+func TestParseRsyncStats(t *testing.T) {
+	st := parseRsyncStats(sampleStatsOutput)
+	if st == nil {
+		t.Fatal("expected stats to be parsed")
+	}
+
+	if st.NumFiles != 1234 {
+		t.Errorf("NumFiles = %d, want 1234", st.NumFiles)
+	}
+	if st.FilesTransferred != 12 {
+		t.Errorf("FilesTransferred = %d, want 12", st.FilesTransferred)
+	}
+	if st.TotalSize != 800000000000 {
+		t.Errorf("TotalSize = %d, want 800000000000", st.TotalSize)
+	}
+	if st.TransferredSize != 5000000 {
+		t.Errorf("TransferredSize = %d, want 5000000", st.TransferredSize)
+	}
+	if st.BytesSent != 5100000 || st.BytesReceived != 300 {
+		t.Errorf("BytesSent/BytesReceived = %d/%d, want 5100000/300", st.BytesSent, st.BytesReceived)
+	}
+	if st.BytesPerSec != 1020060 {
+		t.Errorf("BytesPerSec = %v, want 1020060", st.BytesPerSec)
+	}
+}
+
+func TestParseRsyncStats_OlderFormat(t *testing.T) {
+	// rsync < 3.1 reports "Number of files transferred"
+	st := parseRsyncStats("Number of files: 100\nNumber of files transferred: 98\nTotal transferred file size: 490,000,000 bytes\n")
+	if st == nil {
+		t.Fatal("expected stats to be parsed")
+	}
+	if st.FilesTransferred != 98 {
+		t.Errorf("FilesTransferred = %d, want 98", st.FilesTransferred)
+	}
+	if st.TransferredSize != 490000000 {
+		t.Errorf("TransferredSize = %d, want 490000000", st.TransferredSize)
+	}
+}
+
+func TestParseRsyncStats_NoStats(t *testing.T) {
+	if st := parseRsyncStats("ssh: connect to host backup-host port 22: Connection refused\n"); st != nil {
+		t.Errorf("expected nil stats for output without a stats block, got %+v", st)
+	}
+}
+
+func TestBackup_RecordsStatsAndTotals(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(0, sampleStatsOutput)
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusSuccess, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	last := ex.LastRun()
+	if last.Stats == nil || last.Stats.TransferredSize != 5000000 {
+		t.Fatalf("run stats = %+v, want transferred size 5000000", last.Stats)
+	}
+
+	totals := ex.Totals()
+	if totals.TotalRuns != 1 || totals.SuccessfulRuns != 1 {
+		t.Errorf("totals runs = %d/%d, want 1/1", totals.TotalRuns, totals.SuccessfulRuns)
+	}
+	if totals.TotalBytesTransferred != 5000000 {
+		t.Errorf("TotalBytesTransferred = %d, want 5000000", totals.TotalBytesTransferred)
+	}
+
+	// Totals survive a restart
+	ex2 := NewBackupExecutor(cfg)
+	if got := ex2.Totals(); got != totals {
+		t.Errorf("reloaded totals = %+v, want %+v", got, totals)
+	}
+}
+
+func TestTotals_SurviveHistoryCap(t *testing.T) {
+	cfg := testConfig(t)
+	os.MkdirAll(cfg.LogDir, 0755)
+	data, _ := json.Marshal(CumulativeStats{TotalRuns: 500, SuccessfulRuns: 480, TotalBytesTransferred: 1 << 40})
+	os.WriteFile(filepath.Join(cfg.LogDir, "stats.json"), data, 0644)
+
+	ex := NewBackupExecutor(cfg)
+	ex.cmdFactory = fakeRsyncCmd(23, "Total transferred file size: 1,000 bytes\n")
+
+	if err := ex.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForStatus(ex, StatusWarning, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	totals := ex.Totals()
+	if totals.TotalRuns != 501 {
+		t.Errorf("TotalRuns = %d, want 501", totals.TotalRuns)
+	}
+	if totals.SuccessfulRuns != 480 {
+		t.Errorf("SuccessfulRuns = %d, want 480 (warnings are not successes)", totals.SuccessfulRuns)
+	}
+	if totals.TotalBytesTransferred != 1<<40+1000 {
+		t.Errorf("TotalBytesTransferred = %d, want %d", totals.TotalBytesTransferred, int64(1<<40+1000))
+	}
+}
+
+func TestHandler_APIStats(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.totals = CumulativeStats{TotalRuns: 7, SuccessfulRuns: 6, TotalBytesTransferred: 4096}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/stats", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/stats status = %d, want 200", w.Code)
+	}
+	var totals CumulativeStats
+	if err := json.NewDecoder(w.Body).Decode(&totals); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if totals.TotalRuns != 7 || totals.SuccessfulRuns != 6 || totals.TotalBytesTransferred != 4096 {
+		t.Errorf("stats = %+v, want 7 runs, 6 successful, 4096 bytes", totals)
+	}
+
+	// Also part of the status payload
+	req = httptest.NewRequest("GET", "/api/status", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var data DashboardData
+	json.NewDecoder(w.Body).Decode(&data)
+	if data.Totals.TotalRuns != 7 {
+		t.Errorf("status totals = %+v, want 7 runs", data.Totals)
+	}
+}
+
+func TestComputeSuccessRate(t *testing.T) {
+	// Newest first: 3 success, 1 warning, 1 failed, then older runs
+	history := []BackupRun{
+		{Status: StatusSuccess},
+		{Status: StatusWarning},
+		{Status: StatusSuccess},
+		{Status: StatusFailed},
+		{Status: StatusSuccess},
+		{Status: StatusFailed},
+		{Status: StatusFailed},
+	}
+
+	got := computeSuccessRate(history, 5)
+	want := SuccessRate{Runs: 5, Succeeded: 3, Warnings: 1, Failed: 1, Percent: 60}
+	if got != want {
+		t.Errorf("last 5 = %+v, want %+v", got, want)
+	}
+
+	got = computeSuccessRate(history, 0)
+	want = SuccessRate{Runs: 7, Succeeded: 3, Warnings: 1, Failed: 3, Percent: 42.9}
+	if got != want {
+		t.Errorf("all = %+v, want %+v", got, want)
+	}
+
+	if got := computeSuccessRate(nil, 30); got != (SuccessRate{}) {
+		t.Errorf("empty history = %+v, want zero", got)
+	}
+}
+
+func TestHandler_APIStats_SuccessRate(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.history = sampleHistory(9)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/stats?last=3", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/stats?last=3 status = %d, want 200", w.Code)
+	}
+	var body struct {
+		SuccessRate SuccessRate `json:"success_rate"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if want := (SuccessRate{Runs: 3, Succeeded: 1, Warnings: 1, Failed: 1, Percent: 33.3}); body.SuccessRate != want {
+		t.Errorf("success_rate = %+v, want %+v", body.SuccessRate, want)
+	}
+
+	req = httptest.NewRequest("GET", "/api/stats?last=-1", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/stats?last=-1 status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandler_Throughput(t *testing.T) {
+	srv, executor := testServer(t)
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	executor.history = []BackupRun{
+		{ID: "newest", Status: StatusFailed, StartTime: start.Add(48 * time.Hour), EndTime: start.Add(48*time.Hour + time.Second)},
+		{ID: "middle", Status: StatusSuccess, StartTime: start.Add(24 * time.Hour), EndTime: start.Add(24*time.Hour + 90*time.Second),
+			Stats: &TransferStats{TransferredSize: 9000, BytesPerSec: 100}},
+		{ID: "oldest", Status: StatusWarning, StartTime: start, EndTime: start.Add(time.Minute),
+			Stats: &TransferStats{TransferredSize: 6000, BytesPerSec: 100.5}},
+	}
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/metrics/throughput", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/metrics/throughput status = %d, want 200", w.Code)
+	}
+	// Oldest first; the run without stats is left out
+	want := `[{"timestamp":"2026-01-02T03:00:00Z","bytes":6000,"duration":60,"speed":100.5},` +
+		`{"timestamp":"2026-01-03T03:00:00Z","bytes":9000,"duration":90,"speed":100}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("body = %s\nwant %s", got, want)
+	}
+
+	executor.history = nil
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/metrics/throughput", nil))
+	if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+		t.Errorf("body without history = %s, want []", got)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	var gotArgs []string
+	ex.cmdFactory = func(name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		return fakeRsyncCmd(0, sampleStatsOutput)(name, args...)
+	}
+
+	est, err := ex.Estimate()
+	if err != nil {
+		t.Fatalf("Estimate() error = %v", err)
+	}
+	want := SizeEstimate{NumFiles: 1234, TotalSize: 800000000000, FilesToTransfer: 12, BytesToTransfer: 5000000}
+	if *est != want {
+		t.Errorf("Estimate() = %+v, want %+v", *est, want)
+	}
+	if !strings.Contains(strings.Join(gotArgs, " "), "--dry-run") {
+		t.Errorf("rsync args should include --dry-run: %v", gotArgs)
+	}
+	if len(ex.History()) != 0 || ex.Status() != StatusIdle {
+		t.Errorf("estimate should not touch history or status, got %d runs, status %s", len(ex.History()), ex.Status())
+	}
+}
+
+func TestEstimate_RefusedWhileRunning(t *testing.T) {
+	ex := NewBackupExecutor(testConfig(t))
+	ex.mu.Lock()
+	ex.status = StatusRunning
+	ex.running = true
+	ex.mu.Unlock()
+
+	if _, err := ex.Estimate(); err == nil || !strings.Contains(err.Error(), "in progress") {
+		t.Errorf("Estimate() error = %v, want 'in progress'", err)
+	}
+}
+
+func TestHandler_Estimate(t *testing.T) {
+	srv, executor := testServer(t)
+	executor.cmdFactory = fakeRsyncCmd(0, sampleStatsOutput)
+
+	mux := http.NewServeMux()
+	srv.RegisterRoutes(mux)
+
+	req := withCSRF(httptest.NewRequest("POST", "/api/estimate", nil))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/estimate status = %d, want 200, body: %s", w.Code, w.Body.String())
+	}
+	var est SizeEstimate
+	if err := json.NewDecoder(w.Body).Decode(&est); err != nil {
+		t.Fatal(err)
+	}
+	if est.NumFiles != 1234 || est.TotalSize != 800000000000 {
+		t.Errorf("estimate = %+v, want 1234 files, 800 GB", est)
+	}
+
+	req = httptest.NewRequest("GET", "/api/estimate", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/estimate status = %d, want 405", w.Code)
+	}
+}
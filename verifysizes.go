@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// minSizeTolerance and sizeToleranceFraction bound how many bytes may still
+// differ after a run before verify_sizes flags it: files written to after
+// rsync copied them, such as a live database, should not turn every run into
+// a warning.
+const (
+	minSizeTolerance      = 1 << 20 // 1 MiB
+	sizeToleranceFraction = 0.001   // 0.1% of the source
+)
+
+// errSizeCheckCancelled is returned by compareSizes when the run is
+// cancelled before or during its dry run.
+var errSizeCheckCancelled = errors.New("size check cancelled")
+
+// compareSizes measures how much of a run's source is in sync at the
+// destination, with an rsync dry run of the same transfer: source is the
+// file bytes rsync would back up (the "Total file size" of --stats, after
+// excludes and filter_file), dest the part of it a new run would not need to
+// transfer. Counting file bytes only keeps filesystems that account for
+// directories differently from disagreeing. sub narrows the dry run to a
+// subpath run's directory.
+func (ex *BackupExecutor) compareSizes(sub string) (source, dest int64, err error) {
+	args := ex.rsyncArgs(false, nil)
+	args = append([]string{args[0], "--dry-run"}, args[1:]...)
+	if sub != "" {
+		args = ex.subpathArgs(args, sub)
+	}
+	cmd := ex.cmdFactory("rsync", args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	// Started like the backup itself, so Cancel and shutdown can stop it
+	ex.mu.Lock()
+	if ex.cancelled {
+		ex.mu.Unlock()
+		return 0, 0, errSizeCheckCancelled
+	}
+	if err = cmd.Start(); err == nil {
+		ex.proc = cmd.Process
+	}
+	ex.mu.Unlock()
+	if err == nil {
+		err = cmd.Wait()
+	}
+	ex.mu.Lock()
+	cancelled := ex.cancelled
+	ex.proc = nil
+	ex.mu.Unlock()
+	if cancelled {
+		return 0, 0, errSizeCheckCancelled
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, 0, errors.New(startErrorSummary(err))
+		}
+		if ex.cfg.ExitStatus(exitErr.ExitCode()) == StatusFailed {
+			return 0, 0, fmt.Errorf("rsync dry run failed: %s", rsyncExitSummary(exitErr.ExitCode()))
+		}
+	}
+	stats := parseRsyncStats(out.String())
+	if stats == nil {
+		return 0, 0, fmt.Errorf("rsync dry run printed no stats")
+	}
+	return stats.TotalSize, stats.TotalSize - stats.TransferredSize, nil
+}
+
+// sizesDiffer reports whether dest falls short of source by more than the
+// tolerance: minSizeTolerance, or sizeToleranceFraction of source when that
+// is larger.
+func sizesDiffer(source, dest int64) bool {
+	tolerance := max(int64(minSizeTolerance), int64(float64(source)*sizeToleranceFraction))
+	return source-dest > tolerance
+}
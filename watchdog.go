@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// staleCheckInterval is how often the watchdog looks at the last success.
+const staleCheckInterval = 5 * time.Minute
+
+// StaleWatchdog alerts the configured notifiers when no backup has
+// succeeded for longer than stale_after, which catches a scheduler that has
+// silently stopped firing. It alerts once per stale period and re-arms
+// after the next successful run.
+type StaleWatchdog struct {
+	executor *BackupExecutor
+	after    time.Duration
+	clock    Clock
+
+	// started stands in for the last success until the first one, so a
+	// fresh install gets a full stale_after period before any alert.
+	started time.Time
+	alerted bool
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func NewStaleWatchdog(executor *BackupExecutor, after time.Duration) *StaleWatchdog {
+	return &StaleWatchdog{
+		executor: executor,
+		after:    after,
+		clock:    executor.clock,
+		started:  executor.clock.Now(),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the periodic check in the background until Stop is called.
+func (w *StaleWatchdog) Start() {
+	w.done.Add(1)
+	go func() {
+		defer w.done.Done()
+		ticker := time.NewTicker(staleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	log.Info().Dur("stale_after", w.after).Msg("staleness watchdog started")
+}
+
+func (w *StaleWatchdog) Stop() {
+	close(w.stop)
+	w.done.Wait()
+}
+
+// check sends a stale alert if the last success is older than the
+// threshold and none has been sent for it yet. It reports whether an alert
+// was sent.
+func (w *StaleWatchdog) check() bool {
+	last := w.executor.LastSuccess()
+	if last.IsZero() {
+		last = w.started
+	}
+	since := w.clock.Now().Sub(last)
+	if since < w.after {
+		w.alerted = false
+		return false
+	}
+	if w.alerted {
+		return false
+	}
+	w.alerted = true
+
+	summary := fmt.Sprintf("no successful backup for %s (stale_after is %s)", since.Truncate(time.Minute), w.after)
+	if lastRun := w.executor.LastRun(); lastRun != nil {
+		summary += fmt.Sprintf("; last run %s ended %s", lastRun.ID, lastRun.Status)
+	}
+	log.Warn().Time("last_success", last).Msg(summary)
+	w.executor.notify(BackupRun{Status: StatusStale, StartTime: last, Summary: summary})
+	return true
+}
+
+// LastSuccess returns the end time of the most recent successful run, or
+// the zero time if there is none in the history.
+func (ex *BackupExecutor) LastSuccess() time.Time {
+	return ex.LastSuccessAt(false)
+}
+
+// LastSuccessAt is LastSuccess, also counting runs that ended with a
+// warning (a partial transfer) when includeWarnings is set.
+func (ex *BackupExecutor) LastSuccessAt(includeWarnings bool) time.Time {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	for _, run := range ex.history {
+		if run.DryRun {
+			continue
+		}
+		if run.Status == StatusSuccess || (includeWarnings && run.Status == StatusWarning) {
+			return run.EndTime
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleWatchdog_Threshold(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	sent := make(chan string, 10)
+	ex.notifiers = []configuredNotifier{{
+		cfg:      NotifierConfig{Type: "fake", On: []BackupStatus{StatusFailed}},
+		Notifier: &fakeNotifier{name: "fake", sent: sent},
+	}}
+
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ex.clock = clock
+	w := NewStaleWatchdog(ex, 24*time.Hour)
+
+	// No success yet: the watchdog's start time is the baseline
+	clock.Set(start.Add(23 * time.Hour))
+	if w.check() {
+		t.Error("alerted before stale_after elapsed since start")
+	}
+
+	clock.Set(start.Add(25 * time.Hour))
+	if !w.check() {
+		t.Fatal("no alert after stale_after without a success")
+	}
+	if got := <-sent; got != "fake:stale" {
+		t.Errorf("notification = %q, want a stale alert regardless of on:", got)
+	}
+
+	// Only one alert per stale period
+	clock.Set(start.Add(48 * time.Hour))
+	if w.check() {
+		t.Error("alerted twice for the same stale period")
+	}
+
+	// A success re-arms the watchdog
+	ex.mu.Lock()
+	ex.history = []BackupRun{{ID: "20260103-030000", Status: StatusSuccess, EndTime: start.Add(49 * time.Hour)}}
+	ex.mu.Unlock()
+	clock.Set(start.Add(50 * time.Hour))
+	if w.check() {
+		t.Error("alerted right after a success")
+	}
+	clock.Set(start.Add(74 * time.Hour))
+	if !w.check() {
+		t.Error("no alert after stale_after since the last success")
+	}
+}
+
+func TestStaleWatchdog_IgnoresFailedRuns(t *testing.T) {
+	cfg := testConfig(t)
+	ex := NewBackupExecutor(cfg)
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	ex.history = []BackupRun{
+		{ID: "20260102-030000", Status: StatusFailed, EndTime: start.Add(24 * time.Hour)},
+		{ID: "20260101-030000", Status: StatusSuccess, EndTime: start},
+	}
+
+	w := NewStaleWatchdog(ex, 12*time.Hour)
+	w.clock = newFakeClock(start.Add(25 * time.Hour))
+	if !w.check() {
+		t.Error("a failed run should not count as a success")
+	}
+}
+
+func TestStaleWatchdog_StartStop(t *testing.T) {
+	w := NewStaleWatchdog(NewBackupExecutor(testConfig(t)), time.Hour)
+	w.Start()
+	w.Stop()
+}
+
+func TestNotificationMessage_Stale(t *testing.T) {
+	run := BackupRun{Status: StatusStale, Summary: "no successful backup for 25h0m0s (stale_after is 24h0m0s)"}
+	if got := notificationMessage(run); !strings.HasPrefix(got, "Backup is stale: no successful backup for 25h") {
+		t.Errorf("notificationMessage() = %q", got)
+	}
+	if p, _ := ntfyPriority(StatusStale); p != "high" {
+		t.Errorf("stale priority = %s, want high", p)
+	}
+}